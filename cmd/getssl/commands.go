@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/rahulshinde/nginx-proxy-go/internal/ssl"
+)
+
+// Subcommands working on the certificates in the SSL directory
+var commands = []string{"list", "renew", "revoke", "prune"}
+
+// parseCommandArgs parses the flags given after a subcommand, between and after
+// its arguments, and returns the arguments
+func parseCommandArgs(args []string) []string {
+	var positional []string
+	for {
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// listCertificates prints the certificates in sslDir with the hosts using them
+func listCertificates(sslDir, nginxConf, streamConf string) error {
+	certs, err := ssl.ListCertificates(sslDir)
+	if err != nil {
+		return fmt.Errorf("failed to list certificates: %v", err)
+	}
+	users, err := ssl.ReadCertificateUsers(nginxConf, streamConf)
+	if err != nil {
+		fmt.Printf("Warning: %v, hosts are not shown\n", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tISSUER\tEXPIRES\tSOURCE\tDOMAINS\tHOSTS")
+	for _, cert := range certs {
+		source := "custom"
+		switch {
+		case cert.SelfSigned:
+			source = "self-signed"
+		case cert.CA == ssl.LocalCAName:
+			source = "local-ca"
+		case cert.Managed && cert.CA != "":
+			source = "acme:" + cert.CA
+		case cert.Managed:
+			source = "acme"
+		}
+
+		expires := cert.NotAfter.Format("2006-01-02")
+		if days := int(time.Until(cert.NotAfter).Hours() / 24); days < 0 {
+			expires += " (expired)"
+		} else {
+			expires += fmt.Sprintf(" (%dd)", days)
+		}
+
+		hosts := "-"
+		if users == nil {
+			hosts = "?"
+		} else if names := users[cert.Name]; len(names) > 0 {
+			hosts = strings.Join(names, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", cert.Name, cert.Issuer, expires, source, strings.Join(cert.Domains, ","), hosts)
+	}
+	return w.Flush()
+}
+
+// findCertificate returns the certificate name in sslDir
+func findCertificate(sslDir, name string) (ssl.CertificateInfo, error) {
+	certs, err := ssl.ListCertificates(sslDir)
+	if err != nil {
+		return ssl.CertificateInfo{}, fmt.Errorf("failed to list certificates: %v", err)
+	}
+	for _, cert := range certs {
+		if cert.Name == name {
+			return cert, nil
+		}
+	}
+	return ssl.CertificateInfo{}, fmt.Errorf("no certificate %s in %s", name, filepath.Join(sslDir, "certs"))
+}
+
+// renewCertificates obtains the named certificates again, or all managed
+// certificates, for the same domains, with the same key type and from the CA
+// they were obtained from. ECDSA certificates are renewed with their RSA
+// certificate. keyType is used when the existing key cannot be read.
+func renewCertificates(manager *acme.Manager, sslDir string, names []string, all bool, keyType acme.KeyType, challenge acme.ChallengeType) error {
+	certs, err := ssl.ListCertificates(sslDir)
+	if err != nil {
+		return fmt.Errorf("failed to list certificates: %v", err)
+	}
+
+	var selected []ssl.CertificateInfo
+	for _, cert := range certs {
+		if cert.SelfSigned || !(all || slices.Contains(names, ssl.BaseName(cert.Name))) {
+			continue
+		}
+		if !cert.Managed {
+			if !all {
+				fmt.Printf("Skipping %s: not obtained through ACME, use getssl --new to replace it\n", cert.Name)
+			}
+			continue
+		}
+		if cert.CA == ssl.LocalCAName {
+			fmt.Printf("Skipping %s: issued by the local CA, the proxy renews it\n", cert.Name)
+			continue
+		}
+		selected = append(selected, cert)
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(selected, func(cert ssl.CertificateInfo) bool { return cert.Name == name }) {
+			fmt.Printf("No managed certificate %s in %s\n", name, filepath.Join(sslDir, "certs"))
+		}
+	}
+
+	failed := 0
+	for _, cert := range selected {
+		fmt.Printf("\n=== Renewing certificate: %s ===\n", cert.Name)
+		fmt.Printf("Names: %v\n", cert.Domains)
+
+		keyPath := filepath.Join(sslDir, "private", cert.Name+".key")
+		req := acme.CertificateRequest{
+			Domains:   cert.Domains,
+			CertPath:  filepath.Join(sslDir, "certs", cert.Name+".crt"),
+			KeyPath:   keyPath,
+			KeyType:   existingKeyType(keyPath, keyType),
+			Challenge: challenge,
+			CA:        cert.CA,
+		}
+		ca, err := manager.Obtain(req)
+		if err != nil {
+			fmt.Printf("Failed to renew certificate %s: %v\n", cert.Name, err)
+			failed++
+			continue
+		}
+		if ca.Name != cert.CA {
+			if err := ssl.MarkManaged(sslDir, cert.Name, ca.Name); err != nil {
+				fmt.Printf("Failed to record %s as the CA of %s: %v\n", ca.Name, cert.Name, err)
+			}
+		}
+		fmt.Printf("Successfully renewed certificate %s\n", cert.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d certificates failed to renew", failed, len(selected))
+	}
+	return nil
+}
+
+// existingKeyType returns the key type of the key in keyPath, fallback when it
+// cannot be read
+func existingKeyType(keyPath string, fallback acme.KeyType) acme.KeyType {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fallback
+	}
+	key, err := acme.ParsePrivateKey(data)
+	if err != nil {
+		return fallback
+	}
+	kt, err := acme.KeyTypeOf(key)
+	if err != nil {
+		return fallback
+	}
+	return kt
+}
+
+// revokeCertificates revokes the named certificates, and their ECDSA
+// certificates, with the CA they were obtained from and removes them. The
+// proxy obtains new certificates for the hosts still using them.
+func revokeCertificates(manager *acme.Manager, sslDir string, names []string, reason int) error {
+	for _, name := range names {
+		variants := []string{name}
+		if _, err := os.Stat(filepath.Join(sslDir, "certs", name+ssl.ECDSASuffix+".crt")); err == nil {
+			variants = append(variants, name+ssl.ECDSASuffix)
+		}
+
+		for _, variant := range variants {
+			cert, err := findCertificate(sslDir, variant)
+			if err != nil {
+				return err
+			}
+			if !cert.Managed || cert.CA == ssl.LocalCAName {
+				return fmt.Errorf("certificate %s was not obtained through ACME", variant)
+			}
+			leaf, err := readCertificate(filepath.Join(sslDir, "certs", variant+".crt"))
+			if err != nil {
+				return err
+			}
+			if err := manager.RevokeCertificate(cert.CA, leaf, reason); err != nil {
+				return fmt.Errorf("failed to revoke certificate %s: %v", variant, err)
+			}
+			fmt.Printf("Revoked certificate %s (serial %s)\n", variant, leaf.SerialNumber.Text(16))
+		}
+
+		for _, variant := range variants {
+			if err := ssl.RemoveCertificate(sslDir, variant); err != nil {
+				return fmt.Errorf("failed to remove certificate %s: %v", variant, err)
+			}
+		}
+		fmt.Printf("Removed certificate %s\n", name)
+	}
+	return nil
+}
+
+// readCertificate reads the leaf certificate in path
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// pruneCertificates removes the certificates no host or stream uses in the
+// generated nginx configuration, with their keys. The default certificate is
+// kept.
+func pruneCertificates(sslDir, nginxConf, streamConf string, dryRun bool) error {
+	users, err := ssl.ReadCertificateUsers(nginxConf, streamConf)
+	if err != nil {
+		return err
+	}
+	// An empty configuration is more likely the wrong file than a proxy
+	// without any certificate
+	if len(users) == 0 {
+		return fmt.Errorf("no certificate is referenced in %s, refusing to prune", nginxConf)
+	}
+
+	certs, err := ssl.ListCertificates(sslDir)
+	if err != nil {
+		return fmt.Errorf("failed to list certificates: %v", err)
+	}
+
+	pruned := 0
+	for _, cert := range certs {
+		if cert.Name == "default" {
+			continue
+		}
+		if _, ok := users[cert.Name]; ok {
+			continue
+		}
+		if _, ok := users[ssl.BaseName(cert.Name)]; ok {
+			continue
+		}
+
+		pruned++
+		if dryRun {
+			fmt.Printf("Would remove certificate %s (%s)\n", cert.Name, strings.Join(cert.Domains, ", "))
+			continue
+		}
+		if err := ssl.RemoveCertificate(sslDir, cert.Name); err != nil {
+			return fmt.Errorf("failed to remove certificate %s: %v", cert.Name, err)
+		}
+		fmt.Printf("Removed certificate %s (%s)\n", cert.Name, strings.Join(cert.Domains, ", "))
+	}
+
+	if pruned == 0 {
+		fmt.Println("No unused certificates")
+	}
+	return nil
+}
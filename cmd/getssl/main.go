@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
 	"github.com/rahulshinde/nginx-proxy-go/internal/ssl"
 )
 
@@ -19,35 +21,193 @@ func main() {
 		apiURL       = flag.String("api", "https://acme-v02.api.letsencrypt.org/directory", "ACME API URL")
 		sslDir       = flag.String("ssl-dir", "/etc/ssl", "SSL certificate directory")
 		challengeDir = flag.String("challenge-dir", "/tmp/acme-challenges", "ACME challenge directory")
+		keyTypeName  = flag.String("key-type", getEnvDefault("SSL_KEY_TYPE", string(acme.DefaultKeyType)), "Certificate key type: rsa2048, rsa4096, ec256 or ec384")
+		dual         = flag.Bool("dual", os.Getenv("SSL_DUAL_CERT") == "true", "Obtain both an RSA and an ECDSA certificate")
+		dnsProvider  = flag.String("dns-provider", os.Getenv("ACME_DNS_PROVIDER"), "Solve DNS-01 challenges with this DNS provider")
+		san          = flag.Bool("san", false, "Obtain one certificate covering all hostnames, named after the first")
+		tlsALPN      = flag.Bool("tls-alpn", os.Getenv("ACME_TLS_ALPN") == "true", "Answer TLS-ALPN-01 challenges, falling back to HTTP-01")
+		tlsALPNAddr  = flag.String("tls-alpn-addr", getEnvDefault("ACME_TLS_ALPN_ADDR", constants.DefaultACMETLSALPNAddr), "Address of the TLS-ALPN-01 responder")
+		challengeArg = flag.String("challenge", "", "Challenge type: http-01, tls-alpn-01 or dns-01")
+		caName       = flag.String("ca", os.Getenv("ACME_CA"), "CA name or ACME directory URL, overrides --api")
+		staging      = flag.Bool("staging", os.Getenv("ACME_STAGING") == "true", "Use the Let's Encrypt staging CA")
+		fallbackCA   = flag.String("fallback-ca", os.Getenv("ACME_FALLBACK_CA"), "CA name or ACME directory URL tried when issuance fails")
+		email        = flag.String("email", os.Getenv("ACME_EMAIL"), "Contact address of the ACME account")
+		eabKeyID     = flag.String("eab-kid", os.Getenv("ACME_EAB_KID"), "External Account Binding key ID")
+		eabHMACKey   = flag.String("eab-hmac-key", os.Getenv("ACME_EAB_HMAC_KEY"), "External Account Binding MAC key (base64url)")
+		rolloverKey  = flag.Bool("rollover-account-key", false, "Replace the key of the ACME account of the CA")
+		deactivate   = flag.Bool("deactivate-account", false, "Deactivate the ACME account of the CA")
+		all          = flag.Bool("all", false, "renew: Renew all managed certificates")
+		reasonName   = flag.String("reason", "unspecified", "revoke: Revocation reason")
+		dryRun       = flag.Bool("dry-run", false, "prune: Only show the certificates that would be removed")
+		nginxConf    = flag.String("nginx-conf", filepath.Join(getEnvDefault("NGINX_CONF_DIR", "/etc/nginx"), "conf.d", "default.conf"), "Generated nginx configuration, to find the hosts using each certificate")
+		streamConf   = flag.String("stream-conf", filepath.Join(getEnvDefault("NGINX_CONF_DIR", "/etc/nginx"), "stream.d", "default.conf"), "Generated nginx stream configuration, to find the streams using each certificate")
 	)
 	flag.Parse()
 
-	if *help || len(flag.Args()) == 0 {
+	// A subcommand may be followed by more flags
+	args := flag.Args()
+	command := ""
+	if len(args) > 0 && slices.Contains(commands, args[0]) {
+		command, args = args[0], parseCommandArgs(args[1:])
+	}
+
+	accountOperation := *rolloverKey || *deactivate
+	if *help || (len(args) == 0 && !accountOperation && command == "") {
 		printUsage()
 		os.Exit(0)
 	}
+	if (command == "renew" && len(args) == 0 && !*all) || (command == "revoke" && len(args) == 0) {
+		fmt.Printf("Error: getssl %s needs certificate names\n", command)
+		os.Exit(1)
+	}
+
+	// list and prune only look at the SSL directory
+	if command == "list" || command == "prune" {
+		var err error
+		if command == "list" {
+			err = listCertificates(*sslDir, *nginxConf, *streamConf)
+		} else {
+			err = pruneCertificates(*sslDir, *nginxConf, *streamConf, *dryRun)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var reason int
+	if command == "revoke" {
+		var err error
+		if reason, err = acme.ParseRevocationReason(*reasonName); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	domains := flag.Args()
+	domains := args
 
 	// Override API URL from environment if set
 	if envAPI := os.Getenv("LETSENCRYPT_API"); envAPI != "" {
 		*apiURL = envAPI
 	}
 
-	fmt.Printf("Using Let's Encrypt API URL: %s\n", *apiURL)
+	// --ca takes precedence over --staging, which takes precedence over --api
+	if *caName == "" {
+		*caName = *apiURL
+		if *staging {
+			*caName = constants.StagingACMECA
+		}
+	}
+	ca, err := acme.CAFromEnv(*caName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *email != "" {
+		ca.Email = *email
+	}
+	if *eabKeyID != "" {
+		ca.EABKeyID, ca.EABHMACKey = *eabKeyID, *eabHMACKey
+	}
+
+	fmt.Printf("Using ACME CA: %s (%s)\n", ca.Name, ca.DirectoryURL)
 	fmt.Printf("SSL Directory: %s\n", *sslDir)
 	fmt.Printf("Challenge Directory: %s\n", *challengeDir)
 	fmt.Printf("Domains: %v\n", domains)
 
+	keyType, err := acme.ParseKeyType(*keyTypeName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Key Type: %s (dual: %t)\n", keyType, *dual)
+
+	// With dual certificates, <domain>.crt holds the RSA certificate
+	rsaKeyType, ecdsaKeyType := acme.DualKeyTypes(keyType)
+	if *dual {
+		keyType = rsaKeyType
+	}
+
 	// Create ACME manager
-	acmeManager := acme.NewManager(*apiURL, *challengeDir)
+	acmeManager := acme.NewManager(ca.DirectoryURL, *challengeDir)
+	acmeManager.SetCA(ca)
+	acmeManager.SetLogger(consoleLogger{})
+	acmeManager.SetAccountDir(filepath.Join(*sslDir, "accounts"))
+	if accountOperation {
+		if err := manageAccount(acmeManager, ca, *rolloverKey); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *fallbackCA != "" {
+		fallback, err := acme.CAFromEnv(*fallbackCA)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Fallback CA: %s (%s)\n", fallback.Name, fallback.DirectoryURL)
+		acmeManager.SetFallbackCA(fallback)
+	}
+	acmeManager.SetKeyType(keyType)
+	if *dnsProvider != "" {
+		if _, err := acme.NewDNSProvider(*dnsProvider); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("DNS Provider: %s\n", *dnsProvider)
+		acmeManager.SetDNSProvider(*dnsProvider)
+	}
+	if *tlsALPN {
+		fmt.Printf("TLS-ALPN-01 Responder: %s\n", *tlsALPNAddr)
+		acmeManager.SetTLSALPN(*tlsALPNAddr)
+	}
+
+	// Without --challenge, DNS-01 is used with a DNS provider, then TLS-ALPN-01
+	// when enabled, then HTTP-01
+	var challenge acme.ChallengeType
+	if *challengeArg != "" {
+		if challenge, err = acme.ParseChallengeType(*challengeArg); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	switch command {
+	case "renew":
+		if err := renewCertificates(acmeManager, *sslDir, args, *all, keyType, challenge); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case "revoke":
+		if err := revokeCertificates(acmeManager, *sslDir, args, reason); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Each certificate covers a group of names, the first naming the certificate
+	groups := make([][]string, 0, len(domains))
+	if *san {
+		groups = append(groups, domains)
+	} else {
+		for _, domain := range domains {
+			groups = append(groups, ssl.CertificateDomains(domain))
+		}
+	}
 
-	for _, domain := range domains {
+	for _, names := range groups {
+		domain := names[0]
 		fmt.Printf("\n=== Processing domain: %s ===\n", domain)
+		if len(names) > 1 {
+			fmt.Printf("Names: %v\n", names)
+		}
 
 		certPath := filepath.Join(*sslDir, "certs", domain+".crt")
 		keyPath := filepath.Join(*sslDir, "private", domain+".key")
-		accountKeyPath := filepath.Join(*sslDir, "accounts", domain+".account.key")
 
 		// Check if certificate already exists
 		if !*forceNew && !*force {
@@ -59,23 +219,35 @@ func main() {
 
 		// Obtain certificate
 		opts := ssl.CertificateOptions{
-			Domain:         domain,
-			SkipDNSCheck:   *skipDNSCheck,
-			ForceNew:       *forceNew,
-			Force:          *force,
-			CertPath:       certPath,
-			KeyPath:        keyPath,
-			AccountKeyPath: accountKeyPath,
+			Domain:       domain,
+			SkipDNSCheck: *skipDNSCheck,
+			ForceNew:     *forceNew,
+			Force:        *force,
+			CertPath:     certPath,
+			KeyPath:      keyPath,
 		}
 
-		if err := obtainCertificate(acmeManager, opts); err != nil {
+		issuer, err := obtainCertificate(acmeManager, keyType, challenge, names, opts)
+		if err != nil {
 			fmt.Printf("Failed to obtain certificate for %s: %v\n", domain, err)
 			continue
 		}
 
+		// The proxy renews and replaces the certificates it obtained, with the CA
+		// that issued them
+		if err := ssl.MarkManaged(*sslDir, domain, issuer.Name); err != nil {
+			fmt.Printf("Failed to mark certificate for %s as managed: %v\n", domain, err)
+		}
+
 		fmt.Printf("Successfully obtained certificate for %s\n", domain)
 		fmt.Printf("Certificate: %s\n", certPath)
 		fmt.Printf("Private Key: %s\n", keyPath)
+
+		if *dual {
+			if err := obtainECDSACertificate(acmeManager, ecdsaKeyType, challenge, names, opts, *sslDir, issuer.Name); err != nil {
+				fmt.Printf("Failed to obtain ECDSA certificate for %s: %v\n", domain, err)
+			}
+		}
 	}
 
 	// Clean up temporary config if created
@@ -87,26 +259,95 @@ func main() {
 	fmt.Println("\nCertificate management completed.")
 }
 
-func obtainCertificate(manager *acme.Manager, opts ssl.CertificateOptions) error {
+// obtainCertificate obtains the certificate of opts.Domain covering names and
+// returns the CA that issued it
+func obtainCertificate(manager *acme.Manager, keyType acme.KeyType, challenge acme.ChallengeType, names []string, opts ssl.CertificateOptions) (acme.CA, error) {
 	// Create directories if they don't exist
 	if err := os.MkdirAll(filepath.Dir(opts.CertPath), 0755); err != nil {
-		return fmt.Errorf("failed to create cert directory: %v", err)
+		return acme.CA{}, fmt.Errorf("failed to create cert directory: %v", err)
 	}
 	if err := os.MkdirAll(filepath.Dir(opts.KeyPath), 0755); err != nil {
-		return fmt.Errorf("failed to create key directory: %v", err)
-	}
-	if err := os.MkdirAll(filepath.Dir(opts.AccountKeyPath), 0755); err != nil {
-		return fmt.Errorf("failed to create account directory: %v", err)
+		return acme.CA{}, fmt.Errorf("failed to create key directory: %v", err)
 	}
 
 	// Obtain certificate
-	return manager.ObtainCertificate(opts.Domain, opts.CertPath, opts.KeyPath, opts.AccountKeyPath)
+	return manager.Obtain(acme.CertificateRequest{
+		Domains:        names,
+		CertPath:       opts.CertPath,
+		KeyPath:        opts.KeyPath,
+		AccountKeyPath: opts.AccountKeyPath,
+		KeyType:        keyType,
+		Challenge:      challenge,
+	})
+}
+
+// manageAccount rolls over the key of, or deactivates, the account of ca
+func manageAccount(manager *acme.Manager, ca acme.CA, rollover bool) error {
+	if rollover {
+		if err := manager.RolloverAccountKey(ca.Name); err != nil {
+			return err
+		}
+		fmt.Printf("Replaced the account key for %s\n", ca.Name)
+		return nil
+	}
+
+	if err := manager.DeactivateAccount(ca.Name); err != nil {
+		return err
+	}
+	fmt.Printf("Deactivated the account for %s\n", ca.Name)
+	return nil
+}
+
+// obtainECDSACertificate obtains the ECDSA certificate served alongside the
+// RSA certificate, in <domain>.ecdsa.crt, from the CA that issued the latter
+func obtainECDSACertificate(manager *acme.Manager, keyType acme.KeyType, challenge acme.ChallengeType, names []string, opts ssl.CertificateOptions, sslDir, ca string) error {
+	certPath := filepath.Join(sslDir, "certs", opts.Domain+ssl.ECDSASuffix+".crt")
+	keyPath := filepath.Join(sslDir, "private", opts.Domain+ssl.ECDSASuffix+".key")
+	if _, err := manager.Obtain(acme.CertificateRequest{
+		Domains:        names,
+		CertPath:       certPath,
+		KeyPath:        keyPath,
+		AccountKeyPath: opts.AccountKeyPath,
+		KeyType:        keyType,
+		Challenge:      challenge,
+		CA:             ca,
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("ECDSA Certificate: %s\n", certPath)
+	return nil
+}
+
+// getEnvDefault returns the value of an environment variable or a default
+func getEnvDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// consoleLogger prints the progress messages of ACME clients
+type consoleLogger struct{}
+
+func (consoleLogger) Info(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (consoleLogger) Warn(format string, args ...interface{}) {
+	fmt.Printf("Warning: "+format+"\n", args...)
 }
 
 func printUsage() {
 	fmt.Println("Usage: Obtain Let's Encrypt SSL certificate for a domain or multiple domains")
 	fmt.Println()
 	fmt.Println("       getssl [--options] <hostname1> [hostname2 hostname3 ...]")
+	fmt.Println("       getssl [--options] list|renew|revoke|prune [name ...]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("    list               Show all certificates with issuer, names, expiry and the hosts using them")
+	fmt.Println("    renew [--all|name] Renew managed certificates now, from the CA that issued them")
+	fmt.Println("    revoke name [--reason=REASON] Revoke certificates with the CA and remove them")
+	fmt.Println("    prune [--dry-run]  Remove certificates and keys no host uses")
 	fmt.Println()
 	fmt.Println("Available options:")
 	fmt.Println("    --skip-dns-check    Do not perform check if DNS points to this machine")
@@ -115,12 +356,42 @@ func printUsage() {
 	fmt.Println("    --api=URL          Specify ACME API URL (default: Let's Encrypt production)")
 	fmt.Println("    --ssl-dir=DIR      SSL certificate directory (default: /etc/ssl)")
 	fmt.Println("    --challenge-dir=DIR ACME challenge directory (default: /tmp/acme-challenges)")
+	fmt.Println("    --key-type=TYPE    Key type: rsa2048, rsa4096, ec256 or ec384 (default: rsa2048)")
+	fmt.Println("    --dns-provider=NAME Solve DNS-01 challenges with digitalocean or rfc2136")
+	fmt.Println("    --dual             Obtain an RSA certificate and an ECDSA certificate (<domain>.ecdsa.crt)")
+	fmt.Println("    --san              Obtain one certificate covering all hostnames, named after the first")
+	fmt.Println("    --tls-alpn         Answer TLS-ALPN-01 challenges on port 443, falling back to HTTP-01")
+	fmt.Println("    --tls-alpn-addr=ADDR Address of the TLS-ALPN-01 responder (default: 127.0.0.1:5001)")
+	fmt.Println("    --challenge=TYPE   Challenge type: http-01, tls-alpn-01 or dns-01")
+	fmt.Println("    --ca=NAME|URL      CA: letsencrypt, letsencrypt-staging, zerossl, google, google-staging or a directory URL")
+	fmt.Println("    --staging          Use the Let's Encrypt staging CA")
+	fmt.Println("    --fallback-ca=NAME|URL CA tried when issuance fails")
+	fmt.Println("    --email=ADDRESS    Contact address of the ACME account")
+	fmt.Println("    --eab-kid=ID       External Account Binding key ID")
+	fmt.Println("    --eab-hmac-key=KEY External Account Binding MAC key")
+	fmt.Println("    --rollover-account-key Replace the key of the ACME account of the CA")
+	fmt.Println("    --deactivate-account Deactivate the ACME account of the CA")
+	fmt.Println("    --all              renew: Renew all managed certificates")
+	fmt.Println("    --reason=REASON    revoke: unspecified, keyCompromise, affiliationChanged, superseded or cessationOfOperation")
+	fmt.Println("    --dry-run          prune: Only show the certificates that would be removed")
+	fmt.Println("    --nginx-conf=FILE  Generated nginx configuration (default: $NGINX_CONF_DIR/conf.d/default.conf)")
+	fmt.Println("    --stream-conf=FILE Generated nginx stream configuration (default: $NGINX_CONF_DIR/stream.d/default.conf)")
 	fmt.Println("    --help             Show this help message")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("    getssl example.com")
 	fmt.Println("    getssl --new example.com www.example.com")
+	fmt.Println("    getssl --san example.com www.example.com")
 	fmt.Println("    getssl --force --skip-dns-check test.example.com")
+	fmt.Println("    getssl --key-type=ec256 --dual example.com")
+	fmt.Println("    getssl --dns-provider=rfc2136 internal.example.com")
+	fmt.Println("    getssl --tls-alpn example.com")
+	fmt.Println("    getssl --ca=zerossl --eab-kid=KID --eab-hmac-key=KEY example.com")
+	fmt.Println("    getssl --rollover-account-key --ca=letsencrypt")
+	fmt.Println("    getssl list")
+	fmt.Println("    getssl renew --all")
+	fmt.Println("    getssl revoke example.com --reason=keyCompromise")
+	fmt.Println("    getssl prune --dry-run")
 }
 
 // dummyLogger is a simple logger implementation for the CLI tool
@@ -1,10 +1,7 @@
 #!/usr/bin/env sh
+# DH parameters are generated by nginx-proxy-go on startup (DHPARAM_SIZE)
 mkdir -p /etc/nginx/dhparam
 
-if ! openssl dhparam -in /etc/nginx/dhparam/dhparam.pem >/dev/null 2>&1; then
-  openssl dhparam -out /etc/nginx/dhparam/dhparam.pem ${DHPARAM_SIZE:-2048}
-fi
-
 nginx
 
 exec ./nginx-proxy-go 
\ No newline at end of file
@@ -68,7 +68,7 @@ func TestProcessVirtualHostsWithRealContainer(t *testing.T) {
 		}
 	}
 
-	result := processor.ProcessVirtualHosts(inspect, envMap, knownNetworks)
+	result := processor.ProcessVirtualHosts(inspect, envMap, knownNetworks, nil)
 	if len(result) == 0 {
 		t.Fatalf("expected processed hosts, got none")
 	}
@@ -0,0 +1,236 @@
+package acme
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Account is the stored state of an ACME account, kept next to its key
+type Account struct {
+	URL            string   `json:"url"`
+	Directory      string   `json:"directory"`
+	Contact        []string `json:"contact,omitempty"`
+	TermsOfService string   `json:"termsOfService,omitempty"` // Terms of service agreed to
+}
+
+var unsafeAccountDirChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// AccountPaths returns the key and state file of the account used with the
+// directory at directoryURL. Every CA directory has one account below dir.
+func AccountPaths(dir, directoryURL string) (keyPath, statePath string) {
+	id := directoryURL
+	if u, err := url.Parse(directoryURL); err == nil && u.Host != "" {
+		id = u.Host + u.Path
+	}
+	id = strings.Trim(unsafeAccountDirChars.ReplaceAllString(id, "_"), "_")
+	return filepath.Join(dir, id, "account.key"), filepath.Join(dir, id, "account.json")
+}
+
+// loadAccount reads the account state from path, returning nil when there is
+// none
+func loadAccount(path string) (*Account, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account: %v", err)
+	}
+
+	var account Account
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse account %s: %v", path, err)
+	}
+	return &account, nil
+}
+
+// saveAccount writes the account state to path
+func saveAccount(path string, account *Account) error {
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %v", err)
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// writeFileAtomic replaces path with data, so that readers never see a
+// partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// SetAccountFile stores the account state in path, so that the account is
+// reused instead of registered again
+func (a *ACMEv2) SetAccountFile(path string) {
+	a.accountFile = path
+}
+
+// contact returns the contact URLs of the account
+func (a *ACMEv2) contact() []string {
+	if a.email == "" {
+		return nil
+	}
+	return []string{"mailto:" + a.email}
+}
+
+// termsOfService returns the current terms of service of the CA
+func (a *ACMEv2) termsOfService() string {
+	meta, _ := a.directory["meta"].(map[string]interface{})
+	tos, _ := meta["termsOfService"].(string)
+	return tos
+}
+
+// useAccount continues with the stored account, updating its contact and
+// agreeing to changed terms of service. It returns false when the CA no
+// longer knows the account or it has been deactivated.
+func (a *ACMEv2) useAccount(account *Account) (bool, error) {
+	a.accountKid = account.URL
+
+	update := map[string]interface{}{}
+	if contact := a.contact(); !slices.Equal(contact, account.Contact) {
+		update["contact"] = contact
+		if contact == nil {
+			update["contact"] = []string{}
+		}
+	}
+	if tos := a.termsOfService(); tos != "" && tos != account.TermsOfService {
+		a.logger.Info("Agreeing to the updated terms of service of %s: %s", a.apiURL, tos)
+		update["termsOfServiceAgreed"] = true
+	}
+
+	resp, err := a.postSigned(account.URL, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to update account: %v", err)
+	}
+	if resp.code == http.StatusUnauthorized || resp.code == http.StatusForbidden {
+		body := string(resp.body)
+		if strings.Contains(body, "urn:ietf:params:acme:error:accountDoesNotExist") ||
+			strings.Contains(body, "urn:ietf:params:acme:error:unauthorized") {
+			return false, nil
+		}
+	}
+	if resp.code != http.StatusOK {
+		return false, fmt.Errorf("failed to update account: %d %s", resp.code, string(resp.body))
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	json.Unmarshal(resp.body, &status)
+	if status.Status != "" && status.Status != "valid" {
+		return false, nil
+	}
+
+	account.Contact = a.contact()
+	account.TermsOfService = a.termsOfService()
+	return true, a.saveAccount(account)
+}
+
+// saveAccount stores the account state when an account file is set
+func (a *ACMEv2) saveAccount(account *Account) error {
+	if a.accountFile == "" {
+		return nil
+	}
+	return saveAccount(a.accountFile, account)
+}
+
+// RolloverAccountKey replaces the account key with a newly generated one
+// (RFC 8555 section 7.3.5)
+func (a *ACMEv2) RolloverAccountKey() error {
+	if err := a.RegisterAccount(); err != nil {
+		return err
+	}
+	keyChangeURL, _ := a.directory["keyChange"].(string)
+	if keyChangeURL == "" {
+		return fmt.Errorf("the CA does not support account key rollover")
+	}
+
+	oldKey, err := a.loadAccountKey()
+	if err != nil {
+		return err
+	}
+	newKey, err := GenerateKey(KeyTypeRSA2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate account key: %v", err)
+	}
+	newRSAKey := newKey.(*rsa.PrivateKey)
+
+	// The inner JWS, signed by the new key, is the payload of the request
+	// signed by the old key
+	inner, err := a.signJWS(newRSAKey, map[string]interface{}{
+		"alg": "RS256",
+		"jwk": a.jwk(&newRSAKey.PublicKey),
+		"url": keyChangeURL,
+	}, map[string]interface{}{
+		"account": a.accountKid,
+		"oldKey":  a.jwk(&oldKey.PublicKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.postSigned(keyChangeURL, inner)
+	if err != nil {
+		return fmt.Errorf("failed to roll over account key: %v", err)
+	}
+	if resp.code != http.StatusOK {
+		return fmt.Errorf("failed to roll over account key: %d %s", resp.code, string(resp.body))
+	}
+
+	keyPEM, err := EncodePrivateKey(newKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode account key: %v", err)
+	}
+	return writeFileAtomic(a.accountKey, keyPEM, 0600)
+}
+
+// DeactivateAccount deactivates the stored account and removes its key and
+// state. The next certificate request registers a new account.
+func (a *ACMEv2) DeactivateAccount() error {
+	account, err := loadAccount(a.accountFile)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return fmt.Errorf("no account registered with %s", a.apiURL)
+	}
+	if err := a.fetchDirectory(); err != nil {
+		return err
+	}
+
+	a.accountKid = account.URL
+	resp, err := a.postSigned(account.URL, map[string]interface{}{"status": "deactivated"})
+	if err != nil {
+		return fmt.Errorf("failed to deactivate account: %v", err)
+	}
+	if resp.code != http.StatusOK {
+		return fmt.Errorf("failed to deactivate account: %d %s", resp.code, string(resp.body))
+	}
+
+	a.accountKid = ""
+	for _, path := range []string{a.accountFile, a.accountKey} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+	}
+	return nil
+}
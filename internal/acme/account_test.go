@@ -0,0 +1,156 @@
+package acme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountPaths(t *testing.T) {
+	keyPath, statePath := AccountPaths("/etc/ssl/accounts", "https://acme-v02.api.letsencrypt.org/directory")
+	assert.Equal(t, "/etc/ssl/accounts/acme-v02.api.letsencrypt.org_directory/account.key", keyPath)
+	assert.Equal(t, "/etc/ssl/accounts/acme-v02.api.letsencrypt.org_directory/account.json", statePath)
+
+	keyPath, _ = AccountPaths("/etc/ssl/accounts", "http://127.0.0.1:14000/dir")
+	assert.Equal(t, "/etc/ssl/accounts/127.0.0.1_14000_dir/account.key", keyPath)
+}
+
+// newTestAccountClient returns a client using the stored account in dir
+func newTestAccountClient(t *testing.T, server *testACMEServer, dir string) *ACMEv2 {
+	t.Helper()
+	keyPath, statePath := AccountPaths(dir, server.URL+"/directory")
+	a := NewACMEv2(server.URL+"/directory", keyPath, filepath.Join(t.TempDir(), "domain.key"),
+		filepath.Join(t.TempDir(), "cert.crt"), server.challengeDir, []string{"example.com"}, false, false, "")
+	a.SetAccountFile(statePath)
+	a.pollInterval = 10 * time.Millisecond
+	return a
+}
+
+func TestManagerSharesAccount(t *testing.T) {
+	challengeDir := t.TempDir()
+	server := newTestACMEServer(t, challengeDir, "")
+	server.issueAtOnce = true
+
+	dir := t.TempDir()
+	accountDir := filepath.Join(dir, "accounts")
+	m := NewManager(server.URL+"/directory", challengeDir)
+	m.SetAccountDir(accountDir)
+
+	for _, domain := range []string{"example.com", "example.org"} {
+		_, err := m.Obtain(CertificateRequest{
+			Domains:  []string{domain},
+			CertPath: filepath.Join(dir, domain+".crt"),
+			KeyPath:  filepath.Join(dir, domain+".key"),
+			KeyType:  KeyTypeEC256,
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, server.registered)
+	_, statePath := AccountPaths(accountDir, server.URL+"/directory")
+	account, err := loadAccount(statePath)
+	require.NoError(t, err)
+	require.NotNil(t, account)
+	assert.Equal(t, server.URL+"/acct/1", account.URL)
+	assert.Equal(t, server.URL+"/directory", account.Directory)
+}
+
+func TestRegisterAccountUpdatesStoredAccount(t *testing.T) {
+	server := newTestACMEServer(t, t.TempDir(), "")
+	server.terms = "https://example.com/terms-v1"
+	dir := t.TempDir()
+
+	a := newTestAccountClient(t, server, dir)
+	a.SetAccount("admin@example.com", "", "")
+	require.NoError(t, a.RegisterAccount())
+	assert.Equal(t, 1, server.registered)
+	assert.Equal(t, 0, server.agreed)
+
+	// A changed contact is updated on the existing account
+	a = newTestAccountClient(t, server, dir)
+	a.SetAccount("ops@example.com", "", "")
+	require.NoError(t, a.RegisterAccount())
+	assert.Equal(t, 1, server.registered)
+	assert.Equal(t, []interface{}{"mailto:ops@example.com"}, server.contact)
+	assert.Equal(t, 0, server.agreed)
+
+	// Changed terms of service are agreed to once
+	server.terms = "https://example.com/terms-v2"
+	log := &testLogger{}
+	for i := 0; i < 2; i++ {
+		a = newTestAccountClient(t, server, dir)
+		a.SetAccount("ops@example.com", "", "")
+		a.SetLogger(log)
+		require.NoError(t, a.RegisterAccount())
+	}
+	assert.Equal(t, 1, server.agreed)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "https://example.com/terms-v2")
+	assert.Equal(t, 1, server.registered)
+}
+
+func TestRolloverAccountKey(t *testing.T) {
+	server := newTestACMEServer(t, t.TempDir(), "")
+	dir := t.TempDir()
+
+	a := newTestAccountClient(t, server, dir)
+	require.NoError(t, a.RegisterAccount())
+	oldKey, err := os.ReadFile(a.accountKey)
+	require.NoError(t, err)
+	oldJWK := server.accounts[server.URL+"/acct/1"].jwk
+
+	require.NoError(t, a.RolloverAccountKey())
+	newKey, err := os.ReadFile(a.accountKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKey, newKey)
+	assert.NotEqual(t, oldJWK, server.accounts[server.URL+"/acct/1"].jwk)
+
+	// The account keeps issuing with the new key
+	a = newTestAccountClient(t, server, dir)
+	require.NoError(t, a.GetCertificate())
+	assert.Equal(t, 1, server.registered)
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	server := newTestACMEServer(t, t.TempDir(), "")
+	dir := t.TempDir()
+
+	a := newTestAccountClient(t, server, dir)
+	assert.Error(t, a.DeactivateAccount())
+	require.NoError(t, a.RegisterAccount())
+	require.NoError(t, a.DeactivateAccount())
+
+	assert.Equal(t, "deactivated", server.accounts[server.URL+"/acct/1"].status)
+	assert.NoFileExists(t, a.accountKey)
+	assert.NoFileExists(t, a.accountFile)
+
+	// The next request registers a new account
+	a = newTestAccountClient(t, server, dir)
+	require.NoError(t, a.RegisterAccount())
+	assert.Equal(t, 2, server.registered)
+}
+
+func TestRegisterAccountReplacesInvalidAccount(t *testing.T) {
+	server := newTestACMEServer(t, t.TempDir(), "")
+	dir := t.TempDir()
+
+	a := newTestAccountClient(t, server, dir)
+	require.NoError(t, a.RegisterAccount())
+	oldKey, err := os.ReadFile(a.accountKey)
+	require.NoError(t, err)
+
+	// Deactivated by the CA or through another client
+	server.accounts[server.URL+"/acct/1"].status = "deactivated"
+
+	a = newTestAccountClient(t, server, dir)
+	require.NoError(t, a.RegisterAccount())
+	assert.Equal(t, 2, server.registered)
+	assert.Equal(t, server.URL+"/acct/2", a.accountKid)
+	newKey, err := os.ReadFile(a.accountKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKey, newKey)
+}
@@ -12,10 +12,12 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -32,6 +34,12 @@ type ACME struct {
 	httpClient   *http.Client
 	directory    map[string]interface{}
 	accountKid   string
+	keyType      KeyType
+	logger       Logger
+	accountMu    *sync.Mutex   // Serializes registering a shared account, nil for an own account
+	pendingKey   string        // New domain key, moved into place with the certificate it was issued for
+	nonce        string        // Replay-Nonce of the last response, used by the next request
+	pollInterval time.Duration // Delay between polls of challenge and order status
 }
 
 // NewACME creates a new ACME client
@@ -46,35 +54,45 @@ func NewACME(apiURL, accountKey, domainKey, certPath, challengeDir string, domai
 		debug:        debug,
 		skipReload:   skipReload,
 		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		keyType:      DefaultKeyType,
+		logger:       nopLogger{},
+		pollInterval: 5 * time.Second,
 	}
 }
 
-// createKey creates a new RSA key and saves it to the specified path
-func (a *ACME) createKey(keyPath string) (crypto.PrivateKey, error) {
+// SetLogger sets the logger receiving the progress messages of the client
+func (a *ACME) SetLogger(logger Logger) {
+	a.logger = logger
+}
+
+// SetKeyType sets the key type used for new domain keys
+func (a *ACME) SetKeyType(kt KeyType) {
+	a.keyType = kt
+}
+
+// createKey loads the key at the specified path, or creates a new key of the
+// given type and saves it there
+func (a *ACME) createKey(keyPath string, kt KeyType) (crypto.Signer, error) {
 	// Check if key already exists
 	if _, err := os.Stat(keyPath); err == nil {
 		keyData, err := os.ReadFile(keyPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read existing key: %v", err)
 		}
-		block, _ := pem.Decode(keyData)
-		if block == nil {
-			return nil, fmt.Errorf("failed to decode PEM block")
-		}
-		return x509.ParsePKCS1PrivateKey(block.Bytes)
+		return ParsePrivateKey(keyData)
 	}
 
 	// Create new key
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	key, err := GenerateKey(kt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate key: %v", err)
 	}
 
 	// Save key to file
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
-	})
+	keyPEM, err := EncodePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %v", err)
+	}
 
 	if err := os.MkdirAll(filepath.Dir(keyPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %v", err)
@@ -87,19 +105,78 @@ func (a *ACME) createKey(keyPath string) (crypto.PrivateKey, error) {
 	return key, nil
 }
 
+// createDomainKey selects the domain key the certificate is requested for. An
+// existing key of the configured type is reused; otherwise a new key is created
+// next to it and only replaces it once the certificate has been saved, so a
+// failed order leaves the current key and certificate pair intact.
+func (a *ACME) createDomainKey() error {
+	a.discardPendingKey()
+	if keyData, err := os.ReadFile(a.domainKey); err == nil {
+		key, err := ParsePrivateKey(keyData)
+		if err == nil {
+			if kt, err := KeyTypeOf(key); err == nil && kt == a.keyType {
+				return nil
+			}
+		}
+	}
+
+	pendingKey := a.domainKey + ".new"
+	os.Remove(pendingKey)
+	if _, err := a.createKey(pendingKey, a.keyType); err != nil {
+		return err
+	}
+	a.pendingKey = pendingKey
+	return nil
+}
+
+// csrKeyPath returns the path of the key the certificate is requested for
+func (a *ACME) csrKeyPath() string {
+	if a.pendingKey != "" {
+		return a.pendingKey
+	}
+	return a.domainKey
+}
+
+// discardPendingKey removes a new domain key whose certificate was not issued
+func (a *ACME) discardPendingKey() {
+	if a.pendingKey != "" {
+		os.Remove(a.pendingKey)
+		a.pendingKey = ""
+	}
+}
+
+// saveCertificate writes the certificate and moves a new domain key into place
+// with it. Both are written next to their destination first, so the key is
+// only replaced once the certificate issued for it is on disk.
+func (a *ACME) saveCertificate(certPEM []byte) error {
+	tmpCert := a.certPath + ".new"
+	if err := os.WriteFile(tmpCert, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to save certificate: %v", err)
+	}
+
+	if a.pendingKey != "" {
+		if err := os.Rename(a.pendingKey, a.domainKey); err != nil {
+			os.Remove(tmpCert)
+			return fmt.Errorf("failed to replace domain key: %v", err)
+		}
+		a.pendingKey = ""
+	}
+
+	if err := os.Rename(tmpCert, a.certPath); err != nil {
+		os.Remove(tmpCert)
+		return fmt.Errorf("failed to save certificate: %v", err)
+	}
+	return nil
+}
+
 // createCSR creates a Certificate Signing Request
 func (a *ACME) createCSR() ([]byte, error) {
-	keyData, err := os.ReadFile(a.domainKey)
+	keyData, err := os.ReadFile(a.csrKeyPath())
 	if err != nil {
 		return nil, fmt.Errorf("failed to read domain key: %v", err)
 	}
 
-	block, _ := pem.Decode(keyData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block")
-	}
-
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	key, err := ParsePrivateKey(keyData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse private key: %v", err)
 	}
@@ -126,6 +203,21 @@ func (a *ACME) b64(data []byte) string {
 
 // jws creates a JSON Web Signature header
 func (a *ACME) jws() (map[string]interface{}, error) {
+	key, err := a.loadAccountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]interface{}{
+		"alg": "RS256",
+		"jwk": a.jwk(&key.PublicKey),
+	}
+
+	return header, nil
+}
+
+// loadAccountKey reads the RSA account key
+func (a *ACME) loadAccountKey() (*rsa.PrivateKey, error) {
 	keyData, err := os.ReadFile(a.accountKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read account key: %v", err)
@@ -140,24 +232,43 @@ func (a *ACME) jws() (map[string]interface{}, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse private key: %v", err)
 	}
+	return key, nil
+}
 
-	// Get public key components
-	publicKey := key.Public().(*rsa.PublicKey)
-	exponent := fmt.Sprintf("%x", publicKey.E)
-	if len(exponent)%2 == 1 {
-		exponent = "0" + exponent
+// jwk returns the JSON Web Key of an RSA public key, its components encoded as
+// unsigned big-endian integers
+func (a *ACME) jwk(publicKey *rsa.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"e":   a.b64(big.NewInt(int64(publicKey.E)).Bytes()),
+		"kty": "RSA",
+		"n":   a.b64(publicKey.N.Bytes()),
 	}
+}
 
-	header := map[string]interface{}{
-		"alg": "RS256",
-		"jwk": map[string]interface{}{
-			"e":   a.b64([]byte(exponent)),
-			"kty": "RSA",
-			"n":   a.b64(publicKey.N.Bytes()),
-		},
+// signJWS signs payload with key as a flattened JWS. A nil payload is signed
+// as the empty string used by POST-as-GET requests.
+func (a *ACME) signJWS(key *rsa.PrivateKey, protected map[string]interface{}, payload interface{}) (map[string]interface{}, error) {
+	payloadB64 := ""
+	if payload != nil {
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %v", err)
+		}
+		payloadB64 = a.b64(payloadJSON)
 	}
+	protectedB64 := a.b64([]byte(mustMarshalJSON(protected)))
 
-	return header, nil
+	hash := sha256.Sum256([]byte(protectedB64 + "." + payloadB64))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request: %v", err)
+	}
+
+	return map[string]interface{}{
+		"protected": protectedB64,
+		"payload":   payloadB64,
+		"signature": a.b64(signature),
+	}, nil
 }
 
 // thumbprint calculates the account key thumbprint
@@ -193,14 +304,43 @@ func (a *ACME) cleanup(files []string) {
 	}
 }
 
-// sendSignedRequest sends a signed request to the ACME server
+// signedResponse is the response to a signed request
+type signedResponse struct {
+	code     int
+	body     []byte
+	location string
+}
+
+// sendSignedRequest sends a signed request to the ACME server. A nil payload
+// sends a POST-as-GET request, used to fetch resources.
 func (a *ACME) sendSignedRequest(url string, payload interface{}) (int, []byte, error) {
-	payloadJSON, err := json.Marshal(payload)
+	resp, err := a.postSigned(url, payload)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to marshal payload: %v", err)
+		return 0, nil, err
+	}
+	return resp.code, resp.body, nil
+}
+
+// postSigned sends a signed request and returns the response with its Location
+// header. A request rejected for a bad nonce is retried once with a fresh nonce.
+func (a *ACME) postSigned(url string, payload interface{}) (*signedResponse, error) {
+	resp, err := a.postSignedOnce(url, payload)
+	if err != nil {
+		return nil, err
+	}
+	if resp.code == http.StatusBadRequest && strings.Contains(string(resp.body), "urn:ietf:params:acme:error:badNonce") {
+		return a.postSignedOnce(url, payload)
+	}
+	return resp, nil
+}
+
+// postSignedOnce sends a single signed request
+func (a *ACME) postSignedOnce(url string, payload interface{}) (*signedResponse, error) {
+	key, err := a.loadAccountKey()
+	if err != nil {
+		return nil, err
 	}
 
-	payloadB64 := a.b64(payloadJSON)
 	protected := map[string]interface{}{
 		"alg": "RS256",
 		"url": url,
@@ -209,74 +349,75 @@ func (a *ACME) sendSignedRequest(url string, payload interface{}) (int, []byte,
 	if a.accountKid != "" {
 		protected["kid"] = a.accountKid
 	} else {
-		jws, err := a.jws()
-		if err != nil {
-			return 0, nil, err
-		}
-		protected["jwk"] = jws["jwk"]
-	}
-
-	// Get nonce
-	req, err := http.NewRequest("HEAD", a.apiURL+"/directory", nil)
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to create request: %v", err)
+		protected["jwk"] = a.jwk(&key.PublicKey)
 	}
-	req.Header.Set("Content-Type", "application/jose+json")
 
-	resp, err := a.httpClient.Do(req)
+	nonce, err := a.getNonce()
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to get nonce: %v", err)
+		return nil, err
 	}
-	resp.Body.Close()
-
-	protected["nonce"] = resp.Header.Get("Replay-Nonce")
-	protectedB64 := a.b64([]byte(mustMarshalJSON(protected)))
+	protected["nonce"] = nonce
 
 	// Sign the request
-	keyData, err := os.ReadFile(a.accountKey)
+	request, err := a.signJWS(key, protected, payload)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to read account key: %v", err)
+		return nil, err
 	}
 
-	block, _ := pem.Decode(keyData)
-	if block == nil {
-		return 0, nil, fmt.Errorf("failed to decode PEM block")
+	req, err := http.NewRequest("POST", url, strings.NewReader(mustMarshalJSON(request)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
+	req.Header.Set("Content-Type", "application/jose+json")
 
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	resp, err := a.httpClient.Do(req)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to parse private key: %v", err)
+		return nil, fmt.Errorf("failed to send request: %v", err)
 	}
+	defer resp.Body.Close()
+	a.nonce = resp.Header.Get("Replay-Nonce")
 
-	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, []byte(protectedB64+"."+payloadB64))
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to sign request: %v", err)
+		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	request := map[string]interface{}{
-		"protected": protectedB64,
-		"payload":   payloadB64,
-		"signature": a.b64(signature),
+	return &signedResponse{
+		code:     resp.StatusCode,
+		body:     body,
+		location: resp.Header.Get("Location"),
+	}, nil
+}
+
+// getNonce returns the nonce of the last response, or fetches a new one
+func (a *ACME) getNonce() (string, error) {
+	if a.nonce != "" {
+		nonce := a.nonce
+		a.nonce = ""
+		return nonce, nil
 	}
 
-	req, err = http.NewRequest("POST", url, strings.NewReader(mustMarshalJSON(request)))
-	if err != nil {
-		return 0, nil, fmt.Errorf("failed to create request: %v", err)
+	nonceURL, _ := a.directory["newNonce"].(string)
+	if nonceURL == "" {
+		return "", fmt.Errorf("failed to get nonce: directory has no newNonce URL")
 	}
-	req.Header.Set("Content-Type", "application/jose+json")
 
-	resp, err = a.httpClient.Do(req)
+	req, err := http.NewRequest("HEAD", nonceURL, nil)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to send request: %v", err)
+		return "", fmt.Errorf("failed to create request: %v", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	resp, err := a.httpClient.Do(req)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to read response: %v", err)
+		return "", fmt.Errorf("failed to get nonce: %v", err)
 	}
+	resp.Body.Close()
 
-	return resp.StatusCode, body, nil
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("failed to get nonce: no Replay-Nonce header")
+	}
+	return nonce, nil
 }
 
 // mustMarshalJSON is a helper function that panics if JSON marshaling fails
@@ -0,0 +1,693 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testACMEServer is a minimal RFC 8555 server validating http-01 challenges
+// from the challenge directory and tls-alpn-01 challenges by dialing the
+// responder
+type testACMEServer struct {
+	*httptest.Server
+	t            *testing.T
+	challengeDir string
+	tlsALPNAddr  string
+	offerTLSALPN bool
+	eabKeyID     string // Requires External Account Binding with this key ID
+	eabHMACKey   []byte
+	issueAtOnce  bool              // Finalize returns a valid order instead of a processing one
+	terms        string            // Terms of service announced in the directory
+	renewalInfo  map[string]string // Suggested renewal window by ARI certificate ID, as JSON
+	revoked      map[string]int    // Revocation reason by certificate serial
+
+	mu         sync.Mutex
+	nonces     map[string]bool
+	nextNonce  int
+	thumbprint string
+	authzs     map[string]*testAuthz
+	validated  []string // Challenge types validated, in order
+	csrNames   []string
+	caKey      *ecdsa.PrivateKey
+	caCert     *x509.Certificate
+	orderReady bool
+	contact    []interface{}
+	accounts   map[string]*testAccount // By account URL
+	registered int                     // Accounts created
+	agreed     int                     // Terms of service agreements to existing accounts
+}
+
+type testAccount struct {
+	jwk     string
+	status  string
+	contact []interface{}
+}
+
+type testAuthz struct {
+	domain string
+	status string
+	token  string
+}
+
+func newTestACMEServer(t *testing.T, challengeDir, tlsALPNAddr string) *testACMEServer {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	s := &testACMEServer{
+		t:            t,
+		challengeDir: challengeDir,
+		tlsALPNAddr:  tlsALPNAddr,
+		offerTLSALPN: true,
+		nonces:       make(map[string]bool),
+		authzs:       make(map[string]*testAuthz),
+		revoked:      make(map[string]int),
+		accounts:     make(map[string]*testAccount),
+		caKey:        caKey,
+		caCert:       caCert,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testACMEServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextNonce++
+	nonce := fmt.Sprintf("nonce-%d", s.nextNonce)
+	s.nonces[nonce] = true
+	w.Header().Set("Replay-Nonce", nonce)
+
+	if r.URL.Path == "/directory" {
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"newNonce":    s.URL + "/nonce",
+			"newAccount":  s.URL + "/account",
+			"newOrder":    s.URL + "/order",
+			"keyChange":   s.URL + "/key-change",
+			"revokeCert":  s.URL + "/revoke-cert",
+			"renewalInfo": s.URL + "/renewal-info",
+			"meta": map[string]interface{}{
+				"externalAccountRequired": s.eabKeyID != "",
+				"termsOfService":          s.terms,
+			},
+		})
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/renewal-info/") {
+		window, ok := s.renewalInfo[strings.TrimPrefix(r.URL.Path, "/renewal-info/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", "21600")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(window))
+		return
+	}
+
+	protected, payload, err := s.parseJWS(r)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:malformed", "detail": err.Error()})
+		return
+	}
+	nonceValue, _ := protected["nonce"].(string)
+	if !s.nonces[nonceValue] {
+		s.writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:badNonce"})
+		return
+	}
+	delete(s.nonces, nonceValue)
+	if protected["url"] != s.URL+r.URL.Path {
+		s.writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:unauthorized", "detail": "url mismatch"})
+		return
+	}
+
+	if r.URL.Path == "/account" {
+		jwk, _ := json.Marshal(protected["jwk"])
+		var account struct {
+			Contact []interface{}     `json:"contact"`
+			Binding map[string]string `json:"externalAccountBinding"`
+		}
+		json.Unmarshal(payload, &account)
+		if err := s.verifyBinding(account.Binding, jwk); err != nil {
+			s.writeJSON(w, http.StatusUnauthorized, map[string]string{"type": "urn:ietf:params:acme:error:externalAccountRequired", "detail": err.Error()})
+			return
+		}
+		// A registered key returns its account
+		for accountURL, existing := range s.accounts {
+			if existing.jwk != string(jwk) {
+				continue
+			}
+			if existing.status != "valid" {
+				s.writeJSON(w, http.StatusUnauthorized, map[string]string{"type": "urn:ietf:params:acme:error:unauthorized"})
+				return
+			}
+			w.Header().Set("Location", accountURL)
+			s.writeJSON(w, http.StatusOK, map[string]string{"status": "valid"})
+			return
+		}
+		s.contact = account.Contact
+		s.registered++
+		accountURL := fmt.Sprintf("%s/acct/%d", s.URL, s.registered)
+		s.accounts[accountURL] = &testAccount{jwk: string(jwk), status: "valid", contact: account.Contact}
+		w.Header().Set("Location", accountURL)
+		s.writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+		return
+	}
+	kid, _ := protected["kid"].(string)
+	account := s.accounts[kid]
+	if account == nil {
+		s.writeJSON(w, http.StatusUnauthorized, map[string]string{"type": "urn:ietf:params:acme:error:accountDoesNotExist"})
+		return
+	}
+	if account.status != "valid" {
+		s.writeJSON(w, http.StatusUnauthorized, map[string]string{"type": "urn:ietf:params:acme:error:unauthorized"})
+		return
+	}
+	digest := sha256.Sum256([]byte(account.jwk))
+	s.thumbprint = base64.RawURLEncoding.EncodeToString(digest[:])
+
+	switch {
+	case r.URL.Path == "/key-change":
+		if err := s.changeKey(account, kid, payload); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:malformed", "detail": err.Error()})
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]string{"status": account.status})
+	case strings.HasPrefix(r.URL.Path, "/acct/"):
+		if s.URL+r.URL.Path != kid {
+			s.writeJSON(w, http.StatusUnauthorized, map[string]string{"type": "urn:ietf:params:acme:error:unauthorized"})
+			return
+		}
+		var update struct {
+			Contact []interface{} `json:"contact"`
+			Status  string        `json:"status"`
+			Agreed  bool          `json:"termsOfServiceAgreed"`
+		}
+		json.Unmarshal(payload, &update)
+		if update.Contact != nil {
+			account.contact = update.Contact
+			s.contact = update.Contact
+		}
+		if update.Status == "deactivated" {
+			account.status = update.Status
+		}
+		if update.Agreed {
+			s.agreed++
+		}
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{"status": account.status, "contact": account.contact})
+	case r.URL.Path == "/order":
+		var req struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		json.Unmarshal(payload, &req)
+		s.authzs = make(map[string]*testAuthz)
+		s.orderReady = false
+		for _, id := range req.Identifiers {
+			s.authzs[id.Value] = &testAuthz{domain: id.Value, status: "pending", token: fmt.Sprintf("token-%d", s.nextNonce)}
+		}
+		w.Header().Set("Location", s.URL+"/order/1")
+		s.writeJSON(w, http.StatusCreated, s.order("pending"))
+	case r.URL.Path == "/order/1":
+		// The certificate is issued after one poll in status processing
+		status := "processing"
+		if s.orderReady {
+			status = "valid"
+		}
+		s.orderReady = true
+		s.writeJSON(w, http.StatusOK, s.order(status))
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		s.writeJSON(w, http.StatusOK, s.authz(s.authzs[strings.TrimPrefix(r.URL.Path, "/authz/")]))
+	case strings.HasPrefix(r.URL.Path, "/chal/"):
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/chal/"), "/")
+		authz := s.authzs[parts[0]]
+		if string(payload) == "{}" && authz.status == "pending" {
+			s.validate(authz, ChallengeType(parts[1]))
+		}
+		s.writeJSON(w, http.StatusOK, map[string]string{"type": parts[1], "status": authz.status})
+	case r.URL.Path == "/finalize":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(s.t, err)
+		s.csrNames = csr.DNSNames
+		if s.issueAtOnce {
+			s.writeJSON(w, http.StatusOK, s.order("valid"))
+			return
+		}
+		s.writeJSON(w, http.StatusOK, s.order("processing"))
+	case r.URL.Path == "/cert":
+		s.issue(w)
+	case r.URL.Path == "/revoke-cert":
+		var req struct {
+			Certificate string `json:"certificate"`
+			Reason      int    `json:"reason"`
+		}
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.Certificate)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:malformed", "detail": err.Error()})
+			return
+		}
+		serial := cert.SerialNumber.String()
+		if _, ok := s.revoked[serial]; ok {
+			s.writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:alreadyRevoked"})
+			return
+		}
+		s.revoked[serial] = req.Reason
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// changeKey replaces the key of account with the key of the inner JWS of a
+// key change request
+func (s *testACMEServer) changeKey(account *testAccount, kid string, payload []byte) error {
+	innerReq := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(payload)))
+	innerProtected, innerPayload, err := s.parseJWS(innerReq)
+	if err != nil {
+		return err
+	}
+	if innerProtected["url"] != s.URL+"/key-change" {
+		return fmt.Errorf("inner JWS url mismatch")
+	}
+	var change struct {
+		Account string          `json:"account"`
+		OldKey  json.RawMessage `json:"oldKey"`
+	}
+	if err := json.Unmarshal(innerPayload, &change); err != nil {
+		return err
+	}
+	oldKey, _ := json.Marshal(json.RawMessage(change.OldKey))
+	if change.Account != kid || string(oldKey) != account.jwk {
+		return fmt.Errorf("key change does not match the account")
+	}
+	newKey, _ := json.Marshal(innerProtected["jwk"])
+	account.jwk = string(newKey)
+	return nil
+}
+
+// verifyBinding checks the External Account Binding of a new account
+func (s *testACMEServer) verifyBinding(binding map[string]string, jwk []byte) error {
+	if s.eabKeyID == "" {
+		return nil
+	}
+	if binding == nil {
+		return fmt.Errorf("external account binding required")
+	}
+	protectedJSON, _ := base64.RawURLEncoding.DecodeString(binding["protected"])
+	var protected map[string]string
+	json.Unmarshal(protectedJSON, &protected)
+	if protected["alg"] != "HS256" || protected["kid"] != s.eabKeyID || protected["url"] != s.URL+"/account" {
+		return fmt.Errorf("unexpected binding header %s", protectedJSON)
+	}
+	if payload, _ := base64.RawURLEncoding.DecodeString(binding["payload"]); string(payload) != string(jwk) {
+		return fmt.Errorf("binding does not hold the account key")
+	}
+	mac := hmac.New(sha256.New, s.eabHMACKey)
+	mac.Write([]byte(binding["protected"] + "." + binding["payload"]))
+	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != binding["signature"] {
+		return fmt.Errorf("invalid binding signature")
+	}
+	return nil
+}
+
+// parseJWS decodes the protected header and payload of a flattened JWS
+func (s *testACMEServer) parseJWS(r *http.Request) (map[string]interface{}, []byte, error) {
+	var jws struct{ Protected, Payload string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, nil, err
+	}
+	protectedJSON, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	var protected map[string]interface{}
+	if err := json.Unmarshal(protectedJSON, &protected); err != nil {
+		return nil, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return protected, payload, err
+}
+
+func (s *testACMEServer) order(status string) map[string]interface{} {
+	var authzURLs []string
+	for domain := range s.authzs {
+		authzURLs = append(authzURLs, s.URL+"/authz/"+domain)
+	}
+	order := map[string]interface{}{
+		"status":         status,
+		"authorizations": authzURLs,
+		"finalize":       s.URL + "/finalize",
+	}
+	if status == "valid" {
+		order["certificate"] = s.URL + "/cert"
+	}
+	return order
+}
+
+func (s *testACMEServer) authz(authz *testAuthz) map[string]interface{} {
+	challenges := []map[string]string{
+		{"type": "http-01", "url": s.URL + "/chal/" + authz.domain + "/http-01", "token": authz.token},
+	}
+	if s.offerTLSALPN {
+		challenges = append(challenges, map[string]string{
+			"type": "tls-alpn-01", "url": s.URL + "/chal/" + authz.domain + "/tls-alpn-01", "token": authz.token,
+		})
+	}
+	return map[string]interface{}{
+		"status":     authz.status,
+		"identifier": map[string]string{"type": "dns", "value": authz.domain},
+		"challenges": challenges,
+	}
+}
+
+// validate checks a challenge the way a CA would
+func (s *testACMEServer) validate(authz *testAuthz, challenge ChallengeType) {
+	keyAuth := authz.token + "." + s.thumbprint
+	var err error
+	switch challenge {
+	case ChallengeHTTP01:
+		var data []byte
+		data, err = os.ReadFile(filepath.Join(s.challengeDir, authz.token))
+		if err == nil && string(data) != keyAuth {
+			err = fmt.Errorf("unexpected key authorization %q", data)
+		}
+	case ChallengeTLSALPN01:
+		err = verifyTLSALPN(s.tlsALPNAddr, authz.domain, keyAuth)
+	}
+
+	authz.status = "valid"
+	if err != nil {
+		authz.status = "invalid"
+	}
+	s.validated = append(s.validated, string(challenge))
+}
+
+// issue returns a certificate for the names of the last CSR
+func (s *testACMEServer) issue(w http.ResponseWriter) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(s.t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: s.csrNames[0]},
+		DNSNames:     s.csrNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.caCert, &key.PublicKey, s.caKey)
+	require.NoError(s.t, err)
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func (s *testACMEServer) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// verifyTLSALPN connects to a TLS-ALPN-01 responder like a CA and checks the
+// certificate it presents for domain
+func verifyTLSALPN(addr, domain, keyAuth string) error {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		ServerName:         domain,
+		NextProtos:         []string{ACMETLS1Protocol},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != ACMETLS1Protocol {
+		return fmt.Errorf("negotiated %q", state.NegotiatedProtocol)
+	}
+	cert := state.PeerCertificates[0]
+	if err := cert.VerifyHostname(domain); err != nil {
+		return err
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idPeACMEIdentifier) {
+			continue
+		}
+		var digest []byte
+		if _, err := asn1.Unmarshal(ext.Value, &digest); err != nil {
+			return err
+		}
+		want := sha256.Sum256([]byte(keyAuth))
+		if !ext.Critical || string(digest) != string(want[:]) {
+			return fmt.Errorf("acmeIdentifier does not match the key authorization")
+		}
+		return nil
+	}
+	return fmt.Errorf("no acmeIdentifier extension")
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func newTestACMEClient(t *testing.T, server *testACMEServer, challengeDir string, domains ...string) (*ACMEv2, string) {
+	t.Helper()
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.crt")
+	a := NewACMEv2(server.URL+"/directory", filepath.Join(dir, "account.key"), filepath.Join(dir, "domain.key"),
+		certPath, challengeDir, domains, false, false, "")
+	a.pollInterval = 10 * time.Millisecond
+	return a, certPath
+}
+
+// testLogger records the messages logged by ACME clients
+type testLogger struct {
+	messages []string
+}
+
+func (l *testLogger) Info(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Warn(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func readTestCertificate(t *testing.T, certPath string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(certPath)
+	require.NoError(t, err)
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestGetCertificateTLSALPN(t *testing.T) {
+	challengeDir := t.TempDir()
+	addr := freeAddr(t)
+	server := newTestACMEServer(t, challengeDir, addr)
+
+	a, certPath := newTestACMEClient(t, server, challengeDir, "example.com", "www.example.com")
+	a.SetChallenge(ChallengeTLSALPN01, addr)
+	require.NoError(t, a.GetCertificate())
+
+	assert.Equal(t, []string{"tls-alpn-01", "tls-alpn-01"}, server.validated)
+	assert.ElementsMatch(t, []string{"example.com", "www.example.com"}, readTestCertificate(t, certPath).DNSNames)
+
+	// The responder only listens while the order is validated
+	_, err := net.DialTimeout("tcp", addr, time.Second)
+	assert.Error(t, err)
+}
+
+func TestGetCertificateFallsBackToHTTP01(t *testing.T) {
+	challengeDir := t.TempDir()
+	addr := freeAddr(t)
+	server := newTestACMEServer(t, challengeDir, addr)
+	server.offerTLSALPN = false
+
+	a, certPath := newTestACMEClient(t, server, challengeDir, "example.com")
+	a.SetChallenge(ChallengeTLSALPN01, addr)
+	log := &testLogger{}
+	a.SetLogger(log)
+	require.NoError(t, a.GetCertificate())
+
+	assert.Equal(t, []string{"http-01"}, server.validated)
+	assert.Equal(t, []string{"example.com"}, readTestCertificate(t, certPath).DNSNames)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "falling back to HTTP-01")
+}
+
+func TestGetCertificateHTTP01(t *testing.T) {
+	challengeDir := t.TempDir()
+	server := newTestACMEServer(t, challengeDir, "")
+
+	a, certPath := newTestACMEClient(t, server, challengeDir, "example.com")
+	require.NoError(t, a.GetCertificate())
+
+	assert.Equal(t, []string{"http-01"}, server.validated)
+	assert.Equal(t, []string{"example.com"}, readTestCertificate(t, certPath).DNSNames)
+
+	// Challenge files are removed after validation
+	entries, err := os.ReadDir(challengeDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRegisterAccountExternalBinding(t *testing.T) {
+	challengeDir := t.TempDir()
+	server := newTestACMEServer(t, challengeDir, "")
+	server.eabKeyID = "kid-1"
+	server.eabHMACKey = []byte("0123456789abcdef0123456789abcdef")
+
+	// Without credentials the client reports that the CA requires them
+	a, _ := newTestACMEClient(t, server, challengeDir, "example.com")
+	assert.ErrorContains(t, a.RegisterAccount(), "External Account Binding")
+
+	a, _ = newTestACMEClient(t, server, challengeDir, "example.com")
+	a.SetAccount("admin@example.com", "kid-1", base64.RawURLEncoding.EncodeToString([]byte("wrong-key")))
+	assert.Error(t, a.RegisterAccount())
+
+	a.SetAccount("admin@example.com", "kid-1", base64.URLEncoding.EncodeToString(server.eabHMACKey))
+	require.NoError(t, a.RegisterAccount())
+	assert.Equal(t, []interface{}{"mailto:admin@example.com"}, server.contact)
+}
+
+func TestManagerFallbackCA(t *testing.T) {
+	challengeDir := t.TempDir()
+	fallback := newTestACMEServer(t, challengeDir, "")
+	fallback.issueAtOnce = true // The manager polls at its default interval
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	dir := t.TempDir()
+	req := CertificateRequest{
+		Domains:        []string{"example.com"},
+		CertPath:       filepath.Join(dir, "example.com.crt"),
+		KeyPath:        filepath.Join(dir, "example.com.key"),
+		AccountKeyPath: filepath.Join(dir, "example.com.account.key"),
+		KeyType:        KeyTypeEC256,
+	}
+
+	m := NewManager(primary.URL, challengeDir)
+	log := &testLogger{}
+	m.SetLogger(log)
+	_, err := m.Obtain(req)
+	assert.Error(t, err)
+
+	m.SetFallbackCA(CA{Name: "fallback", DirectoryURL: fallback.URL + "/directory"})
+	ca, err := m.Obtain(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, readTestCertificate(t, req.CertPath).DNSNames)
+
+	// The fallback CA issued the certificate and is found by its name
+	assert.Equal(t, "fallback", ca.Name)
+	resolved, err := m.resolveCA(ca.Name)
+	require.NoError(t, err)
+	assert.Equal(t, fallback.URL+"/directory", resolved.DirectoryURL)
+	require.NotEmpty(t, log.messages)
+	assert.Contains(t, log.messages[0], "trying fallback")
+}
+
+func TestManagerObtainDoesNotBlock(t *testing.T) {
+	// A CA that answers only once released
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer slow.Close()
+	var releaseOnce sync.Once
+	defer releaseOnce.Do(func() { close(release) })
+
+	t.Setenv("ACME_ALLOW_HTTP", "true") // The test CA is requested by URL
+	challengeDir := t.TempDir()
+	server := newTestACMEServer(t, challengeDir, "")
+	server.issueAtOnce = true
+	m := NewManager(slow.URL, challengeDir)
+	m.SetAccountDir(t.TempDir())
+
+	dir := t.TempDir()
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Obtain(CertificateRequest{
+			Domains:  []string{"slow.example.com"},
+			CertPath: filepath.Join(dir, "slow.example.com.crt"),
+			KeyPath:  filepath.Join(dir, "slow.example.com.key"),
+			KeyType:  KeyTypeEC256,
+		})
+		done <- err
+	}()
+
+	// Settings and requests to other CAs go on while the slow CA is waited for
+	m.SetKeyType(KeyTypeRSA2048)
+	ca, err := m.Obtain(CertificateRequest{
+		Domains:  []string{"example.com"},
+		CertPath: filepath.Join(dir, "example.com.crt"),
+		KeyPath:  filepath.Join(dir, "example.com.key"),
+		KeyType:  KeyTypeEC256,
+		CA:       server.URL + "/directory",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/directory", ca.DirectoryURL)
+
+	select {
+	case <-done:
+		t.Fatal("request to the slow CA completed before it answered")
+	default:
+	}
+	releaseOnce.Do(func() { close(release) })
+	assert.Error(t, <-done)
+}
@@ -1,6 +1,9 @@
 package acme
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,24 +19,90 @@ import (
 type ACMEv2 struct {
 	*ACME
 	dnsProvider string
+	propagation PropagationConfig
+	challenge   ChallengeType
+	tlsALPNAddr string // Address the TLS-ALPN-01 responder listens on
+	email       string
+	eabKeyID    string
+	eabHMACKey  string
+	accountFile string // Stored account state, empty to register on every request
 }
 
-// NewACMEv2 creates a new ACME v2 client
+// NewACMEv2 creates a new ACME v2 client. It solves DNS-01 challenges when a
+// DNS provider is given and HTTP-01 challenges otherwise.
 func NewACMEv2(apiURL, accountKey, domainKey, certPath, challengeDir string, domains []string, debug, skipReload bool, dnsProvider string) *ACMEv2 {
+	challenge := ChallengeHTTP01
+	if dnsProvider != "" {
+		challenge = ChallengeDNS01
+	}
 	return &ACMEv2{
 		ACME:        NewACME(apiURL, accountKey, domainKey, certPath, challengeDir, domains, debug, skipReload),
 		dnsProvider: dnsProvider,
+		propagation: PropagationConfigFromEnv(),
+		challenge:   challenge,
 	}
 }
 
-// RegisterAccount registers a new account with the ACME server
+// SetChallenge selects the challenge type. TLS-ALPN-01 challenges are answered
+// on tlsALPNAddr and fall back to HTTP-01 when they fail.
+func (a *ACMEv2) SetChallenge(challenge ChallengeType, tlsALPNAddr string) {
+	a.challenge = challenge
+	a.tlsALPNAddr = tlsALPNAddr
+}
+
+// SetAccount sets the contact address of the account and the External Account
+// Binding credentials required by CAs such as ZeroSSL and Google Trust Services
+func (a *ACMEv2) SetAccount(email, eabKeyID, eabHMACKey string) {
+	a.email = email
+	a.eabKeyID = eabKeyID
+	a.eabHMACKey = eabHMACKey
+}
+
+// RegisterAccount registers a new account with the ACME server. With an
+// account file set, the stored account is reused, and registered again with a
+// new key when the CA no longer knows it.
 func (a *ACMEv2) RegisterAccount() error {
+	if a.accountMu != nil {
+		a.accountMu.Lock()
+		defer a.accountMu.Unlock()
+	}
+
 	// Create account key if it doesn't exist
-	if _, err := a.createKey(a.accountKey); err != nil {
+	if _, err := a.createKey(a.accountKey, KeyTypeRSA2048); err != nil {
 		return fmt.Errorf("failed to create account key: %v", err)
 	}
 
-	// Get directory
+	if err := a.fetchDirectory(); err != nil {
+		return err
+	}
+
+	if a.accountFile != "" {
+		account, err := loadAccount(a.accountFile)
+		if err != nil {
+			return err
+		}
+		if account != nil && account.Directory == a.apiURL {
+			ok, err := a.useAccount(account)
+			if err != nil || ok {
+				return err
+			}
+
+			a.logger.Warn("Account %s is no longer valid, registering a new account with %s", account.URL, a.apiURL)
+			a.accountKid = ""
+			if err := os.Remove(a.accountKey); err != nil {
+				return fmt.Errorf("failed to replace account key: %v", err)
+			}
+			if _, err := a.createKey(a.accountKey, KeyTypeRSA2048); err != nil {
+				return fmt.Errorf("failed to create account key: %v", err)
+			}
+		}
+	}
+
+	return a.newAccount()
+}
+
+// fetchDirectory fetches the directory of the ACME server
+func (a *ACMEv2) fetchDirectory() error {
 	resp, err := a.httpClient.Get(a.apiURL)
 	if err != nil {
 		return fmt.Errorf("failed to get directory: %v", err)
@@ -52,133 +121,193 @@ func (a *ACMEv2) RegisterAccount() error {
 	if err := json.Unmarshal(body, &a.directory); err != nil {
 		return fmt.Errorf("failed to parse directory: %v", err)
 	}
+	return nil
+}
 
-	// Register account
+// newAccount registers the account key, which returns the existing account
+// when the key is already registered
+func (a *ACMEv2) newAccount() error {
 	payload := map[string]interface{}{
 		"termsOfServiceAgreed": true,
 	}
+	if contact := a.contact(); contact != nil {
+		payload["contact"] = contact
+	}
+
+	newAccountURL, _ := a.directory["newAccount"].(string)
+	if a.eabKeyID != "" {
+		binding, err := a.externalAccountBinding(newAccountURL)
+		if err != nil {
+			return fmt.Errorf("failed to create external account binding: %v", err)
+		}
+		payload["externalAccountBinding"] = binding
+	} else if meta, ok := a.directory["meta"].(map[string]interface{}); ok && meta["externalAccountRequired"] == true {
+		return fmt.Errorf("the CA requires External Account Binding credentials (EAB key ID and HMAC key)")
+	}
 
-	code, result, err := a.sendSignedRequest(a.directory["newAccount"].(string), payload)
+	account, err := a.postSigned(newAccountURL, payload)
 	if err != nil {
 		return fmt.Errorf("failed to register account: %v", err)
 	}
 
-	if code != 201 && code != 200 {
-		return fmt.Errorf("failed to register account: %d %s", code, string(result))
+	if account.code != 201 && account.code != 200 {
+		return fmt.Errorf("failed to register account: %d %s", account.code, string(account.body))
 	}
 
 	// Get account ID from Location header
-	a.accountKid = resp.Header.Get("Location")
-
-	// Create domain key if it doesn't exist
-	if _, err := a.createKey(a.domainKey); err != nil {
-		return fmt.Errorf("failed to create domain key: %v", err)
+	a.accountKid = account.location
+	if a.accountKid == "" {
+		return fmt.Errorf("failed to register account: no account URL returned")
 	}
 
-	return nil
+	return a.saveAccount(&Account{
+		URL:            a.accountKid,
+		Directory:      a.apiURL,
+		Contact:        a.contact(),
+		TermsOfService: a.termsOfService(),
+	})
 }
 
-// SolveHTTPChallenge solves the HTTP challenge for domain verification
-func (a *ACMEv2) SolveHTTPChallenge() error {
-	// Create new order
-	identifiers := make([]map[string]string, len(a.domains))
-	for i, domain := range a.domains {
-		identifiers[i] = map[string]string{
-			"type":  "dns",
-			"value": domain,
-		}
+// externalAccountBinding binds the account key to the external account by
+// signing it with the EAB MAC key (RFC 8555 section 7.3.4)
+func (a *ACMEv2) externalAccountBinding(newAccountURL string) (map[string]interface{}, error) {
+	hmacKey, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(a.eabHMACKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EAB HMAC key: %v", err)
 	}
 
-	payload := map[string]interface{}{
-		"identifiers": identifiers,
+	jws, err := a.jws()
+	if err != nil {
+		return nil, err
 	}
-
-	code, result, err := a.sendSignedRequest(a.directory["newOrder"].(string), payload)
+	jwkJSON, err := json.Marshal(jws["jwk"])
 	if err != nil {
-		return fmt.Errorf("failed to create order: %v", err)
+		return nil, fmt.Errorf("failed to marshal JWK: %v", err)
 	}
 
-	if code < 200 || code > 299 {
-		return fmt.Errorf("failed to create order: %d %s", code, string(result))
+	protected := a.b64([]byte(mustMarshalJSON(map[string]interface{}{
+		"alg": "HS256",
+		"kid": a.eabKeyID,
+		"url": newAccountURL,
+	})))
+	payload := a.b64(jwkJSON)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write([]byte(protected + "." + payload))
+
+	return map[string]interface{}{
+		"protected": protected,
+		"payload":   payload,
+		"signature": a.b64(mac.Sum(nil)),
+	}, nil
+}
+
+// SolveHTTPChallenge solves the HTTP challenge for domain verification
+func (a *ACMEv2) SolveHTTPChallenge() error {
+	order, orderURL, err := a.newOrder()
+	if err != nil {
+		return err
 	}
 
-	var order map[string]interface{}
-	if err := json.Unmarshal(result, &order); err != nil {
-		return fmt.Errorf("failed to parse order: %v", err)
+	thumbprint, err := a.thumbprint()
+	if err != nil {
+		return fmt.Errorf("failed to get thumbprint: %v", err)
 	}
 
 	// Process each authorization
 	for _, authURL := range order["authorizations"].([]interface{}) {
-		resp, err := a.httpClient.Get(authURL.(string))
+		auth, err := a.getAuthorization(authURL.(string))
 		if err != nil {
-			return fmt.Errorf("failed to get authorization: %v", err)
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read authorization: %v", err)
-		}
-
-		var auth map[string]interface{}
-		if err := json.Unmarshal(body, &auth); err != nil {
-			return fmt.Errorf("failed to parse authorization: %v", err)
+			return err
 		}
 
 		domain := auth["identifier"].(map[string]interface{})["value"].(string)
-
-		// Find HTTP challenge
-		var challenge map[string]interface{}
-		for _, c := range auth["challenges"].([]interface{}) {
-			ch := c.(map[string]interface{})
-			if ch["type"].(string) == "http-01" {
-				challenge = ch
-				break
-			}
+		if auth["status"] == "valid" {
+			continue
 		}
 
+		// Find HTTP challenge
+		challenge := findChallenge(auth, ChallengeHTTP01)
 		if challenge == nil {
 			return fmt.Errorf("no HTTP challenge found for %s", domain)
 		}
 
 		// Prepare challenge response
 		token := regexp.MustCompile(`[^A-Za-z0-9_\-]`).ReplaceAllString(challenge["token"].(string), "_")
-		thumbprint, err := a.thumbprint()
-		if err != nil {
-			return fmt.Errorf("failed to get thumbprint: %v", err)
-		}
 
 		// Write challenge response
 		if err := a.writeChallenge(token, thumbprint); err != nil {
 			return fmt.Errorf("failed to write challenge: %v", err)
 		}
 
-		// Notify server
-		code, result, err = a.sendSignedRequest(challenge["url"].(string), nil)
+		// Notify server, then wait for the challenge to be validated
+		err = a.respondToChallenge(challenge["url"].(string), domain)
+
+		// Cleanup
+		a.cleanup([]string{filepath.Join(a.challengeDir, token)})
 		if err != nil {
-			return fmt.Errorf("failed to notify server: %v", err)
+			return err
 		}
+	}
 
-		if code > 399 {
-			return fmt.Errorf("failed to notify server: %d %s", code, string(result))
+	// Finalize order
+	return a.finalizeOrder(order, orderURL)
+}
+
+// SolveTLSALPNChallenge solves TLS-ALPN-01 challenges (RFC 8737). A responder
+// listens on the configured address while the authorizations are validated.
+func (a *ACMEv2) SolveTLSALPNChallenge() error {
+	if a.tlsALPNAddr == "" {
+		return fmt.Errorf("no TLS-ALPN-01 responder address configured")
+	}
+
+	order, orderURL, err := a.newOrder()
+	if err != nil {
+		return err
+	}
+
+	thumbprint, err := a.thumbprint()
+	if err != nil {
+		return fmt.Errorf("failed to get thumbprint: %v", err)
+	}
+
+	responder, err := ListenTLSALPN(a.tlsALPNAddr)
+	if err != nil {
+		return err
+	}
+	defer responder.Close()
+
+	for _, authURL := range order["authorizations"].([]interface{}) {
+		auth, err := a.getAuthorization(authURL.(string))
+		if err != nil {
+			return err
 		}
 
-		// Wait for challenge to be validated
-		if err := a.verifyChallenge(challenge["url"].(string), domain); err != nil {
-			return fmt.Errorf("failed to verify challenge: %v", err)
+		domain := auth["identifier"].(map[string]interface{})["value"].(string)
+		if auth["status"] == "valid" {
+			continue
 		}
 
-		// Cleanup
-		a.cleanup([]string{filepath.Join(a.challengeDir, token)})
+		challenge := findChallenge(auth, ChallengeTLSALPN01)
+		if challenge == nil {
+			return fmt.Errorf("no TLS-ALPN challenge found for %s", domain)
+		}
+
+		keyAuth := fmt.Sprintf("%s.%s", challenge["token"].(string), thumbprint)
+		if err := responder.SetChallenge(domain, keyAuth); err != nil {
+			return err
+		}
+
+		if err := a.respondToChallenge(challenge["url"].(string), domain); err != nil {
+			return err
+		}
 	}
 
-	// Finalize order
-	return a.finalizeOrder(order)
+	return a.finalizeOrder(order, orderURL)
 }
 
-// SolveDNSChallenge solves the DNS challenge for domain verification
-func (a *ACMEv2) SolveDNSChallenge(dnsClient DNSProvider) error {
-	// Create new order
+// newOrder creates an order for the domains and returns it with its URL
+func (a *ACMEv2) newOrder() (map[string]interface{}, string, error) {
 	identifiers := make([]map[string]string, len(a.domains))
 	for i, domain := range a.domains {
 		identifiers[i] = map[string]string{
@@ -191,136 +320,207 @@ func (a *ACMEv2) SolveDNSChallenge(dnsClient DNSProvider) error {
 		"identifiers": identifiers,
 	}
 
-	code, result, err := a.sendSignedRequest(a.directory["newOrder"].(string), payload)
+	newOrderURL, _ := a.directory["newOrder"].(string)
+	resp, err := a.postSigned(newOrderURL, payload)
 	if err != nil {
-		return fmt.Errorf("failed to create order: %v", err)
+		return nil, "", fmt.Errorf("failed to create order: %v", err)
 	}
 
-	if code < 200 || code > 299 {
-		return fmt.Errorf("failed to create order: %d %s", code, string(result))
+	if resp.code < 200 || resp.code > 299 {
+		return nil, "", fmt.Errorf("failed to create order: %d %s", resp.code, string(resp.body))
 	}
 
 	var order map[string]interface{}
-	if err := json.Unmarshal(result, &order); err != nil {
-		return fmt.Errorf("failed to parse order: %v", err)
+	if err := json.Unmarshal(resp.body, &order); err != nil {
+		return nil, "", fmt.Errorf("failed to parse order: %v", err)
+	}
+	if _, ok := order["authorizations"].([]interface{}); !ok {
+		return nil, "", fmt.Errorf("failed to parse order: no authorizations")
 	}
+	return order, resp.location, nil
+}
 
-	// Process each authorization
-	for _, authURL := range order["authorizations"].([]interface{}) {
-		resp, err := a.httpClient.Get(authURL.(string))
-		if err != nil {
-			return fmt.Errorf("failed to get authorization: %v", err)
+// findChallenge returns the challenge of the given type offered by an authorization
+func findChallenge(auth map[string]interface{}, challengeType ChallengeType) map[string]interface{} {
+	challenges, _ := auth["challenges"].([]interface{})
+	for _, c := range challenges {
+		ch, ok := c.(map[string]interface{})
+		if ok && ch["type"] == string(challengeType) {
+			return ch
 		}
-		defer resp.Body.Close()
+	}
+	return nil
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read authorization: %v", err)
-		}
+// respondToChallenge tells the server the challenge is ready and waits for it
+// to be validated
+func (a *ACMEv2) respondToChallenge(url, domain string) error {
+	code, result, err := a.sendSignedRequest(url, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("failed to notify server: %v", err)
+	}
+
+	if code > 399 {
+		return fmt.Errorf("failed to notify server: %d %s", code, string(result))
+	}
+
+	if err := a.verifyChallenge(url, domain); err != nil {
+		return fmt.Errorf("failed to verify challenge: %v", err)
+	}
+	return nil
+}
 
-		var auth map[string]interface{}
-		if err := json.Unmarshal(body, &auth); err != nil {
-			return fmt.Errorf("failed to parse authorization: %v", err)
+// dnsChallenge is a pending DNS-01 challenge whose TXT record has been created
+type dnsChallenge struct {
+	domain   string
+	fqdn     string
+	value    string
+	url      string
+	recordID string
+}
+
+// SolveDNSChallenge solves the DNS challenge for domain verification. All TXT
+// records are created first and polled until they have propagated, then the
+// challenges are validated. Records are removed again whether or not the
+// order succeeds.
+func (a *ACMEv2) SolveDNSChallenge(dnsClient DNSProvider) error {
+	order, orderURL, err := a.newOrder()
+	if err != nil {
+		return err
+	}
+
+	thumbprint, err := a.thumbprint()
+	if err != nil {
+		return fmt.Errorf("failed to get thumbprint: %v", err)
+	}
+
+	var challenges []*dnsChallenge
+	defer a.cleanupDNSRecords(dnsClient, &challenges)
+
+	// Create a TXT record for each authorization
+	for _, authURL := range order["authorizations"].([]interface{}) {
+		auth, err := a.getAuthorization(authURL.(string))
+		if err != nil {
+			return err
 		}
 
 		domain := auth["identifier"].(map[string]interface{})["value"].(string)
-
-		// Find DNS challenge
-		var challenge map[string]interface{}
-		for _, c := range auth["challenges"].([]interface{}) {
-			ch := c.(map[string]interface{})
-			if ch["type"].(string) == "dns-01" {
-				challenge = ch
-				break
-			}
+		if auth["status"] == "valid" {
+			continue
 		}
 
+		// Find DNS challenge
+		challenge := findChallenge(auth, ChallengeDNS01)
 		if challenge == nil {
 			return fmt.Errorf("no DNS challenge found for %s", domain)
 		}
 
-		// Prepare challenge response
+		// The TXT value is the digest of the key authorization
 		token := regexp.MustCompile(`[^A-Za-z0-9_\-]`).ReplaceAllString(challenge["token"].(string), "_")
-		thumbprint, err := a.thumbprint()
-		if err != nil {
-			return fmt.Errorf("failed to get thumbprint: %v", err)
-		}
-
-		keyAuth := fmt.Sprintf("%s.%s", token, thumbprint)
-		txtRecord := a.b64([]byte(keyAuth))
+		digest := sha256.Sum256([]byte(fmt.Sprintf("%s.%s", token, thumbprint)))
 
-		// Create DNS record
-		record, err := dnsClient.CreateRecord(domain, "_acme-challenge."+strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.")+".", txtRecord)
-		if err != nil {
-			return fmt.Errorf("failed to create DNS record: %v", err)
+		ch := &dnsChallenge{
+			domain: domain,
+			fqdn:   "_acme-challenge." + strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.") + ".",
+			value:  a.b64(digest[:]),
+			url:    challenge["url"].(string),
 		}
 
-		// Notify server
-		code, result, err = a.sendSignedRequest(challenge["url"].(string), map[string]string{
-			"keyAuthorization": keyAuth,
-		})
+		// Create DNS record
+		ch.recordID, err = dnsClient.CreateRecord(domain, ch.fqdn, ch.value)
 		if err != nil {
-			return fmt.Errorf("failed to notify server: %v", err)
+			return fmt.Errorf("failed to create DNS record for %s: %v", domain, err)
 		}
+		challenges = append(challenges, ch)
+	}
 
-		if code > 399 {
-			return fmt.Errorf("failed to notify server: %d %s", code, string(result))
+	propagation := a.propagation
+	if len(propagation.Nameservers) == 0 {
+		if nsProvider, ok := dnsClient.(NameserverProvider); ok {
+			propagation.Nameservers = nsProvider.Nameservers()
 		}
+	}
 
-		// Wait for challenge to be validated
-		if err := a.verifyChallenge(challenge["url"].(string), domain); err != nil {
-			return fmt.Errorf("failed to verify challenge: %v", err)
+	for _, ch := range challenges {
+		// Wait for the record to be visible before asking the CA to check it
+		if err := WaitForTXTRecord(ch.fqdn, ch.value, propagation); err != nil {
+			return err
 		}
 
-		// Cleanup DNS record
-		if !a.debug {
-			if err := dnsClient.DeleteRecord(domain, record); err != nil {
-				return fmt.Errorf("failed to delete DNS record: %v", err)
-			}
+		if err := a.respondToChallenge(ch.url, ch.domain); err != nil {
+			return err
 		}
 	}
 
 	// Finalize order
-	return a.finalizeOrder(order)
+	return a.finalizeOrder(order, orderURL)
+}
+
+// getAuthorization fetches an authorization object
+func (a *ACMEv2) getAuthorization(url string) (map[string]interface{}, error) {
+	auth, err := a.fetchResource(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization: %v", err)
+	}
+	return auth, nil
+}
+
+// fetchResource fetches an ACME resource with a POST-as-GET request
+func (a *ACMEv2) fetchResource(url string) (map[string]interface{}, error) {
+	code, body, err := a.sendSignedRequest(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if code > 299 {
+		return nil, fmt.Errorf("%d %s", code, string(body))
+	}
+
+	var resource map[string]interface{}
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", url, err)
+	}
+	return resource, nil
+}
+
+// cleanupDNSRecords removes the TXT records created for DNS challenges
+func (a *ACMEv2) cleanupDNSRecords(dnsClient DNSProvider, challenges *[]*dnsChallenge) {
+	if a.debug {
+		return
+	}
+	for _, ch := range *challenges {
+		if err := dnsClient.DeleteRecord(ch.domain, ch.recordID); err != nil {
+			a.logger.Warn("Failed to delete DNS record %s for %s: %v", ch.fqdn, ch.domain, err)
+		}
+	}
 }
 
 // verifyChallenge waits for the challenge to be validated
 func (a *ACMEv2) verifyChallenge(url, domain string) error {
 	for i := 0; i < 60; i++ {
-		resp, err := a.httpClient.Get(url)
+		status, err := a.fetchResource(url)
 		if err != nil {
 			return fmt.Errorf("failed to check challenge status: %v", err)
 		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read challenge status: %v", err)
-		}
-
-		var status map[string]interface{}
-		if err := json.Unmarshal(body, &status); err != nil {
-			return fmt.Errorf("failed to parse challenge status: %v", err)
-		}
 
-		switch status["status"].(string) {
+		switch status["status"] {
 		case "valid":
 			return nil
 		case "invalid":
 			return fmt.Errorf("challenge failed for %s: %v", domain, status["error"])
-		case "pending":
-			time.Sleep(5 * time.Second)
+		case "pending", "processing":
+			time.Sleep(a.pollInterval)
 			continue
 		default:
-			return fmt.Errorf("unexpected challenge status: %s", status["status"])
+			return fmt.Errorf("unexpected challenge status: %v", status["status"])
 		}
 	}
 
 	return fmt.Errorf("challenge verification timed out for %s", domain)
 }
 
-// finalizeOrder finalizes the order and downloads the certificate
-func (a *ACMEv2) finalizeOrder(order map[string]interface{}) error {
+// finalizeOrder finalizes the order, waits for the certificate to be issued
+// and downloads it
+func (a *ACMEv2) finalizeOrder(order map[string]interface{}, orderURL string) error {
 	// Create CSR
 	csr, err := a.createCSR()
 	if err != nil {
@@ -332,7 +532,8 @@ func (a *ACMEv2) finalizeOrder(order map[string]interface{}) error {
 		"csr": a.b64(csr),
 	}
 
-	code, result, err := a.sendSignedRequest(order["finalize"].(string), payload)
+	finalizeURL, _ := order["finalize"].(string)
+	code, result, err := a.sendSignedRequest(finalizeURL, payload)
 	if err != nil {
 		return fmt.Errorf("failed to finalize order: %v", err)
 	}
@@ -341,24 +542,39 @@ func (a *ACMEv2) finalizeOrder(order map[string]interface{}) error {
 		return fmt.Errorf("failed to finalize order: %d %s", code, string(result))
 	}
 
-	// Download certificate
-	resp, err := a.httpClient.Get(order["certificate"].(string))
-	if err != nil {
-		return fmt.Errorf("failed to download certificate: %v", err)
+	if err := json.Unmarshal(result, &order); err != nil {
+		return fmt.Errorf("failed to parse order: %v", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read certificate: %v", err)
+	// Wait for the certificate to be issued
+	for i := 0; order["status"] != "valid"; i++ {
+		switch {
+		case order["status"] == "invalid":
+			return fmt.Errorf("order failed: %v", order["error"])
+		case i >= 60:
+			return fmt.Errorf("order timed out in status %v", order["status"])
+		case orderURL == "":
+			return fmt.Errorf("order is %v and has no URL to poll", order["status"])
+		}
+
+		time.Sleep(a.pollInterval)
+		if order, err = a.fetchResource(orderURL); err != nil {
+			return fmt.Errorf("failed to check order status: %v", err)
+		}
 	}
 
-	// Save certificate
-	if err := os.WriteFile(a.certPath, body, 0644); err != nil {
-		return fmt.Errorf("failed to save certificate: %v", err)
+	// Download certificate
+	certURL, _ := order["certificate"].(string)
+	code, body, err := a.sendSignedRequest(certURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download certificate: %v", err)
+	}
+	if code > 299 {
+		return fmt.Errorf("failed to download certificate: %d %s", code, string(body))
 	}
 
-	return nil
+	// Save certificate, with the domain key it was issued for
+	return a.saveCertificate(body)
 }
 
 // GetCertificate obtains a certificate for the specified domains
@@ -367,15 +583,25 @@ func (a *ACMEv2) GetCertificate() error {
 		return fmt.Errorf("failed to register account: %v", err)
 	}
 
-	if a.dnsProvider != "" {
-		var dnsClient DNSProvider
-		switch a.dnsProvider {
-		case "digitalocean":
-			dnsClient = NewDigitalOcean()
-		default:
-			return fmt.Errorf("unsupported DNS provider: %s", a.dnsProvider)
+	// Create domain key if it doesn't exist or has a different key type
+	if err := a.createDomainKey(); err != nil {
+		return fmt.Errorf("failed to create domain key: %v", err)
+	}
+	defer a.discardPendingKey()
+
+	switch a.challenge {
+	case ChallengeDNS01:
+		dnsClient, err := NewDNSProvider(a.dnsProvider)
+		if err != nil {
+			return err
 		}
 		return a.SolveDNSChallenge(dnsClient)
+	case ChallengeTLSALPN01:
+		err := a.SolveTLSALPNChallenge()
+		if err == nil {
+			return nil
+		}
+		a.logger.Warn("TLS-ALPN-01 challenge failed for %s, falling back to HTTP-01: %v", strings.Join(a.domains, ", "), err)
 	}
 
 	return a.SolveHTTPChallenge()
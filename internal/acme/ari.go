@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRenewalInfoUnsupported is returned when the CA does not offer ACME
+// Renewal Information
+var ErrRenewalInfoUnsupported = errors.New("the CA does not support renewal information")
+
+// RenewalInfo is the renewal window a CA suggests for a certificate (ACME
+// Renewal Information, RFC 9773)
+type RenewalInfo struct {
+	Start          time.Time
+	End            time.Time
+	ExplanationURL string
+	RetryAfter     time.Duration // When to ask again, zero if the CA did not say
+}
+
+// ARICertID returns the identifier of cert in renewal information requests:
+// its authority key identifier and serial number, base64url encoded
+func ARICertID(cert *x509.Certificate) (string, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", fmt.Errorf("certificate has no authority key identifier")
+	}
+
+	// The DER encoding of the serial is two's complement, a positive serial
+	// with the high bit set gets a leading zero byte
+	serial := cert.SerialNumber.Bytes()
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(cert.AuthorityKeyId) + "." + enc.EncodeToString(serial), nil
+}
+
+// GetRenewalInfo fetches the renewal window the CA suggests for cert
+func (a *ACMEv2) GetRenewalInfo(cert *x509.Certificate) (*RenewalInfo, error) {
+	if err := a.fetchDirectory(); err != nil {
+		return nil, err
+	}
+	renewalInfoURL, _ := a.directory["renewalInfo"].(string)
+	if renewalInfoURL == "" {
+		return nil, ErrRenewalInfoUnsupported
+	}
+
+	certID, err := ARICertID(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.httpClient.Get(strings.TrimSuffix(renewalInfoURL, "/") + "/" + certID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get renewal information: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read renewal information: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get renewal information: %d %s", resp.StatusCode, string(body))
+	}
+
+	var ri struct {
+		SuggestedWindow struct {
+			Start time.Time `json:"start"`
+			End   time.Time `json:"end"`
+		} `json:"suggestedWindow"`
+		ExplanationURL string `json:"explanationURL"`
+	}
+	if err := json.Unmarshal(body, &ri); err != nil {
+		return nil, fmt.Errorf("failed to parse renewal information: %v", err)
+	}
+	if ri.SuggestedWindow.Start.IsZero() || ri.SuggestedWindow.End.Before(ri.SuggestedWindow.Start) {
+		return nil, fmt.Errorf("invalid renewal window %s - %s", ri.SuggestedWindow.Start, ri.SuggestedWindow.End)
+	}
+
+	return &RenewalInfo{
+		Start:          ri.SuggestedWindow.Start,
+		End:            ri.SuggestedWindow.End,
+		ExplanationURL: ri.ExplanationURL,
+		RetryAfter:     parseRetryAfter(resp.Header.Get("Retry-After")),
+	}, nil
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package acme
+
+import (
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestARICertID(t *testing.T) {
+	// Example from RFC 9773 section 4.1
+	cert := &x509.Certificate{
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5B, 0x6B, 0x87, 0x46, 0x40, 0x41, 0xE1, 0xB3,
+			0x7B, 0x84, 0x7B, 0xA0, 0xAE, 0x2C, 0xDE, 0x01, 0xC8, 0xD4},
+		SerialNumber: big.NewInt(0x87654321),
+	}
+	id, err := ARICertID(cert)
+	require.NoError(t, err)
+	assert.Equal(t, "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", id)
+
+	_, err = ARICertID(&x509.Certificate{SerialNumber: big.NewInt(1)})
+	assert.Error(t, err)
+}
+
+func TestGetRenewalInfo(t *testing.T) {
+	challengeDir := t.TempDir()
+	server := newTestACMEServer(t, challengeDir, "")
+	a, certPath := newTestACMEClient(t, server, challengeDir, "example.com")
+	require.NoError(t, a.GetCertificate())
+	cert := readTestCertificate(t, certPath)
+
+	// Unknown certificates are not found
+	_, err := a.GetRenewalInfo(cert)
+	assert.Error(t, err)
+
+	id, err := ARICertID(cert)
+	require.NoError(t, err)
+	server.renewalInfo = map[string]string{
+		id: `{"suggestedWindow":{"start":"2025-01-02T04:00:00Z","end":"2025-01-03T04:00:00Z"},"explanationURL":"https://example.com/incident"}`,
+	}
+	info, err := a.GetRenewalInfo(cert)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC), info.Start.UTC())
+	assert.Equal(t, time.Date(2025, 1, 3, 4, 0, 0, 0, time.UTC), info.End.UTC())
+	assert.Equal(t, "https://example.com/incident", info.ExplanationURL)
+	assert.Equal(t, 6*time.Hour, info.RetryAfter)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Zero(t, parseRetryAfter(""))
+	assert.Zero(t, parseRetryAfter("soon"))
+	assert.InDelta(t, time.Hour, parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)), float64(5*time.Second))
+}
@@ -0,0 +1,93 @@
+package acme
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+)
+
+// CA is an ACME certificate authority together with the account details used
+// to register with it
+type CA struct {
+	Name         string // Name used in configuration, or the directory URL
+	DirectoryURL string
+	Email        string // Contact address of the account, optional
+	EABKeyID     string // External Account Binding key identifier
+	EABHMACKey   string // External Account Binding MAC key, base64url encoded
+}
+
+// knownCAs maps the names of well known CAs to their directory URL
+var knownCAs = map[string]string{
+	"letsencrypt":         constants.LetsEncryptProductionAPI,
+	"letsencrypt-staging": constants.LetsEncryptStagingAPI,
+	"zerossl":             "https://acme.zerossl.com/v2/DV90",
+	"google":              "https://dv.acme-v02.api.pki.goog/directory",
+	"google-staging":      "https://dv.acme-v02.test-api.pki.goog/directory",
+}
+
+// checkDirectoryURL checks that a directory URL is reached over HTTPS, as
+// account requests and CSRs must not be sent in the clear. Plain HTTP is only
+// accepted with ACME_ALLOW_HTTP=true, for test CAs such as Pebble.
+func checkDirectoryURL(directoryURL string) error {
+	u, err := url.Parse(directoryURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid ACME directory URL %q", directoryURL)
+	}
+	if u.Scheme == "http" && os.Getenv("ACME_ALLOW_HTTP") != "true" {
+		return fmt.Errorf("ACME directory URL %q is not HTTPS (set ACME_ALLOW_HTTP=true for a test CA)", directoryURL)
+	}
+	return nil
+}
+
+// KnownCANames returns the names of the built-in CAs
+func KnownCANames() []string {
+	names := make([]string, 0, len(knownCAs))
+	for name := range knownCAs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CAFromEnv resolves a CA given by name or directory URL. Named CAs are the
+// built-in ones or defined with ACME_CA_<NAME>_URL, their account details
+// coming from ACME_CA_<NAME>_EMAIL, ACME_CA_<NAME>_EAB_KID and
+// ACME_CA_<NAME>_EAB_HMAC_KEY. The contact address defaults to ACME_EMAIL.
+func CAFromEnv(nameOrURL string) (CA, error) {
+	nameOrURL = strings.TrimSpace(nameOrURL)
+	ca := CA{Name: nameOrURL, Email: os.Getenv("ACME_EMAIL")}
+
+	if strings.Contains(nameOrURL, "://") {
+		if err := checkDirectoryURL(nameOrURL); err != nil {
+			return CA{}, err
+		}
+		ca.DirectoryURL = nameOrURL
+		return ca, nil
+	}
+
+	name := strings.ToLower(nameOrURL)
+	prefix := "ACME_CA_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+	ca.Name = name
+	ca.DirectoryURL = os.Getenv(prefix + "URL")
+	if ca.DirectoryURL == "" {
+		ca.DirectoryURL = knownCAs[name]
+	}
+	if ca.DirectoryURL == "" {
+		return CA{}, fmt.Errorf("unknown ACME CA %q (expected a directory URL, one of %s or ACME_CA_<NAME>_URL)",
+			nameOrURL, strings.Join(KnownCANames(), ", "))
+	}
+	if err := checkDirectoryURL(ca.DirectoryURL); err != nil {
+		return CA{}, err
+	}
+
+	if email := os.Getenv(prefix + "EMAIL"); email != "" {
+		ca.Email = email
+	}
+	ca.EABKeyID = os.Getenv(prefix + "EAB_KID")
+	ca.EABHMACKey = os.Getenv(prefix + "EAB_HMAC_KEY")
+	return ca, nil
+}
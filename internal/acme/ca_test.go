@@ -0,0 +1,52 @@
+package acme
+
+import (
+	"testing"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCAFromEnv(t *testing.T) {
+	t.Setenv("ACME_EMAIL", "admin@example.com")
+	t.Setenv("ACME_CA_ZEROSSL_EAB_KID", "kid")
+	t.Setenv("ACME_CA_ZEROSSL_EAB_HMAC_KEY", "hmac")
+	t.Setenv("ACME_CA_STEP_CA_URL", "https://ca.internal:9000/acme/acme/directory")
+	t.Setenv("ACME_CA_STEP_CA_EMAIL", "pki@example.com")
+
+	ca, err := CAFromEnv("letsencrypt-staging")
+	require.NoError(t, err)
+	assert.Equal(t, constants.LetsEncryptStagingAPI, ca.DirectoryURL)
+	assert.Equal(t, "admin@example.com", ca.Email)
+
+	ca, err = CAFromEnv("ZeroSSL")
+	require.NoError(t, err)
+	assert.Equal(t, CA{Name: "zerossl", DirectoryURL: "https://acme.zerossl.com/v2/DV90", Email: "admin@example.com", EABKeyID: "kid", EABHMACKey: "hmac"}, ca)
+
+	ca, err = CAFromEnv("step-ca")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ca.internal:9000/acme/acme/directory", ca.DirectoryURL)
+	assert.Equal(t, "pki@example.com", ca.Email)
+
+	ca, err = CAFromEnv("https://acme.example.net/directory")
+	require.NoError(t, err)
+	assert.Equal(t, "https://acme.example.net/directory", ca.DirectoryURL)
+
+	_, err = CAFromEnv("unknown")
+	assert.Error(t, err)
+	_, err = CAFromEnv("ftp://acme.example.net/directory")
+	assert.Error(t, err)
+
+	// Plain HTTP is only used by test CAs, which have to be allowed
+	t.Setenv("ACME_CA_PEBBLE_URL", "http://pebble:14000/dir")
+	_, err = CAFromEnv("http://acme.example.net/directory")
+	assert.Error(t, err)
+	_, err = CAFromEnv("pebble")
+	assert.Error(t, err)
+
+	t.Setenv("ACME_ALLOW_HTTP", "true")
+	ca, err = CAFromEnv("pebble")
+	require.NoError(t, err)
+	assert.Equal(t, "http://pebble:14000/dir", ca.DirectoryURL)
+}
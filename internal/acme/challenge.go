@@ -0,0 +1,29 @@
+package acme
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChallengeType identifies how domain ownership is validated
+type ChallengeType string
+
+const (
+	ChallengeHTTP01    ChallengeType = "http-01"
+	ChallengeTLSALPN01 ChallengeType = "tls-alpn-01"
+	ChallengeDNS01     ChallengeType = "dns-01"
+)
+
+// ParseChallengeType parses a challenge type name such as http-01 or tls-alpn-01
+func ParseChallengeType(name string) (ChallengeType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "http-01", "http":
+		return ChallengeHTTP01, nil
+	case "tls-alpn-01", "tls-alpn":
+		return ChallengeTLSALPN01, nil
+	case "dns-01", "dns":
+		return ChallengeDNS01, nil
+	default:
+		return "", fmt.Errorf("unsupported challenge type %q (expected http-01, tls-alpn-01 or dns-01)", name)
+	}
+}
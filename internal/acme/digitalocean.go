@@ -0,0 +1,182 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterDNSProvider("digitalocean", func() (DNSProvider, error) {
+		provider := NewDigitalOcean()
+		if provider.apiToken == "" {
+			return nil, fmt.Errorf("DO_API_TOKEN is not set")
+		}
+		return provider, nil
+	})
+}
+
+// DigitalOcean represents a DigitalOcean DNS provider
+type DigitalOcean struct {
+	apiToken string
+	baseURL  string
+	client   *http.Client
+	zones    map[string]string // Record ID to zone, needed to delete records
+	mu       sync.Mutex
+}
+
+// NewDigitalOcean creates a new DigitalOcean DNS provider
+func NewDigitalOcean() *DigitalOcean {
+	return &DigitalOcean{
+		apiToken: os.Getenv("DO_API_TOKEN"),
+		baseURL:  "https://api.digitalocean.com/v2",
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		zones: make(map[string]string),
+	}
+}
+
+// CreateRecord creates a TXT record named by its FQDN in the zone holding domain
+func (d *DigitalOcean) CreateRecord(domain, name, value string) (string, error) {
+	zone, err := d.findZone(domain)
+	if err != nil {
+		return "", err
+	}
+
+	payload := map[string]interface{}{
+		"type": "TXT",
+		"name": relativeRecordName(name, zone),
+		"data": value,
+		"ttl":  60,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/domains/%s/records", d.baseURL, zone)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.apiToken)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to create record: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		DomainRecord struct {
+			ID int64 `json:"id"`
+		} `json:"domain_record"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	recordID := fmt.Sprintf("%d", result.DomainRecord.ID)
+	d.mu.Lock()
+	d.zones[recordID] = zone
+	d.mu.Unlock()
+	return recordID, nil
+}
+
+// DeleteRecord deletes a DNS record
+func (d *DigitalOcean) DeleteRecord(domain, recordID string) error {
+	d.mu.Lock()
+	zone, ok := d.zones[recordID]
+	d.mu.Unlock()
+	if !ok {
+		var err error
+		if zone, err = d.findZone(domain); err != nil {
+			return err
+		}
+	}
+
+	url := fmt.Sprintf("%s/domains/%s/records/%s", d.baseURL, zone, recordID)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+d.apiToken)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to delete record: %d", resp.StatusCode)
+	}
+
+	d.mu.Lock()
+	delete(d.zones, recordID)
+	d.mu.Unlock()
+	return nil
+}
+
+// findZone returns the longest DigitalOcean domain that domain belongs to
+func (d *DigitalOcean) findZone(domain string) (string, error) {
+	req, err := http.NewRequest("GET", d.baseURL+"/domains?per_page=200", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+d.apiToken)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to list domains: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to list domains: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Domains []struct {
+			Name string `json:"name"`
+		} `json:"domains"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	domain = strings.TrimSuffix(domain, ".")
+	zone := ""
+	for _, d := range result.Domains {
+		if (domain == d.Name || strings.HasSuffix(domain, "."+d.Name)) && len(d.Name) > len(zone) {
+			zone = d.Name
+		}
+	}
+	if zone == "" {
+		return "", fmt.Errorf("no DigitalOcean domain found for %s", domain)
+	}
+	return zone, nil
+}
+
+// relativeRecordName returns the record name relative to its zone
+func relativeRecordName(fqdn, zone string) string {
+	name := strings.TrimSuffix(fqdn, ".")
+	if name == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
@@ -1,11 +1,14 @@
 package acme
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,88 +18,147 @@ type DNSProvider interface {
 	DeleteRecord(domain, recordID string) error
 }
 
-// DigitalOcean represents a DigitalOcean DNS provider
-type DigitalOcean struct {
-	apiToken string
-	client   *http.Client
+// NameserverProvider is implemented by DNS providers that know which
+// nameservers to poll for record propagation
+type NameserverProvider interface {
+	Nameservers() []string
 }
 
-// NewDigitalOcean creates a new DigitalOcean DNS provider
-func NewDigitalOcean() *DigitalOcean {
-	return &DigitalOcean{
-		apiToken: os.Getenv("DO_API_TOKEN"),
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-	}
+// DNSProviderFactory creates a DNS provider configured from the environment
+type DNSProviderFactory func() (DNSProvider, error)
+
+var (
+	dnsProviders   = make(map[string]DNSProviderFactory)
+	dnsProvidersMu sync.RWMutex
+)
+
+// RegisterDNSProvider registers a DNS provider under the given name
+func RegisterDNSProvider(name string, factory DNSProviderFactory) {
+	dnsProvidersMu.Lock()
+	defer dnsProvidersMu.Unlock()
+	dnsProviders[name] = factory
 }
 
-// CreateRecord creates a DNS record
-func (d *DigitalOcean) CreateRecord(domain, name, value string) (string, error) {
-	payload := map[string]interface{}{
-		"type":     "TXT",
-		"name":     name,
-		"data":     value,
-		"ttl":      60,
-		"flags":    nil,
-		"tag":      nil,
-		"port":     nil,
-		"weight":   nil,
-		"priority": nil,
+// NewDNSProvider creates the DNS provider registered under the given name
+func NewDNSProvider(name string) (DNSProvider, error) {
+	dnsProvidersMu.RLock()
+	factory, ok := dnsProviders[strings.ToLower(name)]
+	dnsProvidersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported DNS provider: %s (expected one of %s)", name, strings.Join(DNSProviderNames(), ", "))
 	}
 
-	body, err := json.Marshal(payload)
+	provider, err := factory()
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %v", err)
+		return nil, fmt.Errorf("failed to configure DNS provider %s: %v", name, err)
 	}
+	return provider, nil
+}
 
-	url := fmt.Sprintf("https://api.digitalocean.com/v2/domains/%s/records", domain)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+// DNSProviderNames returns the names of the registered DNS providers
+func DNSProviderNames() []string {
+	dnsProvidersMu.RLock()
+	defer dnsProvidersMu.RUnlock()
+
+	names := make([]string, 0, len(dnsProviders))
+	for name := range dnsProviders {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+d.apiToken)
+// PropagationConfig controls how long to wait for TXT records to become visible
+type PropagationConfig struct {
+	Timeout     time.Duration
+	Interval    time.Duration
+	Nameservers []string // host:port, empty to use the system resolver
+}
 
-	resp, err := d.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+// PropagationConfigFromEnv reads DNS_PROPAGATION_TIMEOUT (seconds),
+// DNS_PROPAGATION_INTERVAL (seconds) and DNS_PROPAGATION_NAMESERVERS
+func PropagationConfigFromEnv() PropagationConfig {
+	cfg := PropagationConfig{
+		Timeout:  120 * time.Second,
+		Interval: 5 * time.Second,
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("failed to create record: %d", resp.StatusCode)
+	if v, err := strconv.Atoi(os.Getenv("DNS_PROPAGATION_TIMEOUT")); err == nil && v > 0 {
+		cfg.Timeout = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(os.Getenv("DNS_PROPAGATION_INTERVAL")); err == nil && v > 0 {
+		cfg.Interval = time.Duration(v) * time.Second
+	}
+	for _, ns := range strings.Split(os.Getenv("DNS_PROPAGATION_NAMESERVERS"), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			cfg.Nameservers = append(cfg.Nameservers, withDefaultPort(ns, "53"))
+		}
 	}
+	return cfg
+}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+// WaitForTXTRecord polls until every nameserver returns the TXT value for fqdn
+func WaitForTXTRecord(fqdn, value string, cfg PropagationConfig) error {
+	nameservers := cfg.Nameservers
+	if len(nameservers) == 0 {
+		nameservers = []string{""} // System resolver
 	}
 
-	record := result["domain_record"].(map[string]interface{})
-	return fmt.Sprintf("%v", record["id"]), nil
+	deadline := time.Now().Add(cfg.Timeout)
+	for {
+		var lastErr error
+		for _, ns := range nameservers {
+			if err := checkTXTRecord(fqdn, value, ns); err != nil {
+				lastErr = err
+				break
+			}
+		}
+		if lastErr == nil {
+			return nil
+		}
+
+		if time.Now().Add(cfg.Interval).After(deadline) {
+			return fmt.Errorf("TXT record %s not propagated after %v: %v", fqdn, cfg.Timeout, lastErr)
+		}
+		time.Sleep(cfg.Interval)
+	}
 }
 
-// DeleteRecord deletes a DNS record
-func (d *DigitalOcean) DeleteRecord(domain, recordID string) error {
-	url := fmt.Sprintf("https://api.digitalocean.com/v2/domains/%s/records/%s", domain, recordID)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+// checkTXTRecord looks up the TXT records of fqdn on a nameserver
+func checkTXTRecord(fqdn, value, nameserver string) error {
+	resolver := net.DefaultResolver
+	if nameserver != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, nameserver)
+			},
+		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+d.apiToken)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	resp, err := d.client.Do(req)
+	records, err := resolver.LookupTXT(ctx, fqdn)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to delete record: %d", resp.StatusCode)
+	for _, record := range records {
+		if record == value {
+			return nil
+		}
+	}
+	server := nameserver
+	if server == "" {
+		server = "system resolver"
 	}
+	return fmt.Errorf("%s does not return the challenge value yet", server)
+}
 
-	return nil
+// withDefaultPort appends port to host if it has none
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
 }
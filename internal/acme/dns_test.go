@@ -0,0 +1,221 @@
+package acme
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDNSServer is a local UDP nameserver answering TXT queries from a map
+type testDNSServer struct {
+	conn    net.PacketConn
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func newTestDNSServer(t *testing.T) *testDNSServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testDNSServer{conn: conn, records: make(map[string][]string)}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *testDNSServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *testDNSServer) setTXT(name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[strings.ToLower(name)] = values
+}
+
+func (s *testDNSServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// answer builds a response to a single question query
+func (s *testDNSServer) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	var labels []string
+	off := 12
+	for off < len(query) && query[off] != 0 {
+		l := int(query[off])
+		labels = append(labels, string(query[off+1:off+1+l]))
+		off += l + 1
+	}
+	off += 5 // Terminating zero, qtype and qclass
+	name := strings.ToLower(strings.Join(labels, ".") + ".")
+	qtype := binary.BigEndian.Uint16(query[off-4 : off-2])
+
+	s.mu.Lock()
+	values, ok := s.records[name]
+	s.mu.Unlock()
+
+	resp := make([]byte, 12, 512)
+	copy(resp, query[:2])
+	flags := uint16(0x8180)
+	if !ok {
+		flags |= 3 // NXDOMAIN
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	if qtype != 16 {
+		values = nil
+	}
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(values)))
+	resp = append(resp, query[12:off]...)
+	for _, v := range values {
+		resp = append(resp, 0xc0, 0x0c, 0, 16, 0, 1, 0, 0, 0, 60)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(v)+1))
+		resp = append(resp, byte(len(v)))
+		resp = append(resp, v...)
+	}
+	return resp
+}
+
+func TestDNSProviderRegistry(t *testing.T) {
+	assert.Contains(t, DNSProviderNames(), "digitalocean")
+	assert.Contains(t, DNSProviderNames(), "rfc2136")
+
+	_, err := NewDNSProvider("route66")
+	assert.Error(t, err)
+
+	t.Setenv("RFC2136_NAMESERVER", "")
+	_, err = NewDNSProvider("rfc2136")
+	assert.Error(t, err)
+
+	t.Setenv("RFC2136_NAMESERVER", "10.0.0.53")
+	provider, err := NewDNSProvider("RFC2136")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.53:53"}, provider.(NameserverProvider).Nameservers())
+}
+
+func TestWaitForTXTRecord(t *testing.T) {
+	server := newTestDNSServer(t)
+	cfg := PropagationConfig{
+		Timeout:     2 * time.Second,
+		Interval:    50 * time.Millisecond,
+		Nameservers: []string{server.addr()},
+	}
+
+	server.setTXT("_acme-challenge.example.com.", "other")
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		server.setTXT("_acme-challenge.example.com.", "other", "expected")
+	}()
+	assert.NoError(t, WaitForTXTRecord("_acme-challenge.example.com.", "expected", cfg))
+
+	cfg.Timeout = 200 * time.Millisecond
+	err := WaitForTXTRecord("_acme-challenge.missing.example.com.", "expected", cfg)
+	assert.ErrorContains(t, err, "not propagated")
+}
+
+func TestRFC2136Records(t *testing.T) {
+	t.Setenv("RFC2136_NAMESERVER", "127.0.0.1:5353")
+	t.Setenv("RFC2136_ZONE", "example.com.")
+	t.Setenv("RFC2136_TSIG_KEY", "acme-key")
+	t.Setenv("RFC2136_TSIG_SECRET", "c2VjcmV0")
+	provider, err := NewRFC2136()
+	require.NoError(t, err)
+
+	var scripts []string
+	var keyFiles []string
+	provider.run = func(stdin, name string, args ...string) ([]byte, error) {
+		assert.Equal(t, "nsupdate", name)
+		require.Len(t, args, 2)
+		assert.Equal(t, "-k", args[0])
+		key, err := os.ReadFile(args[1])
+		require.NoError(t, err)
+		assert.Contains(t, string(key), `key "acme-key"`)
+		assert.Contains(t, string(key), "algorithm hmac-sha256;")
+		keyFiles = append(keyFiles, args[1])
+		scripts = append(scripts, stdin)
+		return nil, nil
+	}
+
+	id, err := provider.CreateRecord("example.com", "_acme-challenge.example.com.", "token")
+	require.NoError(t, err)
+	require.NoError(t, provider.DeleteRecord("example.com", id))
+	assert.Error(t, provider.DeleteRecord("example.com", id))
+
+	require.Len(t, scripts, 2)
+	assert.Equal(t, "server 127.0.0.1 5353\nzone example.com.\nupdate add _acme-challenge.example.com. 60 TXT \"token\"\nsend\n", scripts[0])
+	assert.Contains(t, scripts[1], "update delete _acme-challenge.example.com. TXT \"token\"\n")
+
+	// Key files are removed after each update
+	for _, f := range keyFiles {
+		assert.NoFileExists(t, f)
+	}
+
+	provider.run = func(stdin, name string, args ...string) ([]byte, error) {
+		return []byte("update failed: REFUSED"), fmt.Errorf("exit status 2")
+	}
+	_, err = provider.CreateRecord("example.com", "_acme-challenge.example.com.", "token")
+	assert.ErrorContains(t, err, "REFUSED")
+}
+
+func TestDigitalOceanRecords(t *testing.T) {
+	var created map[string]interface{}
+	var deletedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer do-token", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/domains":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"domains": []map[string]string{{"name": "example.com"}, {"name": "dev.example.com"}},
+			})
+		case r.Method == "POST" && r.URL.Path == "/domains/dev.example.com/records":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"domain_record": map[string]interface{}{"id": 42}})
+		case r.Method == "DELETE":
+			deletedPath = r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("DO_API_TOKEN", "do-token")
+	provider := NewDigitalOcean()
+	provider.baseURL = server.URL
+
+	id, err := provider.CreateRecord("api.dev.example.com", "_acme-challenge.api.dev.example.com.", "token")
+	require.NoError(t, err)
+	assert.Equal(t, "42", id)
+	assert.Equal(t, "_acme-challenge.api", created["name"])
+	assert.Equal(t, "token", created["data"])
+
+	require.NoError(t, provider.DeleteRecord("api.dev.example.com", id))
+	assert.Equal(t, "/domains/dev.example.com/records/42", deletedPath)
+
+	_, err = provider.CreateRecord("example.org", "_acme-challenge.example.org.", "token")
+	assert.Error(t, err)
+}
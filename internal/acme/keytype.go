@@ -0,0 +1,141 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// KeyType identifies the algorithm and size of a certificate private key
+type KeyType string
+
+const (
+	KeyTypeRSA2048 KeyType = "rsa2048"
+	KeyTypeRSA4096 KeyType = "rsa4096"
+	KeyTypeEC256   KeyType = "ec256"
+	KeyTypeEC384   KeyType = "ec384"
+)
+
+// DefaultKeyType is used when no key type is configured
+const DefaultKeyType = KeyTypeRSA2048
+
+// ParseKeyType parses a key type name such as rsa2048 or ec256
+func ParseKeyType(name string) (KeyType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "rsa", "rsa2048":
+		return KeyTypeRSA2048, nil
+	case "rsa4096":
+		return KeyTypeRSA4096, nil
+	case "ec", "ecdsa", "ec256", "p256", "p-256":
+		return KeyTypeEC256, nil
+	case "ec384", "p384", "p-384":
+		return KeyTypeEC384, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %q (expected rsa2048, rsa4096, ec256 or ec384)", name)
+	}
+}
+
+// IsECDSA reports whether the key type is an ECDSA key
+func (kt KeyType) IsECDSA() bool {
+	return kt == KeyTypeEC256 || kt == KeyTypeEC384
+}
+
+// DualKeyTypes returns the RSA and ECDSA key types used when both certificates
+// are held for a host. The configured key type selects the size of its own
+// family, the other family uses its default.
+func DualKeyTypes(kt KeyType) (KeyType, KeyType) {
+	if kt.IsECDSA() {
+		return KeyTypeRSA2048, kt
+	}
+	return kt, KeyTypeEC256
+}
+
+// GenerateKey generates a new private key of the given type
+func GenerateKey(kt KeyType) (crypto.Signer, error) {
+	switch kt {
+	case KeyTypeRSA2048, "":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyTypeEC256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeEC384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", kt)
+	}
+}
+
+// KeyTypeOf returns the key type of an existing private key
+func KeyTypeOf(key crypto.Signer) (KeyType, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		switch k.N.BitLen() {
+		case 2048:
+			return KeyTypeRSA2048, nil
+		case 4096:
+			return KeyTypeRSA4096, nil
+		}
+		return "", fmt.Errorf("unsupported RSA key size %d", k.N.BitLen())
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return KeyTypeEC256, nil
+		case elliptic.P384():
+			return KeyTypeEC384, nil
+		}
+		return "", fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// EncodePrivateKey encodes a private key as PEM. RSA keys keep the PKCS#1
+// encoding used by existing key files, ECDSA keys use SEC 1.
+func EncodePrivateKey(key crypto.Signer) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS#1, SEC 1 or PKCS#8 private key
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
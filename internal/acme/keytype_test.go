@@ -0,0 +1,92 @@
+package acme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyType(t *testing.T) {
+	cases := map[string]KeyType{
+		"":        KeyTypeRSA2048,
+		"RSA2048": KeyTypeRSA2048,
+		"rsa4096": KeyTypeRSA4096,
+		"ecdsa":   KeyTypeEC256,
+		"p-384":   KeyTypeEC384,
+	}
+	for input, want := range cases {
+		got, err := ParseKeyType(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	_, err := ParseKeyType("dsa")
+	assert.Error(t, err)
+}
+
+func TestDualKeyTypes(t *testing.T) {
+	rsaType, ecType := DualKeyTypes(KeyTypeRSA4096)
+	assert.Equal(t, KeyTypeRSA4096, rsaType)
+	assert.Equal(t, KeyTypeEC256, ecType)
+
+	rsaType, ecType = DualKeyTypes(KeyTypeEC384)
+	assert.Equal(t, KeyTypeRSA2048, rsaType)
+	assert.Equal(t, KeyTypeEC384, ecType)
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	for _, kt := range []KeyType{KeyTypeRSA2048, KeyTypeEC256, KeyTypeEC384} {
+		key, err := GenerateKey(kt)
+		require.NoError(t, err)
+		data, err := EncodePrivateKey(key)
+		require.NoError(t, err)
+
+		parsed, err := ParsePrivateKey(data)
+		require.NoError(t, err)
+		got, err := KeyTypeOf(parsed)
+		require.NoError(t, err)
+		assert.Equal(t, kt, got)
+	}
+}
+
+func TestCreateDomainKeyReplacesOtherKeyType(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "example.com.key")
+	a := NewACME("", "", keyPath, filepath.Join(dir, "example.com.crt"), "", []string{"example.com"}, false, false)
+
+	// New keys are moved into place with the certificate issued for them
+	require.NoError(t, a.createDomainKey())
+	_, err := os.Stat(keyPath)
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, a.saveCertificate([]byte("first")))
+	first, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+
+	// Same key type keeps the existing key
+	require.NoError(t, a.createDomainKey())
+	assert.Equal(t, keyPath, a.csrKeyPath())
+	again, _ := os.ReadFile(keyPath)
+	assert.Equal(t, first, again)
+
+	// A new key type leaves the current pair in place when the order fails
+	a.SetKeyType(KeyTypeEC256)
+	require.NoError(t, a.createDomainKey())
+	a.discardPendingKey()
+	current, _ := os.ReadFile(keyPath)
+	assert.Equal(t, first, current)
+	_, err = os.Stat(keyPath + ".new")
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, a.createDomainKey())
+	require.NoError(t, a.saveCertificate([]byte("second")))
+	data, _ := os.ReadFile(keyPath)
+	key, err := ParsePrivateKey(data)
+	require.NoError(t, err)
+	kt, _ := KeyTypeOf(key)
+	assert.Equal(t, KeyTypeEC256, kt)
+	cert, _ := os.ReadFile(a.certPath)
+	assert.Equal(t, "second", string(cert))
+}
@@ -0,0 +1,13 @@
+package acme
+
+// Logger receives the progress messages of ACME clients
+type Logger interface {
+	Info(format string, args ...interface{})
+	Warn(format string, args ...interface{})
+}
+
+// nopLogger discards messages, it is used until a logger is set
+type nopLogger struct{}
+
+func (nopLogger) Info(format string, args ...interface{}) {}
+func (nopLogger) Warn(format string, args ...interface{}) {}
@@ -6,53 +6,344 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Manager represents the ACME certificate manager
 type Manager struct {
-	apiURL       string
+	ca           CA  // Default CA
+	fallbackCA   *CA // CA retried when an issuance fails
 	challengeDir string
-	renewBefore  time.Duration
+	keyType      KeyType
+	dnsProvider  string
+	tlsALPNAddr  string
+	accountDir   string   // One account per CA directory is kept below it
+	accountLocks sync.Map // Account key path to the lock serializing its registration
+	logger       Logger
 	mu           sync.RWMutex
 }
 
 // NewManager creates a new ACME manager
 func NewManager(apiURL, challengeDir string) *Manager {
 	return &Manager{
-		apiURL:       apiURL,
+		ca:           CA{Name: apiURL, DirectoryURL: apiURL},
 		challengeDir: challengeDir,
-		renewBefore:  30 * 24 * time.Hour, // Renew 30 days before expiration
+		keyType:      DefaultKeyType,
+		logger:       nopLogger{},
 	}
 }
 
-// ObtainCertificate obtains a certificate for the specified domain
-func (m *Manager) ObtainCertificate(domain, certPath, keyPath, accountKeyPath string) error {
+// SetLogger sets the logger receiving the progress messages of ACME clients
+func (m *Manager) SetLogger(logger Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logger = logger
+}
+
+// SetCA sets the default CA
+func (m *Manager) SetCA(ca CA) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ca = ca
+}
+
+// CA returns the default CA
+func (m *Manager) CA() CA {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ca
+}
+
+// SetFallbackCA sets the CA a failed issuance is retried with
+func (m *Manager) SetFallbackCA(ca CA) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallbackCA = &ca
+}
+
+// SetKeyType sets the default key type for new domain keys
+func (m *Manager) SetKeyType(kt KeyType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keyType = kt
+}
+
+// SetDNSProvider selects the DNS provider used to solve DNS-01 challenges,
+// an empty name uses HTTP-01 challenges
+func (m *Manager) SetDNSProvider(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dnsProvider = name
+}
+
+// SetTLSALPN enables TLS-ALPN-01 challenges answered on addr. They become
+// the default challenge when no DNS provider is set.
+func (m *Manager) SetTLSALPN(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tlsALPNAddr = addr
+}
+
+// SetAccountDir keeps one ACME account per CA directory below dir, used by
+// requests without an account key of their own
+func (m *Manager) SetAccountDir(dir string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.accountDir = dir
+}
+
+// ObtainCertificate obtains a certificate for the specified domain
+func (m *Manager) ObtainCertificate(domain, certPath, keyPath, accountKeyPath string) error {
+	m.mu.RLock()
+	kt := m.keyType
+	m.mu.RUnlock()
+
+	return m.ObtainCertificateWithKeyType(domain, certPath, keyPath, accountKeyPath, kt)
+}
+
+// ObtainCertificateWithKeyType obtains a certificate whose key has the given type
+func (m *Manager) ObtainCertificateWithKeyType(domain, certPath, keyPath, accountKeyPath string, kt KeyType) error {
+	return m.ObtainCertificateForDomains([]string{domain}, certPath, keyPath, accountKeyPath, kt)
+}
+
+// ObtainCertificateForDomains obtains a single certificate covering all domains,
+// the first domain being the common name. Wildcard domains require DNS-01.
+func (m *Manager) ObtainCertificateForDomains(domains []string, certPath, keyPath, accountKeyPath string, kt KeyType) error {
+	return m.ObtainCertificateWithChallenge(domains, certPath, keyPath, accountKeyPath, kt, "")
+}
+
+// ObtainCertificateWithChallenge obtains a certificate covering all domains
+// using the given challenge type, an empty type selecting the default
+func (m *Manager) ObtainCertificateWithChallenge(domains []string, certPath, keyPath, accountKeyPath string, kt KeyType, challenge ChallengeType) error {
+	_, err := m.Obtain(CertificateRequest{
+		Domains:        domains,
+		CertPath:       certPath,
+		KeyPath:        keyPath,
+		AccountKeyPath: accountKeyPath,
+		KeyType:        kt,
+		Challenge:      challenge,
+	})
+	return err
+}
+
+// CertificateRequest describes a certificate to obtain
+type CertificateRequest struct {
+	Domains        []string // The first domain is the common name
+	CertPath       string
+	KeyPath        string
+	AccountKeyPath string // Empty uses the shared account of the CA
+	KeyType        KeyType
+	Challenge      ChallengeType // Empty selects the default challenge
+	CA             string        // CA name or directory URL, empty for the default CA
+}
+
+// Obtain obtains a certificate from the requested CA, retrying with the
+// fallback CA when that fails. It returns the CA that issued the certificate.
+func (m *Manager) Obtain(req CertificateRequest) (CA, error) {
+	// The clients are set up under the lock and talk to the CAs without it,
+	// so a slow CA does not hold up other requests
+	m.mu.RLock()
+	challenge, err := m.resolveChallenge(req.Domains, req.Challenge)
+	if err != nil {
+		m.mu.RUnlock()
+		return CA{}, err
+	}
+	ca, err := m.resolveCA(req.CA)
+	if err != nil {
+		m.mu.RUnlock()
+		return CA{}, err
+	}
+	client := m.newRequestClient(ca, req, challenge)
+	var fallbackCA CA
+	var fallbackClient *ACMEv2
+	if m.fallbackCA != nil && m.fallbackCA.DirectoryURL != ca.DirectoryURL {
+		fallbackCA = *m.fallbackCA
+		fallbackClient = m.newRequestClient(fallbackCA, req, challenge)
+	}
+	logger := m.logger
+	m.mu.RUnlock()
+
+	err = obtainFrom(ca, client)
+	if err == nil {
+		return ca, nil
+	}
+	if fallbackClient == nil {
+		return CA{}, err
+	}
+
+	logger.Warn("Failed to obtain certificate for %s from %s, trying %s: %v",
+		strings.Join(req.Domains, ", "), ca.Name, fallbackCA.Name, err)
+	if fallbackErr := obtainFrom(fallbackCA, fallbackClient); fallbackErr != nil {
+		return CA{}, fmt.Errorf("%v; fallback CA %s: %v", err, fallbackCA.Name, fallbackErr)
+	}
+	return fallbackCA, nil
+}
+
+// resolveCA returns the CA given by name or directory URL, empty selecting the
+// default CA. The fallback CA is found by its name as well.
+func (m *Manager) resolveCA(name string) (CA, error) {
+	if name == "" || name == m.ca.Name {
+		return m.ca, nil
+	}
+	if m.fallbackCA != nil && name == m.fallbackCA.Name {
+		return *m.fallbackCA, nil
+	}
+	return CAFromEnv(name)
+}
+
+// obtainFrom obtains the certificate of client from ca
+func obtainFrom(ca CA, client *ACMEv2) error {
+	if err := client.GetCertificate(); err != nil {
+		return fmt.Errorf("failed to obtain certificate from %s: %v", ca.Name, err)
+	}
+	return nil
+}
+
+// newRequestClient creates an ACME client obtaining req from ca with the given
+// challenge. The caller must hold m.mu.
+func (m *Manager) newRequestClient(ca CA, req CertificateRequest, challenge ChallengeType) *ACMEv2 {
+	client := m.newClient(ca, req)
+	client.SetKeyType(req.KeyType)
+	client.SetChallenge(challenge, m.tlsALPNAddr)
+	return client
+}
+
+// newClient creates an ACME client for ca. Requests without an account key
+// use the shared account of the CA.
+func (m *Manager) newClient(ca CA, req CertificateRequest) *ACMEv2 {
+	accountKeyPath := req.AccountKeyPath
+	accountFile := ""
+	if accountKeyPath == "" {
+		accountKeyPath, accountFile = AccountPaths(m.accountDir, ca.DirectoryURL)
+	}
 
-	// Create ACME client for this request
 	acme := NewACMEv2(
-		m.apiURL,
+		ca.DirectoryURL,
 		accountKeyPath,
-		keyPath,
-		certPath,
+		req.KeyPath,
+		req.CertPath,
 		m.challengeDir,
-		[]string{domain},
+		req.Domains,
 		false, // debug
 		false, // skipReload
-		"",    // dnsProvider
+		m.dnsProvider,
 	)
+	acme.SetAccount(ca.Email, ca.EABKeyID, ca.EABHMACKey)
+	acme.SetAccountFile(accountFile)
+	acme.SetLogger(m.logger)
+	if accountFile != "" {
+		// Requests sharing an account register it one at a time
+		lock, _ := m.accountLocks.LoadOrStore(accountKeyPath, &sync.Mutex{})
+		acme.accountMu = lock.(*sync.Mutex)
+	}
+	return acme
+}
+
+// RenewalInfo fetches the renewal window suggested for cert by the CA that
+// issued it, given by name or directory URL
+func (m *Manager) RenewalInfo(caName string, cert *x509.Certificate) (*RenewalInfo, error) {
+	m.mu.RLock()
+	ca, err := m.resolveCA(caName)
+	if err != nil {
+		m.mu.RUnlock()
+		return nil, err
+	}
+	client := m.newClient(ca, CertificateRequest{})
+	m.mu.RUnlock()
+
+	return client.GetRenewalInfo(cert)
+}
 
-	// Get the certificate
-	if err := acme.GetCertificate(); err != nil {
-		return fmt.Errorf("failed to obtain certificate: %v", err)
+// RolloverAccountKey replaces the key of the shared account of a CA, given by
+// name or directory URL
+func (m *Manager) RolloverAccountKey(caName string) error {
+	m.mu.RLock()
+	ca, err := m.resolveCA(caName)
+	if err != nil {
+		m.mu.RUnlock()
+		return err
 	}
+	client := m.newClient(ca, CertificateRequest{})
+	m.mu.RUnlock()
 
+	if err := client.RolloverAccountKey(); err != nil {
+		return fmt.Errorf("%s: %v", ca.Name, err)
+	}
 	return nil
 }
 
+// DeactivateAccount deactivates the shared account of a CA, given by name or
+// directory URL. A new account is registered with the next request.
+func (m *Manager) DeactivateAccount(caName string) error {
+	m.mu.RLock()
+	ca, err := m.resolveCA(caName)
+	if err != nil {
+		m.mu.RUnlock()
+		return err
+	}
+	client := m.newClient(ca, CertificateRequest{})
+	m.mu.RUnlock()
+
+	if err := client.DeactivateAccount(); err != nil {
+		return fmt.Errorf("%s: %v", ca.Name, err)
+	}
+	return nil
+}
+
+// RevokeCertificate revokes cert with the CA that issued it, given by name or
+// directory URL, using the shared account of the CA
+func (m *Manager) RevokeCertificate(caName string, cert *x509.Certificate, reason int) error {
+	m.mu.RLock()
+	ca, err := m.resolveCA(caName)
+	if err != nil {
+		m.mu.RUnlock()
+		return err
+	}
+	client := m.newClient(ca, CertificateRequest{})
+	m.mu.RUnlock()
+
+	if err := client.RevokeCertificate(cert, reason); err != nil {
+		return fmt.Errorf("%s: %v", ca.Name, err)
+	}
+	return nil
+}
+
+// resolveChallenge picks the challenge type used for domains. DNS-01 is the
+// default when a DNS provider is set, then TLS-ALPN-01 when enabled, then
+// HTTP-01. Wildcard domains can only be validated with DNS-01.
+func (m *Manager) resolveChallenge(domains []string, challenge ChallengeType) (ChallengeType, error) {
+	for _, domain := range domains {
+		if strings.HasPrefix(domain, "*.") {
+			if m.dnsProvider == "" {
+				return "", fmt.Errorf("wildcard certificate for %s requires a DNS provider (ACME_DNS_PROVIDER)", domain)
+			}
+			return ChallengeDNS01, nil
+		}
+	}
+
+	switch challenge {
+	case "":
+		switch {
+		case m.dnsProvider != "":
+			return ChallengeDNS01, nil
+		case m.tlsALPNAddr != "":
+			return ChallengeTLSALPN01, nil
+		}
+		return ChallengeHTTP01, nil
+	case ChallengeDNS01:
+		if m.dnsProvider == "" {
+			return "", fmt.Errorf("DNS-01 challenge requires a DNS provider (ACME_DNS_PROVIDER)")
+		}
+	case ChallengeTLSALPN01:
+		if m.tlsALPNAddr == "" {
+			return "", fmt.Errorf("TLS-ALPN-01 challenge for %s requires the TLS-ALPN-01 responder (ACME_TLS_ALPN)", strings.Join(domains, ", "))
+		}
+	}
+	return challenge, nil
+}
+
 // CertificateManager manages SSL certificates
 type CertificateManager struct {
 	acme        *ACMEv2
@@ -0,0 +1,63 @@
+package acme
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Revocation reasons accepted by ACME CAs (RFC 5280 section 5.3.1)
+var revocationReasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+}
+
+// ParseRevocationReason returns the reason code of a revocation reason name,
+// compared case-insensitively
+func ParseRevocationReason(name string) (int, error) {
+	for reason, code := range revocationReasons {
+		if strings.EqualFold(reason, name) {
+			return code, nil
+		}
+	}
+
+	names := make([]string, 0, len(revocationReasons))
+	for reason := range revocationReasons {
+		names = append(names, reason)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("unsupported revocation reason %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// RevokeCertificate asks the CA to revoke cert, which must have been issued to
+// the account (RFC 8555 section 7.6)
+func (a *ACMEv2) RevokeCertificate(cert *x509.Certificate, reason int) error {
+	if err := a.RegisterAccount(); err != nil {
+		return err
+	}
+	revokeURL, _ := a.directory["revokeCert"].(string)
+	if revokeURL == "" {
+		return fmt.Errorf("the CA does not support revocation")
+	}
+
+	resp, err := a.postSigned(revokeURL, map[string]interface{}{
+		"certificate": a.b64(cert.Raw),
+		"reason":      reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke certificate: %v", err)
+	}
+	if resp.code != http.StatusOK {
+		// Revoking again is not an error
+		if strings.Contains(string(resp.body), "urn:ietf:params:acme:error:alreadyRevoked") {
+			return nil
+		}
+		return fmt.Errorf("failed to revoke certificate: %d %s", resp.code, string(resp.body))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package acme
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRevocationReason(t *testing.T) {
+	reason, err := ParseRevocationReason("keyCompromise")
+	require.NoError(t, err)
+	assert.Equal(t, 1, reason)
+
+	reason, err = ParseRevocationReason("superseded")
+	require.NoError(t, err)
+	assert.Equal(t, 4, reason)
+
+	reason, err = ParseRevocationReason("CessationOfOperation")
+	require.NoError(t, err)
+	assert.Equal(t, 5, reason)
+
+	// certificateHold is not accepted by ACME CAs
+	_, err = ParseRevocationReason("certificateHold")
+	assert.Error(t, err)
+}
+
+func TestRevokeCertificate(t *testing.T) {
+	challengeDir := t.TempDir()
+	server := newTestACMEServer(t, challengeDir, "")
+	server.issueAtOnce = true
+	dir := t.TempDir()
+
+	a := newTestAccountClient(t, server, dir)
+	require.NoError(t, a.GetCertificate())
+	cert := readTestCertificate(t, a.certPath)
+
+	a = newTestAccountClient(t, server, dir)
+	require.NoError(t, a.RevokeCertificate(cert, 4))
+	assert.Equal(t, map[string]int{cert.SerialNumber.String(): 4}, server.revoked)
+	assert.Equal(t, 1, server.registered)
+
+	// Revoking again succeeds
+	require.NoError(t, a.RevokeCertificate(cert, 4))
+}
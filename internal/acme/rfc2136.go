@@ -0,0 +1,174 @@
+package acme
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func init() {
+	RegisterDNSProvider("rfc2136", func() (DNSProvider, error) {
+		return NewRFC2136()
+	})
+}
+
+// CommandRunner runs a command with the given standard input and returns its
+// combined output
+type CommandRunner func(stdin string, name string, args ...string) ([]byte, error)
+
+// runCommand runs a command with os/exec
+func runCommand(stdin string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	return cmd.CombinedOutput()
+}
+
+// rfc2136Record is a TXT record created through a dynamic update
+type rfc2136Record struct {
+	name  string
+	value string
+}
+
+// RFC2136 is a DNS provider using dynamic updates (RFC 2136) signed with TSIG,
+// sent with nsupdate
+type RFC2136 struct {
+	nameserver string // host:port of the primary nameserver
+	zone       string // Optional zone, nsupdate finds it from the SOA otherwise
+	tsigName   string
+	tsigSecret string
+	tsigAlg    string
+	ttl        int
+	run        CommandRunner
+	records    map[string]rfc2136Record
+	nextID     int
+	mu         sync.Mutex
+}
+
+// NewRFC2136 creates an RFC 2136 provider from RFC2136_NAMESERVER, RFC2136_ZONE,
+// RFC2136_TSIG_KEY, RFC2136_TSIG_SECRET, RFC2136_TSIG_ALGORITHM and RFC2136_TTL
+func NewRFC2136() (*RFC2136, error) {
+	nameserver := os.Getenv("RFC2136_NAMESERVER")
+	if nameserver == "" {
+		return nil, fmt.Errorf("RFC2136_NAMESERVER is not set")
+	}
+
+	r := &RFC2136{
+		nameserver: withDefaultPort(nameserver, "53"),
+		zone:       strings.TrimSuffix(os.Getenv("RFC2136_ZONE"), "."),
+		tsigName:   os.Getenv("RFC2136_TSIG_KEY"),
+		tsigSecret: os.Getenv("RFC2136_TSIG_SECRET"),
+		tsigAlg:    os.Getenv("RFC2136_TSIG_ALGORITHM"),
+		ttl:        60,
+		run:        runCommand,
+		records:    make(map[string]rfc2136Record),
+	}
+	if r.tsigAlg == "" {
+		r.tsigAlg = "hmac-sha256"
+	}
+	if ttl, err := strconv.Atoi(os.Getenv("RFC2136_TTL")); err == nil && ttl > 0 {
+		r.ttl = ttl
+	}
+	if (r.tsigName == "") != (r.tsigSecret == "") {
+		return nil, fmt.Errorf("RFC2136_TSIG_KEY and RFC2136_TSIG_SECRET must be set together")
+	}
+	return r, nil
+}
+
+// Nameservers returns the nameserver receiving the updates, which is the
+// first to serve new records
+func (r *RFC2136) Nameservers() []string {
+	return []string{r.nameserver}
+}
+
+// CreateRecord adds a TXT record with a dynamic update
+func (r *RFC2136) CreateRecord(domain, name, value string) (string, error) {
+	fqdn := toFQDN(name)
+	if err := r.update(fmt.Sprintf("update add %s %d TXT %s", fqdn, r.ttl, strconv.Quote(value))); err != nil {
+		return "", fmt.Errorf("failed to create record: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	recordID := strconv.Itoa(r.nextID)
+	r.records[recordID] = rfc2136Record{name: fqdn, value: value}
+	return recordID, nil
+}
+
+// DeleteRecord removes the TXT record, leaving other values of the name intact
+func (r *RFC2136) DeleteRecord(domain, recordID string) error {
+	r.mu.Lock()
+	record, ok := r.records[recordID]
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown record %s", recordID)
+	}
+
+	if err := r.update(fmt.Sprintf("update delete %s TXT %s", record.name, strconv.Quote(record.value))); err != nil {
+		return fmt.Errorf("failed to delete record: %v", err)
+	}
+
+	r.mu.Lock()
+	delete(r.records, recordID)
+	r.mu.Unlock()
+	return nil
+}
+
+// update sends a single update instruction with nsupdate. The TSIG key is passed
+// in a temporary key file so the secret does not show up in the process list.
+func (r *RFC2136) update(instruction string) error {
+	host, port, err := net.SplitHostPort(r.nameserver)
+	if err != nil {
+		return fmt.Errorf("invalid nameserver %s: %v", r.nameserver, err)
+	}
+
+	var script bytes.Buffer
+	fmt.Fprintf(&script, "server %s %s\n", host, port)
+	if r.zone != "" {
+		fmt.Fprintf(&script, "zone %s.\n", r.zone)
+	}
+	fmt.Fprintf(&script, "%s\nsend\n", instruction)
+
+	var args []string
+	if r.tsigName != "" {
+		keyFile, err := r.writeKeyFile()
+		if err != nil {
+			return err
+		}
+		defer os.Remove(keyFile)
+		args = append(args, "-k", keyFile)
+	}
+
+	output, err := r.run(script.String(), "nsupdate", args...)
+	if err != nil {
+		return fmt.Errorf("nsupdate failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// writeKeyFile writes the TSIG key in named.conf syntax to a temporary file
+func (r *RFC2136) writeKeyFile() (string, error) {
+	f, err := os.CreateTemp("", "tsig-*.key")
+	if err != nil {
+		return "", fmt.Errorf("failed to create TSIG key file: %v", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "key %s {\n\talgorithm %s;\n\tsecret %s;\n};\n",
+		strconv.Quote(r.tsigName), r.tsigAlg, strconv.Quote(r.tsigSecret))
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write TSIG key file: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// toFQDN returns name as a fully qualified domain name with a trailing dot
+func toFQDN(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
@@ -0,0 +1,184 @@
+package acme
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ACMETLS1Protocol is the ALPN protocol negotiated for TLS-ALPN-01 validation
+const ACMETLS1Protocol = "acme-tls/1"
+
+// idPeACMEIdentifier is the certificate extension holding the key
+// authorization digest (RFC 8737)
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// TLSALPNResponder answers TLS-ALPN-01 validation connections with a
+// certificate holding the key authorization digest of the requested domain.
+// nginx routes connections offering acme-tls/1 to it, prefixed with a PROXY
+// protocol header which is skipped.
+type TLSALPNResponder struct {
+	listener net.Listener
+	certs    map[string]*tls.Certificate
+	mu       sync.RWMutex
+	wg       sync.WaitGroup
+}
+
+// ListenTLSALPN starts a TLS-ALPN-01 responder on addr
+func ListenTLSALPN(addr string) (*TLSALPNResponder, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for TLS-ALPN-01 challenges on %s: %v", addr, err)
+	}
+
+	r := &TLSALPNResponder{
+		listener: listener,
+		certs:    make(map[string]*tls.Certificate),
+	}
+	r.wg.Add(1)
+	go r.serve()
+	return r, nil
+}
+
+// Addr returns the address the responder listens on
+func (r *TLSALPNResponder) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// SetChallenge serves the validation certificate of domain for keyAuth
+func (r *TLSALPNResponder) SetChallenge(domain, keyAuth string) error {
+	cert, err := newTLSALPNCertificate(domain, keyAuth)
+	if err != nil {
+		return fmt.Errorf("failed to create TLS-ALPN-01 certificate for %s: %v", domain, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certs[strings.ToLower(domain)] = cert
+	return nil
+}
+
+// Close stops the responder and waits for open connections to finish
+func (r *TLSALPNResponder) Close() error {
+	err := r.listener.Close()
+	r.wg.Wait()
+	return err
+}
+
+// serve accepts validation connections until the listener is closed
+func (r *TLSALPNResponder) serve() {
+	defer r.wg.Done()
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{ACMETLS1Protocol},
+		GetCertificate: r.getCertificate,
+	}
+
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer conn.Close()
+
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			tlsConn := tls.Server(skipProxyHeader(conn), config)
+			if err := tlsConn.Handshake(); err == nil {
+				tlsConn.Close()
+			}
+		}()
+	}
+}
+
+// getCertificate returns the validation certificate of the requested domain.
+// Only validation connections negotiating acme-tls/1 are answered.
+func (r *TLSALPNResponder) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if !slices.Contains(hello.SupportedProtos, ACMETLS1Protocol) {
+		return nil, fmt.Errorf("client does not offer %s", ACMETLS1Protocol)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cert, ok := r.certs[strings.ToLower(hello.ServerName)]
+	if !ok {
+		return nil, fmt.Errorf("no TLS-ALPN-01 challenge for %q", hello.ServerName)
+	}
+	return cert, nil
+}
+
+// newTLSALPNCertificate creates the self-signed validation certificate for
+// domain, carrying the SHA-256 digest of keyAuth in a critical acmeIdentifier
+// extension
+func newTLSALPNCertificate(domain, keyAuth string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(keyAuth))
+	value, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: idPeACMEIdentifier, Critical: true, Value: value},
+		},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// proxyHeaderConn is a connection whose leading PROXY protocol header has been
+// consumed
+type proxyHeaderConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *proxyHeaderConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// skipProxyHeader consumes a PROXY protocol v1 header sent ahead of the TLS
+// handshake, if there is one
+func skipProxyHeader(conn net.Conn) net.Conn {
+	reader := bufio.NewReader(conn)
+	if prefix, err := reader.Peek(6); err == nil && string(prefix) == "PROXY " {
+		reader.ReadString('\n')
+	}
+	return &proxyHeaderConn{Conn: conn, reader: reader}
+}
@@ -0,0 +1,85 @@
+package acme
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSALPNResponder(t *testing.T) {
+	responder, err := ListenTLSALPN("127.0.0.1:0")
+	require.NoError(t, err)
+	defer responder.Close()
+	addr := responder.Addr().String()
+
+	require.NoError(t, responder.SetChallenge("Example.com", "token.thumbprint"))
+	assert.NoError(t, verifyTLSALPN(addr, "example.com", "token.thumbprint"))
+	assert.Error(t, verifyTLSALPN(addr, "example.com", "other.thumbprint"))
+	assert.Error(t, verifyTLSALPN(addr, "www.example.com", "token.thumbprint"))
+
+	// Regular TLS clients are not answered
+	_, err = tls.Dial("tcp", addr, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+	assert.Error(t, err)
+}
+
+func TestTLSALPNResponderSkipsProxyHeader(t *testing.T) {
+	responder, err := ListenTLSALPN("127.0.0.1:0")
+	require.NoError(t, err)
+	defer responder.Close()
+	require.NoError(t, responder.SetChallenge("example.com", "token.thumbprint"))
+
+	conn, err := net.DialTimeout("tcp", responder.Addr().String(), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("PROXY TCP4 203.0.113.7 127.0.0.1 51234 443\r\n"))
+	require.NoError(t, err)
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         "example.com",
+		NextProtos:         []string{ACMETLS1Protocol},
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, tlsConn.Handshake())
+	assert.Equal(t, ACMETLS1Protocol, tlsConn.ConnectionState().NegotiatedProtocol)
+}
+
+func TestParseChallengeType(t *testing.T) {
+	cases := map[string]ChallengeType{
+		"http-01":     ChallengeHTTP01,
+		"TLS-ALPN-01": ChallengeTLSALPN01,
+		" dns ":       ChallengeDNS01,
+	}
+	for input, want := range cases {
+		got, err := ParseChallengeType(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	_, err := ParseChallengeType("tls-sni-01")
+	assert.Error(t, err)
+}
+
+func TestResolveChallenge(t *testing.T) {
+	m := NewManager("", "")
+	challenge, err := m.resolveChallenge([]string{"example.com"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, ChallengeHTTP01, challenge)
+
+	// TLS-ALPN-01 is only used once a responder address is set
+	_, err = m.resolveChallenge([]string{"example.com"}, ChallengeTLSALPN01)
+	assert.ErrorContains(t, err, "example.com")
+
+	m.SetTLSALPN("127.0.0.1:5001")
+	challenge, err = m.resolveChallenge([]string{"example.com"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, ChallengeTLSALPN01, challenge)
+
+	_, err = m.resolveChallenge([]string{"example.com"}, ChallengeDNS01)
+	assert.Error(t, err)
+	_, err = m.resolveChallenge([]string{"*.example.com"}, ChallengeTLSALPN01)
+	assert.Error(t, err)
+}
@@ -2,11 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
 )
 
 // Config represents the application configuration
@@ -17,6 +19,8 @@ type Config struct {
 	SSLDir            string
 	ClientMaxBodySize string
 	DefaultServer     bool
+	ListenAddresses   []string // From LISTEN_ADDRESSES: addresses servers bind to, empty to bind to all
+	DualStack         bool     // From DUAL_STACK: listen on [::] as well as the IPv4 addresses
 
 	// Basic auth configuration
 	BasicAuthEnabled bool
@@ -27,10 +31,66 @@ type Config struct {
 	DebugPort    int
 	DebugHost    string
 
+	// Container address configuration
+	AddressFamily        string   // From ADDRESS_FAMILY: ipv4 or ipv6, preferred for containers having both
+	NetworkAddressFamily []string // From NETWORK_ADDRESS_FAMILY: network=ipv4 or network=ipv6 overrides
+
+	// Upstream DNS configuration
+	UpstreamDNS bool   // From UPSTREAM_DNS: proxy to containers by their DNS name, resolved at runtime
+	DNSResolver string // From DNS_RESOLVER: resolver of the DNS names, Docker's embedded DNS server by default
+
 	// IP filtering / trusted proxy configuration
 	TrustedProxyIPs []string // From TRUSTED_PROXY_IPS
 	RealIPHeader    string   // From REAL_IP_HEADER
 	RealIPRecursive string   // From REAL_IP_RECURSIVE (default "on")
+
+	// PROXY protocol configuration
+	ProxyProtocol    bool     // From PROXY_PROTOCOL: accept the PROXY protocol on all listeners
+	ProxyProtocolIPs []string // From PROXY_PROTOCOL_TRUSTED_IPS: load balancers trusted to send client addresses
+
+	// Backend TLS configuration
+	BackendTLSVerify bool // From BACKEND_TLS_VERIFY: verify https/grpcs backends by default
+
+	// Certificate key configuration
+	SSLKeyType  string // From SSL_KEY_TYPE: rsa2048, rsa4096, ec256 or ec384
+	SSLDualCert bool   // From SSL_DUAL_CERT: hold both an RSA and an ECDSA certificate
+	SSLMode     string // From SSL_MODE: acme, or local-ca for certificates of a local development CA
+
+	// ACME configuration
+	ACMEDNSProvider  string   // From ACME_DNS_PROVIDER: solve DNS-01 challenges with this provider
+	WildcardDomains  []string // From WILDCARD_DOMAINS: issue *.domain certificates shared by subdomains
+	ACMETLSALPN      bool     // From ACME_TLS_ALPN: answer TLS-ALPN-01 challenges on port 443
+	ACMETLSALPNAddr  string   // From ACME_TLS_ALPN_ADDR: address of the TLS-ALPN-01 responder
+	HTTPSBackendAddr string   // Address HTTPS servers listen on when port 443 is fronted by the stream module
+	PassthroughAddr  string   // Address of the stream relay passing TLS through to containers by server name
+	ACMECA           string   // From ACME_CA or LETSENCRYPT_API: name or directory URL of the default CA
+	ACMEStaging      bool     // From ACME_STAGING: use the Let's Encrypt staging CA unless ACME_CA is set
+	ACMEEmail        string   // From ACME_EMAIL: contact address of the ACME accounts
+	ACMEEABKeyID     string   // From ACME_EAB_KID: External Account Binding key ID for the default CA
+	ACMEEABHMACKey   string   // From ACME_EAB_HMAC_KEY: External Account Binding MAC key for the default CA
+	ACMEFallbackCA   string   // From ACME_FALLBACK_CA: CA retried when an issuance fails
+
+	// TLS policy configuration
+	TLSProfile        string // From TLS_PROFILE: modern, intermediate or old
+	TLSProtocols      string // From TLS_PROTOCOLS, overrides the profile
+	TLSCiphers        string // From TLS_CIPHERS, overrides the profile
+	TLSECDHCurves     string // From TLS_ECDH_CURVES, overrides the profile
+	TLSSessionCache   string // From TLS_SESSION_CACHE
+	TLSSessionTimeout string // From TLS_SESSION_TIMEOUT, overrides the profile
+	TLSSessionTickets bool   // From TLS_SESSION_TICKETS
+	DHParamFile       string // From DHPARAM_FILE
+	DHParamSize       int    // From DHPARAM_SIZE
+	OCSPStapling      bool   // From OCSP_STAPLING: staple cached OCSP responses
+	HTTP3             bool   // From HTTP3: serve SSL hosts over HTTP/3 (QUIC) as well
+
+	// Certificate notification configuration
+	NotifyWebhookURL      string // From NOTIFY_WEBHOOK_URL: receives events as JSON
+	NotifySlackWebhookURL string // From NOTIFY_SLACK_WEBHOOK_URL: receives events as Slack messages
+	NotifyExpiryDays      int    // From NOTIFY_EXPIRY_DAYS: warn this many days before a certificate expires
+	NotifyFailures        int    // From NOTIFY_FAILURES: alert after this many failed issuances in a row
+
+	// Status server configuration
+	StatusAddr string // From STATUS_ADDR, empty disables the status server
 }
 
 // ValidationError represents a configuration validation error
@@ -52,6 +112,8 @@ func NewConfig() *Config {
 		SSLDir:            getEnv("SSL_DIR", "./ssl"),
 		ClientMaxBodySize: getEnv("CLIENT_MAX_BODY_SIZE", constants.DefaultClientMaxBodySize),
 		DefaultServer:     getEnvBool("DEFAULT_HOST", true),
+		ListenAddresses:   parseCommaSeparated(os.Getenv("LISTEN_ADDRESSES")),
+		DualStack:         getEnvBool("DUAL_STACK", false),
 
 		// Basic auth configuration
 		BasicAuthEnabled: false,
@@ -62,10 +124,73 @@ func NewConfig() *Config {
 		DebugPort:    getEnvInt("GO_DEBUG_PORT", constants.DefaultDebugPort),
 		DebugHost:    getEnv("GO_DEBUG_HOST", ""),
 
+		// Container addresses
+		AddressFamily:        getEnv("ADDRESS_FAMILY", "ipv4"),
+		NetworkAddressFamily: parseCommaSeparated(os.Getenv("NETWORK_ADDRESS_FAMILY")),
+
+		// Upstream DNS
+		UpstreamDNS: getEnvBool("UPSTREAM_DNS", false),
+		DNSResolver: getEnv("DNS_RESOLVER", constants.DefaultDNSResolver),
+
 		// IP filtering / trusted proxy
 		TrustedProxyIPs: parseCommaSeparated(os.Getenv("TRUSTED_PROXY_IPS")),
 		RealIPHeader:    getEnv("REAL_IP_HEADER", ""),
 		RealIPRecursive: getEnv("REAL_IP_RECURSIVE", "on"),
+
+		// PROXY protocol
+		ProxyProtocol:    getEnvBool("PROXY_PROTOCOL", false),
+		ProxyProtocolIPs: parseCommaSeparated(os.Getenv("PROXY_PROTOCOL_TRUSTED_IPS")),
+
+		// Backend TLS
+		BackendTLSVerify: getEnvBool("BACKEND_TLS_VERIFY", false),
+
+		// Certificate keys
+		SSLKeyType:  getEnv("SSL_KEY_TYPE", constants.DefaultSSLKeyType),
+		SSLDualCert: getEnvBool("SSL_DUAL_CERT", false),
+		SSLMode:     getEnv("SSL_MODE", constants.SSLModeACME),
+
+		// ACME
+		ACMEDNSProvider:  getEnv("ACME_DNS_PROVIDER", ""),
+		WildcardDomains:  parseCommaSeparated(getEnv("WILDCARD_DOMAINS", "")),
+		ACMETLSALPN:      getEnvBool("ACME_TLS_ALPN", false),
+		ACMETLSALPNAddr:  getEnv("ACME_TLS_ALPN_ADDR", constants.DefaultACMETLSALPNAddr),
+		HTTPSBackendAddr: constants.HTTPSBackendAddr,
+		PassthroughAddr:  constants.PassthroughAddr,
+		ACMECA:           getEnv("ACME_CA", getEnv("LETSENCRYPT_API", "")),
+		ACMEStaging:      getEnvBool("ACME_STAGING", false),
+		ACMEEmail:        getEnv("ACME_EMAIL", ""),
+		ACMEEABKeyID:     getEnv("ACME_EAB_KID", ""),
+		ACMEEABHMACKey:   getEnv("ACME_EAB_HMAC_KEY", ""),
+		ACMEFallbackCA:   getEnv("ACME_FALLBACK_CA", ""),
+
+		// TLS policy
+		TLSProfile:        getEnv("TLS_PROFILE", constants.DefaultTLSProfile),
+		TLSProtocols:      getEnv("TLS_PROTOCOLS", ""),
+		TLSCiphers:        getEnv("TLS_CIPHERS", ""),
+		TLSECDHCurves:     getEnv("TLS_ECDH_CURVES", ""),
+		TLSSessionCache:   getEnv("TLS_SESSION_CACHE", constants.DefaultTLSSessionCache),
+		TLSSessionTimeout: getEnv("TLS_SESSION_TIMEOUT", ""),
+		TLSSessionTickets: getEnvBool("TLS_SESSION_TICKETS", false),
+		DHParamFile:       getEnv("DHPARAM_FILE", constants.DefaultDHParamFile),
+		DHParamSize:       getEnvInt("DHPARAM_SIZE", constants.DefaultDHParamSize),
+		OCSPStapling:      getEnvBool("OCSP_STAPLING", true),
+		HTTP3:             getEnvBool("HTTP3", false),
+
+		// Certificate notifications
+		NotifyWebhookURL:      getEnv("NOTIFY_WEBHOOK_URL", ""),
+		NotifySlackWebhookURL: getEnv("NOTIFY_SLACK_WEBHOOK_URL", ""),
+		NotifyExpiryDays:      getEnvInt("NOTIFY_EXPIRY_DAYS", constants.DefaultNotifyExpiryDays),
+		NotifyFailures:        getEnvInt("NOTIFY_FAILURES", constants.DefaultNotifyFailures),
+
+		// Status server
+		StatusAddr: getEnv("STATUS_ADDR", constants.DefaultStatusAddr),
+	}
+
+	if cfg.ACMECA == "" {
+		cfg.ACMECA = constants.DefaultACMECA
+		if cfg.ACMEStaging {
+			cfg.ACMECA = constants.StagingACMECA
+		}
 	}
 
 	// Ensure directories end with a slash
@@ -76,6 +201,15 @@ func NewConfig() *Config {
 	return cfg
 }
 
+// HTTPSBackendPort returns the port of HTTPSBackendAddr
+func (c *Config) HTTPSBackendPort() string {
+	_, port, err := net.SplitHostPort(c.HTTPSBackendAddr)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
 // Validate validates the configuration and returns an error if invalid
 func (c *Config) Validate() error {
 	// Validate debug port
@@ -110,6 +244,44 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Validate the TLS-ALPN-01 responder address
+	if c.ACMETLSALPN {
+		if _, _, err := net.SplitHostPort(c.ACMETLSALPNAddr); err != nil {
+			return &ValidationError{
+				Field:   "ACMETLSALPNAddr",
+				Message: fmt.Sprintf("invalid address: %v", err),
+			}
+		}
+	}
+
+	// Validate the addresses servers bind to
+	if _, err := host.ParseListenAddresses(strings.Join(c.ListenAddresses, ",")); err != nil {
+		return &ValidationError{
+			Field:   "ListenAddresses",
+			Message: err.Error(),
+		}
+	}
+
+	// Validate the load balancers trusted to send the PROXY protocol. Without
+	// any, every client would appear with the address of the load balancer.
+	if c.ProxyProtocol && len(c.ProxyProtocolIPs) == 0 {
+		return &ValidationError{
+			Field:   "ProxyProtocolIPs",
+			Message: "PROXY_PROTOCOL requires PROXY_PROTOCOL_TRUSTED_IPS",
+		}
+	}
+	for _, ip := range c.ProxyProtocolIPs {
+		if net.ParseIP(ip) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return &ValidationError{
+				Field:   "ProxyProtocolIPs",
+				Message: fmt.Sprintf("invalid IP or CIDR %q", ip),
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -95,6 +95,32 @@ func TestEnsureTrailingSlash(t *testing.T) {
 	}
 }
 
+func TestNewConfigACMECA(t *testing.T) {
+	for _, key := range []string{"ACME_CA", "LETSENCRYPT_API", "ACME_STAGING"} {
+		t.Setenv(key, "") // Restored after the test
+		os.Unsetenv(key)
+	}
+
+	if cfg := NewConfig(); cfg.ACMECA != constants.DefaultACMECA {
+		t.Fatalf("ACMECA: expected %s, got %s", constants.DefaultACMECA, cfg.ACMECA)
+	}
+
+	t.Setenv("ACME_STAGING", "true")
+	if cfg := NewConfig(); cfg.ACMECA != constants.StagingACMECA {
+		t.Fatalf("ACMECA: expected %s with ACME_STAGING, got %s", constants.StagingACMECA, cfg.ACMECA)
+	}
+
+	// LETSENCRYPT_API is still honoured, ACME_CA takes precedence
+	t.Setenv("LETSENCRYPT_API", "https://ca.internal/acme/directory")
+	if cfg := NewConfig(); cfg.ACMECA != "https://ca.internal/acme/directory" {
+		t.Fatalf("ACMECA: expected LETSENCRYPT_API, got %s", cfg.ACMECA)
+	}
+	t.Setenv("ACME_CA", "zerossl")
+	if cfg := NewConfig(); cfg.ACMECA != "zerossl" {
+		t.Fatalf("ACMECA: expected zerossl, got %s", cfg.ACMECA)
+	}
+}
+
 func clearEnv(t *testing.T) {
 	t.Helper()
 	keys := []string{
@@ -178,6 +204,55 @@ func TestConfigValidate(t *testing.T) {
 			wantError:  true,
 			errorField: "ClientMaxBodySize",
 		},
+		{
+			name: "invalid PROXY protocol load balancer",
+			setupFunc: func() *Config {
+				tmpDir := t.TempDir()
+				return &Config{
+					ConfDir:           filepath.Join(tmpDir, "nginx") + "/",
+					ChallengeDir:      filepath.Join(tmpDir, "challenges") + "/",
+					SSLDir:            filepath.Join(tmpDir, "ssl") + "/",
+					ClientMaxBodySize: "1m",
+					DebugPort:         2345,
+					ProxyProtocol:     true,
+					ProxyProtocolIPs:  []string{"10.0.0.0/8", "lb.example.com"},
+				}
+			},
+			wantError:  true,
+			errorField: "ProxyProtocolIPs",
+		},
+		{
+			name: "PROXY protocol without trusted load balancers",
+			setupFunc: func() *Config {
+				tmpDir := t.TempDir()
+				return &Config{
+					ConfDir:           filepath.Join(tmpDir, "nginx") + "/",
+					ChallengeDir:      filepath.Join(tmpDir, "challenges") + "/",
+					SSLDir:            filepath.Join(tmpDir, "ssl") + "/",
+					ClientMaxBodySize: "1m",
+					DebugPort:         2345,
+					ProxyProtocol:     true,
+				}
+			},
+			wantError:  true,
+			errorField: "ProxyProtocolIPs",
+		},
+		{
+			name: "invalid listen address",
+			setupFunc: func() *Config {
+				tmpDir := t.TempDir()
+				return &Config{
+					ConfDir:           filepath.Join(tmpDir, "nginx") + "/",
+					ChallengeDir:      filepath.Join(tmpDir, "challenges") + "/",
+					SSLDir:            filepath.Join(tmpDir, "ssl") + "/",
+					ClientMaxBodySize: "1m",
+					DebugPort:         2345,
+					ListenAddresses:   []string{"0.0.0.0", "eth0"},
+				}
+			},
+			wantError:  true,
+			errorField: "ListenAddresses",
+		},
 	}
 
 	for _, tt := range tests {
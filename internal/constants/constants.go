@@ -17,13 +17,31 @@ const (
 	CertificateRenewalThreshold  = 7 * 24 * time.Hour  // Renew 7 days before expiry
 	CertificateCheckInterval     = 24 * time.Hour      // Check certificates daily
 	MinCertificateValidityDays   = 2                   // Minimum days before considering invalid
+	CertificateRetryInitial      = time.Hour           // Delay after a failed issuance, doubled on every failure
+	CertificateRetryMax          = 24 * time.Hour      // Longest delay between issuance attempts
+	DefaultClientVerifyDepth     = 1                   // ssl_verify_depth for client certificates
+	DefaultTLSProfile            = "intermediate"
+	DefaultTLSSessionCache       = "shared:SSL:50m"
+	DefaultDHParamFile           = "/etc/nginx/dhparam/dhparam.pem"
+	DefaultSSLKeyType            = "rsa2048"
+	SSLModeACME                  = "acme"      // Certificates are obtained from an ACME CA
+	SSLModeLocalCA               = "local-ca"  // Certificates are issued by a local development CA
+	LocalCARootLifetime          = 10 * 365 * 24 * time.Hour
+	LocalCALeafLifetime          = 7 * 24 * time.Hour  // Renewed once a third of it remains
+	DefaultNotifyExpiryDays      = 14                  // Warn when a certificate expires within this many days
+	DefaultNotifyFailures        = 3                   // Alert after this many failed issuances in a row
 )
 
 // ACME/Let's Encrypt
 const (
 	LetsEncryptProductionAPI = "https://acme-v02.api.letsencrypt.org/directory"
 	LetsEncryptStagingAPI    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	DefaultACMECA            = "letsencrypt"         // Name of the default CA
+	StagingACMECA            = "letsencrypt-staging" // Name of the CA used with ACME_STAGING
 	ACMETimeout              = 30 * time.Second
+	DefaultACMETLSALPNAddr   = "127.0.0.1:5001"  // TLS-ALPN-01 responder
+	HTTPSBackendAddr         = "127.0.0.1:10443" // HTTPS servers behind the stream front on port 443
+	PassthroughAddr          = "127.0.0.1:10445" // Relay passing TLS through to containers by server name
 )
 
 // Nginx configuration
@@ -38,6 +56,11 @@ const (
 	DefaultDebugPort = 2345
 )
 
+// Status server
+const (
+	DefaultStatusAddr = "127.0.0.1:8081"
+)
+
 // Event processing
 const (
 	EventChannelBufferSize = 100
@@ -66,7 +89,22 @@ const (
 	PrivateKeyPermissions = 0600
 )
 
+// Docker secrets
+const (
+	DockerSecretsDir = "/run/secrets"
+)
+
+// System CA bundle used when verifying backends without a custom CA
+const (
+	SystemCABundle = "/etc/ssl/certs/ca-certificates.crt"
+)
+
 // Default network
 const (
 	DefaultNetworkName = "frontend"
 )
+
+// Docker's embedded DNS server, reachable from containers on user-defined networks
+const (
+	DefaultDNSResolver = "127.0.0.11"
+)
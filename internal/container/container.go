@@ -40,7 +40,7 @@ func GetEnvMap(container types.ContainerJSON) map[string]string {
 func parseEnvironment(labels map[string]string) map[string]string {
 	env := make(map[string]string)
 	for k, v := range labels {
-		if strings.HasPrefix(k, "VIRTUAL_HOST") || strings.HasPrefix(k, "STATIC_VIRTUAL_HOST") || k == "PROXY_BASIC_AUTH" || k == "PROXY_TRUSTED_IPS" || k == "PROXY_REAL_IP_HEADER" {
+		if strings.HasPrefix(k, "VIRTUAL_HOST") || strings.HasPrefix(k, "STATIC_VIRTUAL_HOST") || k == "PROXY_BASIC_AUTH" || k == "PROXY_TRUSTED_IPS" || k == "PROXY_REAL_IP_HEADER" || strings.HasPrefix(k, "PROXY_CLIENT_") || strings.HasPrefix(k, "PROXY_BACKEND_TLS_") || strings.HasPrefix(k, "PROXY_TLS_") || k == "LETSENCRYPT_HOST" || k == "LETSENCRYPT_CHALLENGE" || k == "LETSENCRYPT_CA" {
 			env[k] = v
 		}
 	}
@@ -56,13 +56,19 @@ func getNetworks(networkSettings *types.NetworkSettings) []string {
 	return networks
 }
 
-// getIPAddress returns the IP address of the container
+// getIPAddress returns the IPv4 address of the container on one of its
+// networks, or its IPv6 address when no network gives it an IPv4 address
 func getIPAddress(networkSettings *types.NetworkSettings) string {
 	for _, network := range networkSettings.Networks {
 		if network.IPAddress != "" {
 			return network.IPAddress
 		}
 	}
+	for _, network := range networkSettings.Networks {
+		if network.GlobalIPv6Address != "" {
+			return network.GlobalIPv6Address
+		}
+	}
 	return ""
 }
 
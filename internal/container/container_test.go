@@ -235,6 +235,17 @@ func TestGetIPAddress(t *testing.T) {
 			},
 			expectedIP: "",
 		},
+		{
+			name: "IPv6-only network",
+			settings: &types.NetworkSettings{
+				Networks: map[string]*network.EndpointSettings{
+					"frontend": {
+						GlobalIPv6Address: "fd00:20::10",
+					},
+				},
+			},
+			expectedIP: "fd00:20::10",
+		},
 		{
 			name: "empty networks",
 			settings: &types.NetworkSettings{
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CertificateStatusProvider reports certificates on disk that were rejected
+// keyed by certificate name
+type CertificateStatusProvider interface {
+	CertificateErrors() map[string]string
+}
+
+// CertificateChecker checks that the certificates on disk can be served
+type CertificateChecker struct {
+	provider CertificateStatusProvider
+}
+
+// NewCertificateChecker creates a new certificate health checker
+func NewCertificateChecker(provider CertificateStatusProvider) *CertificateChecker {
+	return &CertificateChecker{
+		provider: provider,
+	}
+}
+
+// Check performs the certificate health check
+func (c *CertificateChecker) Check() Check {
+	start := time.Now()
+
+	rejected := c.provider.CertificateErrors()
+
+	latency := time.Since(start)
+
+	if len(rejected) > 0 {
+		names := make([]string, 0, len(rejected))
+		for name := range rejected {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		messages := make([]string, 0, len(names))
+		for _, name := range names {
+			messages = append(messages, fmt.Sprintf("%s: %s", name, rejected[name]))
+		}
+		return Check{
+			Name:    "certificates",
+			Status:  StatusDegraded,
+			Message: "Certificates rejected: " + strings.Join(messages, "; "),
+			Latency: latency,
+		}
+	}
+
+	return Check{
+		Name:    "certificates",
+		Status:  StatusHealthy,
+		Message: "Certificates on disk are valid",
+		Latency: latency,
+	}
+}
@@ -0,0 +1,60 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OCSPStatusProvider reports OCSP response refresh failures keyed by certificate
+type OCSPStatusProvider interface {
+	OCSPFailures() map[string]string
+}
+
+// OCSPChecker checks that OCSP responses for stapling are being refreshed
+type OCSPChecker struct {
+	provider OCSPStatusProvider
+}
+
+// NewOCSPChecker creates a new OCSP stapling health checker
+func NewOCSPChecker(provider OCSPStatusProvider) *OCSPChecker {
+	return &OCSPChecker{
+		provider: provider,
+	}
+}
+
+// Check performs the OCSP stapling health check
+func (c *OCSPChecker) Check() Check {
+	start := time.Now()
+
+	failures := c.provider.OCSPFailures()
+
+	latency := time.Since(start)
+
+	if len(failures) > 0 {
+		names := make([]string, 0, len(failures))
+		for name := range failures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		messages := make([]string, 0, len(names))
+		for _, name := range names {
+			messages = append(messages, fmt.Sprintf("%s: %s", name, failures[name]))
+		}
+		return Check{
+			Name:    "ocsp",
+			Status:  StatusDegraded,
+			Message: "OCSP refresh failed for " + strings.Join(messages, "; "),
+			Latency: latency,
+		}
+	}
+
+	return Check{
+		Name:    "ocsp",
+		Status:  StatusHealthy,
+		Message: "OCSP responses are up to date",
+		Latency: latency,
+	}
+}
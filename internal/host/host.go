@@ -3,6 +3,8 @@ package host
 import (
 	"fmt"
 	"log"
+	"net"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -13,6 +15,7 @@ type Host struct {
 	Port             int
 	SSLEnabled       bool
 	SSLFile          string
+	SSLAltFile       string // ECDSA certificate served alongside the RSA certificate in SSLFile
 	IsRedirect       bool
 	RedirectHostname string
 	IsDown           bool
@@ -31,6 +34,20 @@ type Host struct {
 	DenyAll          bool
 	RealIPHeader     string
 	RealIPRecursive  string
+	RealIPFrom       []string // CIDR ranges trusted to send the real IP header
+	ClientCAFile     string // CA bundle for verifying client certificates (mTLS)
+	ClientVerify     string // ssl_verify_client mode: on or optional
+	ClientDepth      int
+	ClientHeaders    bool       // Forward client certificate subject/fingerprint to backends
+	TLSPolicy        *TLSPolicy // Per-host TLS policy, nil to use the global policy
+	OCSPStapleFile   string     // Cached OCSP response for ssl_stapling_file, empty to disable stapling
+	CertDomains      []string   // Hostnames sharing one SAN certificate, the first naming it
+	ACMEChallenge    string     // ACME challenge type used for the certificate, empty for the default
+	ACMECA           string     // Name or directory URL of the CA issuing the certificate, empty for the default
+	HTTP3            bool       // Serve the host over HTTP/3 as well when nginx supports it
+	HTTP3Listen      bool       // Listen for QUIC connections, set when the configuration is rendered
+	HTTP3ReusePort   bool       // Carry reuseport on the QUIC listen, which nginx allows once per port
+	ListenAddrs      []string   // Addresses the servers of the host bind to, empty to bind to all
 }
 
 // Upstream represents a group of backend servers
@@ -41,11 +58,13 @@ type Upstream struct {
 
 // Container represents a container that serves a location
 type Container struct {
-	ID      string
-	Address string
-	Port    int
-	Scheme  string
-	Path    string
+	ID            string
+	Address       string
+	Port          int
+	Scheme        string
+	Path          string
+	ProxyProtocol bool   // Send the PROXY protocol header to the container, streams only
+	DNSName       string // Name resolved at runtime to reach the container instead of Address
 }
 
 // Location represents a location block in nginx configuration
@@ -65,6 +84,16 @@ type Location struct {
 	Extras           *ExtrasMap
 	Containers       map[string]*Container // Map of container ID to Container
 	UpstreamEnabled  bool                  // Whether this location uses upstream
+	BackendTLS       *BackendTLS           // TLS settings for https/grpcs backends
+}
+
+// BackendTLS represents TLS settings for connections from nginx to a backend
+type BackendTLS struct {
+	Verify     bool
+	TrustedCA  string
+	ServerName string // SNI name, also used for certificate verification
+	ClientCert string // Client certificate presented to the backend (mTLS)
+	ClientKey  string
 }
 
 // NewHost creates a new Host instance
@@ -183,6 +212,56 @@ func (h *Host) AddLocation(path string, container *Container, extras map[string]
 	location.HTTP = isHTTP
 }
 
+// ContainerHostPort returns the address and port of the location's primary
+// container, with an IPv6 address in brackets
+func (l *Location) ContainerHostPort() string {
+	return net.JoinHostPort(l.ContainerAddress, strconv.Itoa(l.ContainerPort))
+}
+
+// DNSTarget returns the name and port nginx resolves at runtime to reach the
+// location's containers, empty unless all of them share one DNS name and port.
+// Replicas behind one name are balanced by DNS.
+func (l *Location) DNSTarget() string {
+	target := ""
+	for _, c := range l.Containers {
+		if c.DNSName == "" {
+			return ""
+		}
+		t := net.JoinHostPort(c.DNSName, strconv.Itoa(c.Port))
+		if target != "" && t != target {
+			return ""
+		}
+		target = t
+	}
+	return target
+}
+
+// DNSRewrite returns the rewrite directive mapping the location path to the
+// container path when proxying to a DNS target. proxy_pass does not replace
+// the location path when its address is a variable.
+func (l *Location) DNSRewrite() string {
+	if l.ContainerPath == "" || l.ContainerPath == l.Path {
+		return ""
+	}
+	return fmt.Sprintf(`rewrite "^%s(.*)$" "%s$1" break;`, regexp.QuoteMeta(l.Path), l.ContainerPath)
+}
+
+// UsesDNS reports whether any location of the host proxies to a DNS target
+func (h *Host) UsesDNS() bool {
+	for _, l := range h.Locations {
+		if l.DNSTarget() != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HostPort returns the address and port of the container, with an IPv6
+// address in brackets
+func (c *Container) HostPort() string {
+	return net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
+}
+
 // UpdateExtras updates the location's extras with new values
 func (l *Location) UpdateExtras(extras map[string]interface{}) {
 	extrasMap := make(map[string]string)
@@ -254,6 +333,57 @@ func (h *Host) SetIPFilter(allowedIPs []string, denyAll bool, realIPHeader, real
 	h.DenyAll = denyAll
 	h.RealIPHeader = realIPHeader
 	h.RealIPRecursive = realIPRecursive
+	h.RealIPFrom = allowedIPs
+}
+
+// SetClientAuth configures mutual TLS client certificate verification for the host
+func (h *Host) SetClientAuth(caFile, verify string, depth int, forwardHeaders bool) {
+	h.ClientCAFile = caFile
+	h.ClientVerify = verify
+	h.ClientDepth = depth
+	h.ClientHeaders = forwardHeaders
+}
+
+// SetBackendTLS applies backend TLS settings to every location proxying to a TLS scheme
+func (h *Host) SetBackendTLS(tls *BackendTLS) {
+	for _, loc := range h.Locations {
+		if loc.Scheme == "https" || loc.Scheme == "grpcs" {
+			loc.BackendTLS = tls
+		}
+	}
+}
+
+// SetTLSPolicy overrides the global TLS policy for the host
+func (h *Host) SetTLSPolicy(policy *TLSPolicy) {
+	h.TLSPolicy = policy
+}
+
+// SetOCSPStapleFile sets the cached OCSP response stapled for the host certificate
+func (h *Host) SetOCSPStapleFile(path string) {
+	h.OCSPStapleFile = path
+}
+
+// SetCertDomains sets the hostnames of the SAN certificate the host is served with
+func (h *Host) SetCertDomains(domains []string) {
+	h.CertDomains = domains
+}
+
+// SetACMEChallenge sets the ACME challenge type used to validate the host
+func (h *Host) SetACMEChallenge(challenge string) {
+	h.ACMEChallenge = challenge
+}
+
+// SetACMECA sets the CA the certificate of the host is obtained from
+func (h *Host) SetACMECA(ca string) {
+	h.ACMECA = ca
+}
+
+// CertificateName returns the name of the certificate issued for the host
+func (h *Host) CertificateName() string {
+	if len(h.CertDomains) > 0 {
+		return h.CertDomains[0]
+	}
+	return h.Hostname
 }
 
 // AddInjectedConfig adds an injected configuration line to a location
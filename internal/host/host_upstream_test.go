@@ -196,3 +196,50 @@ func TestContainerRemovalUpdatesUpstream(t *testing.T) {
 		t.Fatal("UpstreamEnabled should still be true with 2 containers")
 	}
 }
+
+// TestLocationDNSTarget verifies that a location proxies by DNS name only when
+// all of its containers share one name and port
+func TestLocationDNSTarget(t *testing.T) {
+	h := NewHost("example.com", 80)
+	h.AddLocation("/", &Container{ID: "c1", Address: "172.17.0.2", Port: 8080, DNSName: "web"}, map[string]string{})
+	h.AddLocation("/", &Container{ID: "c2", Address: "172.17.0.3", Port: 8080, DNSName: "web"}, map[string]string{})
+	location := h.Locations["/"]
+
+	if target := location.DNSTarget(); target != "web:8080" {
+		t.Fatalf("expected DNS target web:8080, got %q", target)
+	}
+	if !h.UsesDNS() {
+		t.Fatal("expected host to use DNS")
+	}
+
+	// A container without a name falls back to addresses
+	h.AddLocation("/", &Container{ID: "c3", Address: "172.17.0.4", Port: 8080}, map[string]string{})
+	if target := location.DNSTarget(); target != "" {
+		t.Fatalf("expected no DNS target, got %q", target)
+	}
+	if h.UsesDNS() {
+		t.Fatal("expected host not to use DNS")
+	}
+
+	// So do containers with different names
+	location.Containers["c3"].DNSName = "worker"
+	if target := location.DNSTarget(); target != "" {
+		t.Fatalf("expected no DNS target, got %q", target)
+	}
+}
+
+// TestLocationDNSRewrite verifies that the location path is mapped to the
+// container path when proxying to a DNS target
+func TestLocationDNSRewrite(t *testing.T) {
+	h := NewHost("example.com", 80)
+	h.AddLocation("/api", &Container{ID: "c1", Port: 8080, Path: "/v1", DNSName: "api"}, map[string]string{})
+	h.AddLocation("/", &Container{ID: "c2", Port: 8080, DNSName: "web"}, map[string]string{})
+
+	expected := `rewrite "^/api(.*)$" "/v1$1" break;`
+	if rewrite := h.Locations["/api"].DNSRewrite(); rewrite != expected {
+		t.Fatalf("expected %s, got %s", expected, rewrite)
+	}
+	if rewrite := h.Locations["/"].DNSRewrite(); rewrite != "" {
+		t.Fatalf("expected no rewrite, got %s", rewrite)
+	}
+}
@@ -0,0 +1,118 @@
+package host
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseListenAddresses parses a comma-separated list of addresses servers bind
+// to, such as 0.0.0.0, [::] or a specific IP. IPv6 addresses are returned in
+// brackets, as nginx expects them in listen directives.
+func ParseListenAddresses(list string) ([]string, error) {
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		address := part
+		if address != "*" {
+			ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(part, "["), "]"))
+			if ip == nil {
+				return nil, fmt.Errorf("invalid listen address %q", part)
+			}
+			address = ip.String()
+			if ip.To4() == nil {
+				address = "[" + address + "]"
+			}
+		}
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
+
+// listenOn returns the address:port parameters of listen directives for the
+// port on the addresses, the bare port when no address is set
+func listenOn(addresses []string, port int) []string {
+	if len(addresses) == 0 {
+		return []string{strconv.Itoa(port)}
+	}
+	listens := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		listens = append(listens, address+":"+strconv.Itoa(port))
+	}
+	return listens
+}
+
+// Listen returns the parameters of the listen directives of the host's
+// servers on the port, one per listen address
+func (h *Host) Listen(port int) []string {
+	return listenOn(h.ListenAddrs, port)
+}
+
+// DefaultServer is a catch-all server answering requests for names no host
+// serves on one listen address and port
+type DefaultServer struct {
+	Listen  string // Parameters of the listen directive
+	SSL     bool
+	Fronted bool // Listens behind the stream front on port 443
+}
+
+// DefaultServers returns the catch-all servers for every address and port the
+// hosts listen on, sorted by port and address. Ports 80 and 443 always get one
+// on the default addresses; listens a host is the default server of are left
+// out. With a front the SSL servers of port 443 listen behind it instead.
+func DefaultServers(hosts []*Host, addresses []string, front bool) []*DefaultServer {
+	type listen struct {
+		port    int
+		address string
+	}
+	ssl := make(map[listen]bool)
+	taken := make(map[listen]bool)
+	add := func(port int, isSSL bool, listenAddrs []string, isDefault bool) {
+		fronted := front && isSSL && port == 443
+		for _, address := range listenOn(listenAddrs, port) {
+			l := listen{port: port, address: address}
+			if fronted {
+				l.address = ""
+			}
+			ssl[l] = ssl[l] || isSSL
+			taken[l] = taken[l] || isDefault
+		}
+	}
+
+	add(80, false, addresses, false)
+	add(443, true, addresses, false)
+	for _, h := range hosts {
+		add(h.Port, h.SSLEnabled, h.ListenAddrs, h.IsDefaultServer)
+		if h.SSLEnabled && h.SSLRedirect {
+			add(80, false, h.ListenAddrs, h.IsDefaultServer)
+		}
+	}
+
+	sorted := make([]listen, 0, len(ssl))
+	for l := range ssl {
+		if !taken[l] {
+			sorted = append(sorted, l)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].port != sorted[j].port {
+			return sorted[i].port < sorted[j].port
+		}
+		return sorted[i].address < sorted[j].address
+	})
+
+	servers := make([]*DefaultServer, 0, len(sorted))
+	for _, l := range sorted {
+		servers = append(servers, &DefaultServer{Listen: l.address, SSL: ssl[l], Fronted: l.address == ""})
+	}
+	return servers
+}
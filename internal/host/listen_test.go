@@ -0,0 +1,77 @@
+package host
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseListenAddresses(t *testing.T) {
+	addresses, err := ParseListenAddresses(" 0.0.0.0, ::, [2001:db8::1], 192.168.1.10, 0.0.0.0")
+	if err != nil {
+		t.Fatalf("ParseListenAddresses error: %v", err)
+	}
+	expected := []string{"0.0.0.0", "[::]", "[2001:db8::1]", "192.168.1.10"}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("expected %v, got %v", expected, addresses)
+	}
+
+	if addresses, err := ParseListenAddresses(""); err != nil || len(addresses) != 0 {
+		t.Fatalf("expected no addresses, got %v %v", addresses, err)
+	}
+	if _, err := ParseListenAddresses("0.0.0.0,eth0"); err == nil {
+		t.Fatalf("expected error for interface name")
+	}
+}
+
+func TestDefaultServers(t *testing.T) {
+	app := NewHost("app.example.com", 8443)
+	app.SSLEnabled = true
+	app.ListenAddrs = []string{"192.168.1.10", "[::]"}
+	site := NewHost("site.example.com", 443)
+	site.SSLEnabled = true
+	site.SSLRedirect = true
+	site.ListenAddrs = []string{"192.168.1.10"}
+	api := NewHost("api.example.com", 8080)
+	api.IsDefaultServer = true
+
+	servers := DefaultServers([]*Host{app, site, api}, nil, false)
+	expected := []DefaultServer{
+		{Listen: "192.168.1.10:80"},
+		{Listen: "80"},
+		{Listen: "192.168.1.10:443", SSL: true},
+		{Listen: "443", SSL: true},
+		{Listen: "192.168.1.10:8443", SSL: true},
+		{Listen: "[::]:8443", SSL: true},
+	}
+	if len(servers) != len(expected) {
+		t.Fatalf("expected %d default servers, got %d", len(expected), len(servers))
+	}
+	for i, want := range expected {
+		if *servers[i] != want {
+			t.Fatalf("default server %d: expected %+v, got %+v", i, want, *servers[i])
+		}
+	}
+
+	// SSL servers of port 443 listen behind the front
+	servers = DefaultServers([]*Host{site}, []string{"0.0.0.0"}, true)
+	if len(servers) != 3 || !servers[2].Fronted || !servers[2].SSL {
+		t.Fatalf("expected fronted default server for port 443, got %+v", servers)
+	}
+}
+
+func TestContainerHostPort(t *testing.T) {
+	for address, expected := range map[string]string{
+		"172.20.0.10": "172.20.0.10:8080",
+		"fd00:20::10": "[fd00:20::10]:8080",
+	} {
+		c := &Container{ID: "c", Address: address, Port: 8080}
+		if c.HostPort() != expected {
+			t.Fatalf("expected %s, got %s", expected, c.HostPort())
+		}
+		h := NewHost("app.example.com", 80)
+		h.AddLocation("/", c, nil)
+		if h.Locations["/"].ContainerHostPort() != expected {
+			t.Fatalf("expected location to proxy to %s, got %s", expected, h.Locations["/"].ContainerHostPort())
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package host
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stream protocols
+const (
+	StreamTCP = "tcp" // Raw TCP, routed by the TLS server name when the stream has a hostname
+	StreamUDP = "udp" // Raw UDP datagrams
+	StreamTLS = "tls" // TCP with TLS terminated by nginx using the certificate of the hostname
+)
+
+// PassthroughScheme is the VIRTUAL_HOST scheme of hosts terminating TLS
+// themselves. They are TCP streams on port 443 routed by server name.
+const PassthroughScheme = "tls-passthrough"
+
+// IsPassthroughVirtualHost reports whether a VIRTUAL_HOST passes TLS through
+// to the container
+func IsPassthroughVirtualHost(virtualHost string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(virtualHost)), PassthroughScheme+"://")
+}
+
+// VirtualStreamConfig represents a parsed VIRTUAL_STREAM
+type VirtualStreamConfig struct {
+	Protocol      string
+	Hostname      string // Server name routed on, empty to take every connection on the port
+	ListenPort    int
+	ContainerPort int
+}
+
+// ParseVirtualStream parses a VIRTUAL_STREAM environment variable, or a
+// tls-passthrough VIRTUAL_HOST whose port defaults to 443
+// Format: protocol://[hostname]:port [-> :port]
+func ParseVirtualStream(virtualStream string) (*VirtualStreamConfig, error) {
+	mainParts := strings.Split(virtualStream, "->")
+	if len(mainParts) > 2 {
+		return nil, fmt.Errorf("invalid VIRTUAL_STREAM format: %s", virtualStream)
+	}
+
+	protocol, address, ok := strings.Cut(strings.TrimSpace(mainParts[0]), "://")
+	if !ok {
+		return nil, fmt.Errorf("missing protocol in VIRTUAL_STREAM: %s", virtualStream)
+	}
+	protocol = strings.ToLower(protocol)
+	passthrough := protocol == PassthroughScheme
+	if passthrough {
+		protocol = StreamTCP
+	}
+	if protocol != StreamTCP && protocol != StreamUDP && protocol != StreamTLS {
+		return nil, fmt.Errorf("unknown protocol %q in VIRTUAL_STREAM, expected tcp, udp or tls", protocol)
+	}
+
+	hostname, port, ok := strings.Cut(address, ":")
+	if !ok && passthrough {
+		port = "443"
+	} else if !ok {
+		return nil, fmt.Errorf("missing port in VIRTUAL_STREAM: %s", virtualStream)
+	}
+	listenPort, err := parseStreamPort(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in VIRTUAL_STREAM: %s", virtualStream)
+	}
+
+	config := &VirtualStreamConfig{
+		Protocol:      protocol,
+		Hostname:      strings.ToLower(strings.TrimSuffix(hostname, ".")),
+		ListenPort:    listenPort,
+		ContainerPort: listenPort,
+	}
+	switch {
+	case config.Protocol == StreamUDP && config.Hostname != "":
+		return nil, fmt.Errorf("UDP streams cannot be routed by hostname: %s", virtualStream)
+	case config.Protocol == StreamTLS && config.Hostname == "":
+		return nil, fmt.Errorf("TLS streams need a hostname for their certificate: %s", virtualStream)
+	case passthrough && config.Hostname == "":
+		return nil, fmt.Errorf("TLS passthrough needs a hostname to route on: %s", virtualStream)
+	}
+
+	if len(mainParts) > 1 {
+		internalPart := strings.TrimSpace(mainParts[1])
+		if !strings.HasPrefix(internalPart, ":") {
+			return nil, fmt.Errorf("invalid container port in VIRTUAL_STREAM: %s", virtualStream)
+		}
+		config.ContainerPort, err = parseStreamPort(internalPart[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid container port in VIRTUAL_STREAM: %s", virtualStream)
+		}
+	}
+
+	return config, nil
+}
+
+// parseStreamPort parses a TCP or UDP port number
+func parseStreamPort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// NewStream creates a host for a stream, whose Scheme is the stream protocol
+// and whose root location holds the containers it is proxied to
+func NewStream(protocol, hostname string, port int) *Host {
+	h := NewHost(hostname, port)
+	h.Scheme = protocol
+	h.OriginalScheme = protocol
+	if protocol == StreamTLS {
+		h.SSLEnabled = true
+		h.SSLFile = hostname
+	}
+	return h
+}
+
+// StreamKey identifies a stream by its protocol, port and hostname
+func StreamKey(protocol, hostname string, port int) string {
+	return fmt.Sprintf("%s:%d:%s", protocol, port, hostname)
+}
+
+// Transport returns the transport protocol nginx listens with for the stream
+func (h *Host) Transport() string {
+	if h.Scheme == StreamUDP {
+		return StreamUDP
+	}
+	return StreamTCP
+}
+
+// BuildStreamUpstream replaces the upstreams of a stream with one holding all
+// of its containers
+func (h *Host) BuildStreamUpstream() {
+	h.Upstreams = make([]*Upstream, 0, 1)
+	location := h.Locations["/"]
+	if location == nil || location.IsEmpty() {
+		return
+	}
+
+	name := h.Hostname
+	if name == "" {
+		name = "any"
+	}
+	id := fmt.Sprintf("stream-%s-%d-%s", h.Scheme, h.Port, strings.ReplaceAll(name, "*", "_"))
+	location.Upstream = id
+	location.UpstreamEnabled = true
+
+	containers := location.GetContainers()
+	sort.Slice(containers, func(i, j int) bool { return containers[i].ID < containers[j].ID })
+	h.AddUpstream(id, containers)
+}
+
+// StreamServer is a port nginx listens on for streams
+type StreamServer struct {
+	Protocol  string // Protocol of the streams on the port
+	Port      int
+	Hosts     []*Host  // Streams on the port, sorted by hostname
+	Addresses []string // Addresses the server binds to, empty to bind to all
+}
+
+// Listen returns the parameters of the listen directive of the server
+func (s *StreamServer) Listen() string {
+	if s.Protocol == StreamUDP {
+		return fmt.Sprintf("%d udp", s.Port)
+	}
+	return strconv.Itoa(s.Port)
+}
+
+// Listens returns the parameters of the listen directives of the server, one
+// per address it binds to
+func (s *StreamServer) Listens() []string {
+	listens := listenOn(s.Addresses, s.Port)
+	if s.Protocol == StreamUDP {
+		for i := range listens {
+			listens[i] += " udp"
+		}
+	}
+	return listens
+}
+
+// Routed reports whether connections are routed to streams by the server name
+// the client sends in its TLS ClientHello
+func (s *StreamServer) Routed() bool {
+	if s.Protocol != StreamTCP {
+		return false
+	}
+	for _, h := range s.Hosts {
+		if h.Hostname != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Variable returns the name of the variable holding the upstream of a
+// connection to a routed server
+func (s *StreamServer) Variable() string {
+	return fmt.Sprintf("$stream_%s_%d", s.Protocol, s.Port)
+}
+
+// Default returns the stream taking connections no other stream on the port
+// is routed to, nil if there is none
+func (s *StreamServer) Default() *Host {
+	for _, h := range s.Hosts {
+		if h.Hostname == "" {
+			return h
+		}
+	}
+	return nil
+}
+
+// SendProxyProtocol reports whether connections are passed to the containers
+// of a TCP server with a PROXY protocol header, which every container of every
+// stream on the port must ask for since nginx sends it per server
+func (s *StreamServer) SendProxyProtocol() bool {
+	if s.Protocol == StreamUDP {
+		return false
+	}
+	send, _ := proxyProtocolContainers(s.Hosts)
+	return send
+}
+
+// MixedProxyProtocol reports whether only some containers of the server ask
+// for the PROXY protocol, in which case none get it
+func (s *StreamServer) MixedProxyProtocol() bool {
+	_, mixed := proxyProtocolContainers(s.Hosts)
+	return mixed
+}
+
+// proxyProtocolContainers reports whether all containers of the streams ask for
+// the PROXY protocol, and whether only some of them do
+func proxyProtocolContainers(streams []*Host) (all, mixed bool) {
+	want, total := 0, 0
+	for _, h := range streams {
+		for _, upstream := range h.Upstreams {
+			for _, c := range upstream.Containers {
+				total++
+				if c.ProxyProtocol {
+					want++
+				}
+			}
+		}
+	}
+	return total > 0 && want == total, want > 0 && want < total
+}
+
+// StreamServers groups streams with containers by the port they listen on,
+// sorted by protocol and port. A TCP port is taken by the protocol of its first
+// stream, and a TLS port by a single hostname since nginx terminates TLS with
+// one certificate per port; streams that do not fit are returned as conflicts.
+func StreamServers(streams []*Host) ([]*StreamServer, []*Host) {
+	sorted := make([]*Host, 0, len(streams))
+	for _, h := range streams {
+		if len(h.Upstreams) > 0 {
+			sorted = append(sorted, h)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Scheme != b.Scheme {
+			return a.Scheme < b.Scheme
+		}
+		return a.Hostname < b.Hostname
+	})
+
+	byListen := make(map[string]*StreamServer)
+	var servers []*StreamServer
+	var conflicts []*Host
+	for _, h := range sorted {
+		listen := fmt.Sprintf("%s:%d", h.Transport(), h.Port)
+		server := byListen[listen]
+		if server == nil {
+			server = &StreamServer{Protocol: h.Scheme, Port: h.Port}
+			byListen[listen] = server
+			servers = append(servers, server)
+		} else if server.Protocol != h.Scheme || h.Scheme == StreamTLS {
+			conflicts = append(conflicts, h)
+			continue
+		}
+		server.Hosts = append(server.Hosts, h)
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		if servers[i].Protocol != servers[j].Protocol {
+			return servers[i].Protocol < servers[j].Protocol
+		}
+		return servers[i].Port < servers[j].Port
+	})
+	return servers, conflicts
+}
+
+// TLSFront is the stream server taking TLS connections on port 443 in front of
+// the HTTPS servers. It hands connections offering acme-tls/1 to the
+// TLS-ALPN-01 responder, passes connections for the server names of
+// passthrough streams through to their containers and all others to the HTTPS
+// servers.
+type TLSFront struct {
+	ACME        bool     // Whether TLS-ALPN-01 challenges are answered
+	Passthrough []*Host  // TCP streams on port 443 routed by server name, sorted by hostname
+	Addresses   []string // Addresses the front binds to, empty to bind to all
+}
+
+// NewTLSFront returns the front for the TCP streams on port 443, nil if port
+// 443 needs no front
+func NewTLSFront(acme bool, passthrough []*Host) *TLSFront {
+	if !acme && len(passthrough) == 0 {
+		return nil
+	}
+	sorted := append([]*Host(nil), passthrough...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Hostname < sorted[j].Hostname })
+	return &TLSFront{ACME: acme, Passthrough: sorted}
+}
+
+// Listen returns the parameters of the listen directives of the front
+func (f *TLSFront) Listen() []string {
+	return listenOn(f.Addresses, 443)
+}
+
+// SendProxyProtocol reports whether passthrough connections are passed to the
+// containers with a PROXY protocol header, which all of them must ask for
+func (f *TLSFront) SendProxyProtocol() bool {
+	send, _ := proxyProtocolContainers(f.Passthrough)
+	return send
+}
+
+// MixedProxyProtocol reports whether only some passthrough containers ask for
+// the PROXY protocol, in which case none get it
+func (f *TLSFront) MixedProxyProtocol() bool {
+	_, mixed := proxyProtocolContainers(f.Passthrough)
+	return mixed
+}
+
+// IsPassthrough reports whether the stream is routed by the front on port 443
+func (h *Host) IsPassthrough() bool {
+	return h.Scheme == StreamTCP && h.Port == 443 && h.Hostname != ""
+}
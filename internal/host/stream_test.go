@@ -0,0 +1,215 @@
+package host
+
+import "testing"
+
+func TestParseVirtualStream(t *testing.T) {
+	config, err := ParseVirtualStream("tcp://:5432 -> :5433")
+	if err != nil {
+		t.Fatalf("ParseVirtualStream error: %v", err)
+	}
+	if config.Protocol != StreamTCP || config.Hostname != "" {
+		t.Fatalf("expected tcp stream without hostname, got %s %q", config.Protocol, config.Hostname)
+	}
+	if config.ListenPort != 5432 || config.ContainerPort != 5433 {
+		t.Fatalf("expected ports 5432 -> 5433, got %d -> %d", config.ListenPort, config.ContainerPort)
+	}
+
+	// The container port defaults to the listen port
+	config, err = ParseVirtualStream("udp://:53")
+	if err != nil {
+		t.Fatalf("ParseVirtualStream error: %v", err)
+	}
+	if config.Protocol != StreamUDP || config.ContainerPort != 53 {
+		t.Fatalf("expected udp stream to port 53, got %s %d", config.Protocol, config.ContainerPort)
+	}
+
+	config, err = ParseVirtualStream("TLS://DB.example.com.:6380 -> :6379")
+	if err != nil {
+		t.Fatalf("ParseVirtualStream error: %v", err)
+	}
+	if config.Protocol != StreamTLS || config.Hostname != "db.example.com" {
+		t.Fatalf("expected tls stream for db.example.com, got %s %q", config.Protocol, config.Hostname)
+	}
+}
+
+func TestParseVirtualStream_Passthrough(t *testing.T) {
+	if !IsPassthroughVirtualHost(" TLS-Passthrough://secure.example.com -> :8443") {
+		t.Fatalf("expected tls-passthrough VIRTUAL_HOST to be recognized")
+	}
+	if IsPassthroughVirtualHost("https://secure.example.com -> :8443") {
+		t.Fatalf("expected https VIRTUAL_HOST not to be passthrough")
+	}
+
+	// Passthrough hosts are TCP streams routed by server name on port 443
+	config, err := ParseVirtualStream("tls-passthrough://secure.example.com -> :8443")
+	if err != nil {
+		t.Fatalf("ParseVirtualStream error: %v", err)
+	}
+	if config.Protocol != StreamTCP || config.Hostname != "secure.example.com" {
+		t.Fatalf("expected tcp stream for secure.example.com, got %s %q", config.Protocol, config.Hostname)
+	}
+	if config.ListenPort != 443 || config.ContainerPort != 8443 {
+		t.Fatalf("expected ports 443 -> 8443, got %d -> %d", config.ListenPort, config.ContainerPort)
+	}
+	h := NewStream(config.Protocol, config.Hostname, config.ListenPort)
+	if !h.IsPassthrough() {
+		t.Fatalf("expected stream to be routed by the front on port 443")
+	}
+
+	if _, err := ParseVirtualStream("tls-passthrough://:443"); err == nil {
+		t.Fatalf("expected error for passthrough without hostname")
+	}
+}
+
+func TestNewTLSFront(t *testing.T) {
+	if front := NewTLSFront(false, nil); front != nil {
+		t.Fatalf("expected no front without ACME and passthrough streams")
+	}
+	if front := NewTLSFront(true, nil); front == nil || !front.ACME {
+		t.Fatalf("expected front answering TLS-ALPN-01 challenges")
+	}
+
+	b := newTestStream(StreamTCP, "b.example.com", 443, "b")
+	a := newTestStream(StreamTCP, "a.example.com", 443, "a")
+	front := NewTLSFront(false, []*Host{b, a})
+	if front == nil || front.ACME || len(front.Passthrough) != 2 || front.Passthrough[0] != a {
+		t.Fatalf("expected front passing a.example.com and b.example.com through in order")
+	}
+}
+
+func TestParseVirtualStream_Invalid(t *testing.T) {
+	for _, value := range []string{
+		":5432",
+		"http://:80",
+		"tcp://db.example.com",
+		"tcp://:0",
+		"tcp://:5432 -> 5432",
+		"tcp://:5432 -> :x",
+		"udp://dns.example.com:53",
+		"tls://:6380",
+	} {
+		if _, err := ParseVirtualStream(value); err == nil {
+			t.Errorf("expected error parsing %q", value)
+		}
+	}
+}
+
+func newTestStream(protocol, hostname string, port int, containerIDs ...string) *Host {
+	h := NewStream(protocol, hostname, port)
+	for _, id := range containerIDs {
+		h.AddLocation("/", &Container{ID: id, Address: "172.20.0.10", Port: port, Scheme: protocol}, nil)
+	}
+	h.BuildStreamUpstream()
+	return h
+}
+
+func TestBuildStreamUpstream(t *testing.T) {
+	h := newTestStream(StreamTCP, "*.example.com", 5432, "c2", "c1")
+	if len(h.Upstreams) != 1 {
+		t.Fatalf("expected 1 upstream, got %d", len(h.Upstreams))
+	}
+	upstream := h.Upstreams[0]
+	if upstream.ID != "stream-tcp-5432-_.example.com" {
+		t.Fatalf("unexpected upstream ID %s", upstream.ID)
+	}
+	if len(upstream.Containers) != 2 || upstream.Containers[0].ID != "c1" {
+		t.Fatalf("expected containers c1 and c2 in order, got %v", upstream.Containers)
+	}
+
+	h.RemoveContainer("c1")
+	h.RemoveContainer("c2")
+	h.BuildStreamUpstream()
+	if !h.IsEmpty() || len(h.Upstreams) != 0 {
+		t.Fatalf("expected stream without containers to have no upstream")
+	}
+}
+
+func TestStreamServers(t *testing.T) {
+	postgres := newTestStream(StreamTCP, "", 5432, "pg")
+	dbA := newTestStream(StreamTCP, "a.example.com", 5433, "a")
+	dbB := newTestStream(StreamTCP, "b.example.com", 5433, "b")
+	dbDefault := newTestStream(StreamTCP, "", 5433, "d")
+	dns := newTestStream(StreamUDP, "", 53, "dns")
+	dnsTCP := newTestStream(StreamTCP, "", 53, "dns")
+	redis := newTestStream(StreamTLS, "redis.example.com", 6380, "redis")
+	redisOther := newTestStream(StreamTLS, "cache.example.com", 6380, "cache")
+	plain := newTestStream(StreamTCP, "", 6380, "plain")
+	empty := newTestStream(StreamTCP, "", 9000)
+
+	servers, conflicts := StreamServers([]*Host{
+		redis, dbB, postgres, dns, dbDefault, redisOther, dbA, dnsTCP, plain, empty,
+	})
+
+	expected := []struct {
+		listen string
+		hosts  []*Host
+		routed bool
+	}{
+		{"53", []*Host{dnsTCP}, false},
+		{"5432", []*Host{postgres}, false},
+		{"5433", []*Host{dbDefault, dbA, dbB}, true},
+		{"6380", []*Host{plain}, false},
+		{"53 udp", []*Host{dns}, false},
+	}
+	if len(servers) != len(expected) {
+		t.Fatalf("expected %d servers, got %d", len(expected), len(servers))
+	}
+	for i, want := range expected {
+		server := servers[i]
+		if server.Listen() != want.listen {
+			t.Fatalf("server %d: expected listen %q, got %q", i, want.listen, server.Listen())
+		}
+		if server.Routed() != want.routed {
+			t.Fatalf("server %q: expected routed %v", want.listen, want.routed)
+		}
+		if len(server.Hosts) != len(want.hosts) {
+			t.Fatalf("server %q: expected %d streams, got %d", want.listen, len(want.hosts), len(server.Hosts))
+		}
+		for j, h := range want.hosts {
+			if server.Hosts[j] != h {
+				t.Fatalf("server %q: unexpected stream %d %q", want.listen, j, server.Hosts[j].Hostname)
+			}
+		}
+	}
+	servers[4].Addresses = []string{"0.0.0.0", "[::]"}
+	if listens := servers[4].Listens(); len(listens) != 2 || listens[0] != "0.0.0.0:53 udp" || listens[1] != "[::]:53 udp" {
+		t.Fatalf("expected dual-stack UDP listens, got %v", listens)
+	}
+	if servers[2].Default() != dbDefault || servers[2].Variable() != "$stream_tcp_5433" {
+		t.Fatalf("expected default stream and variable of routed server")
+	}
+
+	// TCP and TLS streams cannot share a port, nor can two TLS streams
+	if len(conflicts) != 2 || conflicts[0] != redisOther || conflicts[1] != redis {
+		t.Fatalf("expected TLS streams on port 6380 to conflict, got %d conflicts", len(conflicts))
+	}
+}
+
+func TestStreamServer_SendProxyProtocol(t *testing.T) {
+	a := newTestStream(StreamTCP, "a.example.com", 5433, "a")
+	b := newTestStream(StreamTCP, "b.example.com", 5433, "b")
+	server := &StreamServer{Protocol: StreamTCP, Port: 5433, Hosts: []*Host{a, b}}
+
+	a.Upstreams[0].Containers[0].ProxyProtocol = true
+	if server.SendProxyProtocol() || !server.MixedProxyProtocol() {
+		t.Fatalf("expected no PROXY protocol when only some containers ask for it")
+	}
+
+	b.Upstreams[0].Containers[0].ProxyProtocol = true
+	if !server.SendProxyProtocol() || server.MixedProxyProtocol() {
+		t.Fatalf("expected PROXY protocol when all containers ask for it")
+	}
+
+	// UDP streams are passed without the PROXY protocol
+	dns := newTestStream(StreamUDP, "", 53, "dns")
+	dns.Upstreams[0].Containers[0].ProxyProtocol = true
+	udp := &StreamServer{Protocol: StreamUDP, Port: 53, Hosts: []*Host{dns}}
+	if udp.SendProxyProtocol() {
+		t.Fatalf("expected no PROXY protocol to UDP containers")
+	}
+
+	front := NewTLSFront(false, []*Host{a, b})
+	if !front.SendProxyProtocol() {
+		t.Fatalf("expected PROXY protocol to passthrough containers asking for it")
+	}
+}
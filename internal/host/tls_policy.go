@@ -0,0 +1,117 @@
+package host
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TLSPolicy represents the TLS settings applied to SSL server blocks
+type TLSPolicy struct {
+	Profile             string // Name of the profile the policy is based on
+	Custom              bool   // True when protocols/ciphers/curves were overridden
+	Protocols           string
+	Ciphers             string // Empty for TLSv1.3 only profiles
+	ECDHCurves          string
+	PreferServerCiphers bool
+	SessionCache        string
+	SessionTimeout      string
+	SessionTickets      bool
+	DHParamFile         string // Only set on the global policy once DH params exist
+}
+
+// Cipher suites from the Mozilla server side TLS guidelines (v5.7)
+const (
+	intermediateCiphers = "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:" +
+		"ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:" +
+		"ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:" +
+		"DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384:DHE-RSA-CHACHA20-POLY1305"
+	oldCiphers = intermediateCiphers + ":" +
+		"ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA256:ECDHE-ECDSA-AES128-SHA:ECDHE-RSA-AES128-SHA:" +
+		"ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES256-SHA:ECDHE-RSA-AES256-SHA:" +
+		"DHE-RSA-AES128-SHA256:DHE-RSA-AES256-SHA256:AES128-GCM-SHA256:AES256-GCM-SHA384:" +
+		"AES128-SHA256:AES256-SHA256:AES128-SHA:AES256-SHA:DES-CBC3-SHA"
+	defaultECDHCurves = "X25519:prime256v1:secp384r1"
+)
+
+// tlsProfiles holds the built-in profiles, keyed by name
+var tlsProfiles = map[string]TLSPolicy{
+	"modern": {
+		Profile:        "modern",
+		Protocols:      "TLSv1.3",
+		ECDHCurves:     defaultECDHCurves,
+		SessionTimeout: "1d",
+	},
+	"intermediate": {
+		Profile:        "intermediate",
+		Protocols:      "TLSv1.2 TLSv1.3",
+		Ciphers:        intermediateCiphers,
+		ECDHCurves:     defaultECDHCurves,
+		SessionTimeout: "1d",
+	},
+	"old": {
+		Profile:             "old",
+		Protocols:           "TLSv1 TLSv1.1 TLSv1.2 TLSv1.3",
+		Ciphers:             oldCiphers,
+		ECDHCurves:          defaultECDHCurves,
+		PreferServerCiphers: true,
+		SessionTimeout:      "1d",
+	},
+}
+
+// LookupTLSProfile returns a copy of the built-in profile with the given name
+func LookupTLSProfile(name string) (*TLSPolicy, error) {
+	profile, ok := tlsProfiles[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown TLS profile %q (expected one of %s)", name, strings.Join(TLSProfileNames(), ", "))
+	}
+	return &profile, nil
+}
+
+// TLSProfileNames returns the names of the built-in profiles
+func TLSProfileNames() []string {
+	names := make([]string, 0, len(tlsProfiles))
+	for name := range tlsProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Override replaces the protocols, ciphers and curves of the policy when set
+func (p *TLSPolicy) Override(protocols, ciphers, curves string) error {
+	if protocols != "" {
+		for _, proto := range strings.Fields(protocols) {
+			switch proto {
+			case "TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3":
+			default:
+				return fmt.Errorf("unsupported TLS protocol %q", proto)
+			}
+		}
+		p.Protocols = strings.Join(strings.Fields(protocols), " ")
+		p.Custom = true
+	}
+	if ciphers != "" {
+		if strings.ContainsAny(ciphers, " ;{}") {
+			return fmt.Errorf("invalid cipher list %q", ciphers)
+		}
+		p.Ciphers = ciphers
+		p.Custom = true
+	}
+	if curves != "" {
+		if strings.ContainsAny(curves, " ;{}") {
+			return fmt.Errorf("invalid ECDH curve list %q", curves)
+		}
+		p.ECDHCurves = curves
+		p.Custom = true
+	}
+	return nil
+}
+
+// Name returns the profile name, marked when the profile has been customised
+func (p *TLSPolicy) Name() string {
+	if p.Custom {
+		return p.Profile + "+custom"
+	}
+	return p.Profile
+}
@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// dhParameters is the ASN.1 structure of a PKCS#3 "DH PARAMETERS" block
+type dhParameters struct {
+	P *big.Int
+	G *big.Int
+}
+
+// EnsureDHParam makes sure a DH parameters file of at least the given size exists,
+// generating one with openssl when the file is missing, invalid or too small
+func (n *Nginx) EnsureDHParam(path string, size int) error {
+	if bits, err := DHParamBits(path); err == nil && bits >= size {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create dhparam directory: %v", err)
+	}
+
+	cmd := n.cmdr.Command("openssl", "dhparam", "-out", path, strconv.Itoa(size))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to generate dhparam: %s", string(output))
+	}
+
+	bits, err := DHParamBits(path)
+	if err != nil {
+		return fmt.Errorf("generated dhparam is invalid: %v", err)
+	}
+	if bits < size {
+		return fmt.Errorf("generated dhparam has %d bits, expected %d", bits, size)
+	}
+	return nil
+}
+
+// DHParamBits returns the prime size in bits of a PEM encoded DH parameters file
+func DHParamBits(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "DH PARAMETERS" {
+		return 0, fmt.Errorf("no DH PARAMETERS block found in %s", path)
+	}
+
+	var params dhParameters
+	if _, err := asn1.Unmarshal(block.Bytes, &params); err != nil {
+		return 0, fmt.Errorf("failed to parse DH parameters: %v", err)
+	}
+	return params.P.BitLen(), nil
+}
@@ -0,0 +1,17 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SupportsHTTP3 reports whether nginx was built with the HTTP/3 module, which
+// QUIC listeners need
+func (n *Nginx) SupportsHTTP3() (bool, error) {
+	cmd := n.cmdr.Command("nginx", "-V")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("failed to read nginx build options: %s", string(output))
+	}
+	return strings.Contains(string(output), "--with-http_v3_module"), nil
+}
@@ -10,10 +10,13 @@ import (
 
 // Nginx represents an nginx server instance
 type Nginx struct {
-	confFile     string
-	challengeDir string
-	lastConfig   string
-	cmdr         Commander
+	confFile       string
+	streamConfFile string
+	streamBackup   []byte // Stream configuration replaced by WriteStreamConfig, nil if there was none
+	streamWritten  bool   // The stream configuration was replaced and not yet tested
+	challengeDir   string
+	lastConfig     string
+	cmdr           Commander
 }
 
 // NginxConfig represents the configuration for nginx.
@@ -33,6 +36,37 @@ func NewNginx(confFile, challengeDir string, cmdr Commander) *Nginx {
 	}
 }
 
+// SetStreamConfFile sets the file the stream (TCP/UDP) configuration is written to
+func (n *Nginx) SetStreamConfFile(streamConfFile string) {
+	n.streamConfFile = streamConfFile
+}
+
+// WriteStreamConfig writes the stream configuration. It is applied by the
+// next UpdateConfig, which tests and reloads nginx, and restores the previous
+// stream configuration when the test fails.
+func (n *Nginx) WriteStreamConfig(config string) error {
+	if n.streamConfFile == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(n.streamConfFile), 0755); err != nil {
+		return fmt.Errorf("failed to create stream config directory: %v", err)
+	}
+
+	if !n.streamWritten {
+		backup, err := readConfigBackup(n.streamConfFile)
+		if err != nil {
+			return fmt.Errorf("failed to read stream config file: %v", err)
+		}
+		n.streamBackup = backup
+	}
+	if err := os.WriteFile(n.streamConfFile, []byte(config), 0644); err != nil {
+		return fmt.Errorf("failed to write stream config file: %v", err)
+	}
+	n.streamWritten = true
+	return nil
+}
+
 // UpdateConfig updates the nginx configuration and reloads the server
 func (n *Nginx) UpdateConfig(config string) error {
 	// Create directory if it doesn't exist
@@ -41,15 +75,23 @@ func (n *Nginx) UpdateConfig(config string) error {
 		return fmt.Errorf("failed to create config directory: %v", err)
 	}
 
-	// Write configuration
+	// Write configuration, keeping the previous one until it is tested
+	backup, err := readConfigBackup(n.confFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
 	if err := os.WriteFile(n.confFile, []byte(config), 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %v", err)
 	}
 
-	// Test configuration
+	// Test configuration, a failing one must not block the next update
 	if err := n.configTest(); err != nil {
+		if restoreErr := n.restoreConfig(backup); restoreErr != nil {
+			return fmt.Errorf("nginx config test failed: %v; %v", err, restoreErr)
+		}
 		return fmt.Errorf("nginx config test failed: %v", err)
 	}
+	n.streamWritten, n.streamBackup = false, nil
 
 	// Reload nginx
 	if err := n.reload(); err != nil {
@@ -83,6 +125,49 @@ func (n *Nginx) ForceStart(config string) bool {
 	return true
 }
 
+// restoreConfig puts back the configuration replaced by UpdateConfig and the
+// stream configuration replaced since the last test
+func (n *Nginx) restoreConfig(backup []byte) error {
+	if err := restoreConfigBackup(n.confFile, backup); err != nil {
+		return fmt.Errorf("failed to restore config file: %v", err)
+	}
+	if n.streamWritten {
+		if err := restoreConfigBackup(n.streamConfFile, n.streamBackup); err != nil {
+			return fmt.Errorf("failed to restore stream config file: %v", err)
+		}
+		n.streamWritten, n.streamBackup = false, nil
+	}
+	return nil
+}
+
+// readConfigBackup returns the content of a configuration file about to be
+// replaced, nil if it does not exist
+func readConfigBackup(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+// restoreConfigBackup puts back a configuration file read by
+// readConfigBackup, removing it if it did not exist
+func restoreConfigBackup(path string, backup []byte) error {
+	if backup == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, backup, 0644)
+}
+
 // configTest tests the nginx configuration
 func (n *Nginx) configTest() error {
 	cmd := n.cmdr.Command("nginx", "-t")
@@ -0,0 +1,79 @@
+package nginx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCommander runs no command, failing nginx -t while failTest is set
+type testCommander struct {
+	failTest bool
+}
+
+func (c *testCommander) Command(name string, args ...string) Cmd {
+	return &testCmd{fail: c.failTest && len(args) == 1 && args[0] == "-t"}
+}
+
+type testCmd struct {
+	fail bool
+}
+
+func (c *testCmd) CombinedOutput() ([]byte, error) {
+	if c.fail {
+		return []byte("invalid configuration"), errors.New("exit status 1")
+	}
+	return nil, nil
+}
+
+func (*testCmd) Start() error { return nil }
+
+func TestUpdateConfigRestoresOnFailedTest(t *testing.T) {
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "conf.d", "default.conf")
+	streamConfFile := filepath.Join(dir, "stream.d", "default.conf")
+	cmdr := &testCommander{}
+	n := NewNginx(confFile, dir, cmdr)
+	n.SetStreamConfFile(streamConfFile)
+
+	require.NoError(t, n.WriteStreamConfig("stream v1"))
+	require.NoError(t, n.UpdateConfig("http v1"))
+
+	// A configuration failing the test is replaced by the previous one
+	cmdr.failTest = true
+	require.NoError(t, n.WriteStreamConfig("stream v2"))
+	assert.Error(t, n.UpdateConfig("http v2"))
+	assertFileContent(t, confFile, "http v1")
+	assertFileContent(t, streamConfFile, "stream v1")
+
+	// And does not block the next valid one
+	cmdr.failTest = false
+	require.NoError(t, n.WriteStreamConfig("stream v3"))
+	require.NoError(t, n.UpdateConfig("http v3"))
+	assertFileContent(t, confFile, "http v3")
+	assertFileContent(t, streamConfFile, "stream v3")
+}
+
+func TestUpdateConfigRemovesNewFilesOnFailedTest(t *testing.T) {
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "conf.d", "default.conf")
+	streamConfFile := filepath.Join(dir, "stream.d", "default.conf")
+	n := NewNginx(confFile, dir, &testCommander{failTest: true})
+	n.SetStreamConfFile(streamConfFile)
+
+	require.NoError(t, n.WriteStreamConfig("stream v1"))
+	assert.Error(t, n.UpdateConfig("http v1"))
+	assert.NoFileExists(t, confFile)
+	assert.NoFileExists(t, streamConfFile)
+}
+
+func assertFileContent(t *testing.T, path, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+}
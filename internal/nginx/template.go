@@ -23,16 +23,18 @@ func NewTemplate(tmplStr string) (*Template, error) {
 	return &Template{tmpl: tmpl}, nil
 }
 
-// Render renders the template with the given data
-func (t *Template) Render(hosts map[string]*host.Host, cfg *config.Config) (string, error) {
-	data := struct {
-		Hosts  map[string]*host.Host
-		Config *config.Config
-	}{
-		Hosts:  hosts,
-		Config: cfg,
-	}
+// TemplateData is the data the templates are rendered with
+type TemplateData struct {
+	Hosts    map[string]*host.Host
+	Streams  []*host.StreamServer
+	Front    *host.TLSFront        // Stream server on port 443, nil when the HTTPS servers listen on it
+	Defaults []*host.DefaultServer // Catch-all servers, empty when DEFAULT_HOST is disabled
+	Config   *config.Config
+	TLS      *host.TLSPolicy
+}
 
+// Render renders the template with the given data
+func (t *Template) Render(data *TemplateData) (string, error) {
 	var buf bytes.Buffer
 	if err := t.tmpl.Execute(&buf, data); err != nil {
 		return "", err
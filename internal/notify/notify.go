@@ -0,0 +1,248 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of events
+const (
+	EventCertificateExpiring = "certificate_expiring" // A certificate entered the warning window
+	EventRenewalFailed       = "renewal_failed"       // Obtaining a certificate failed repeatedly
+	EventSelfSignedFallback  = "self_signed_fallback" // A host is served a self-signed certificate
+)
+
+// Formats of webhook payloads
+const (
+	FormatJSON  = "json"  // The event as a JSON object
+	FormatSlack = "slack" // A Slack incoming webhook message
+)
+
+// Logger interface for the notifier
+type Logger interface {
+	Info(format string, args ...interface{})
+	Error(format string, args ...interface{})
+	Debug(format string, args ...interface{})
+	Warn(format string, args ...interface{})
+}
+
+// Event is a certificate problem worth telling an operator about
+type Event struct {
+	Kind        string     `json:"event"`
+	Certificate string     `json:"certificate,omitempty"`
+	Host        string     `json:"host,omitempty"`
+	Domains     []string   `json:"domains,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	Failures    int        `json:"failures,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Message     string     `json:"message"`
+	Time        time.Time  `json:"time"`
+}
+
+// webhook is a URL events are posted to in a format
+type webhook struct {
+	url    string
+	format string
+}
+
+// Notifier posts events to webhooks. Every event has a key naming the
+// condition it reports, and is sent once until the condition is resolved, so
+// a condition checked every hour is not reported every hour. Sent keys are
+// kept in a file to survive restarts.
+type Notifier struct {
+	path     string
+	webhooks []webhook
+	client   *http.Client
+	logger   Logger
+	sent     map[string]time.Time // Keys of conditions reported
+	inflight map[string]bool      // Keys of events being sent
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewNotifier creates a notifier keeping the keys of sent events in path
+func NewNotifier(path string, logger Logger) *Notifier {
+	n := &Notifier{
+		path:     path,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+		sent:     make(map[string]time.Time),
+		inflight: make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &n.sent)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to load sent notifications, they may be sent again: %v", err)
+	}
+	return n
+}
+
+// AddWebhook posts events to rawURL in format
+func (n *Notifier) AddWebhook(rawURL, format string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", rawURL)
+	}
+	if format != FormatJSON && format != FormatSlack {
+		return fmt.Errorf("unknown webhook format %q", format)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.webhooks = append(n.webhooks, webhook{url: rawURL, format: format})
+	return nil
+}
+
+// Enabled reports whether any webhook is configured
+func (n *Notifier) Enabled() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.webhooks) > 0
+}
+
+// Notify sends event in the background unless the condition key was already
+// reported. A failed delivery is retried the next time the condition is
+// reported.
+func (n *Notifier) Notify(key string, event Event) {
+	n.mu.Lock()
+	if len(n.webhooks) == 0 || n.inflight[key] {
+		n.mu.Unlock()
+		return
+	}
+	if _, sent := n.sent[key]; sent {
+		n.mu.Unlock()
+		return
+	}
+	n.inflight[key] = true
+	webhooks := append([]webhook(nil), n.webhooks...)
+	n.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		failed := false
+		for _, hook := range webhooks {
+			if err := n.post(hook, event); err != nil {
+				n.logger.Warn("Failed to send %s notification to %s: %v", event.Kind, redact(hook.url), err)
+				failed = true
+			}
+		}
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.inflight, key)
+		if failed {
+			return
+		}
+		n.sent[key] = event.Time
+		n.save()
+		n.logger.Info("Sent %s notification: %s", event.Kind, event.Message)
+	}()
+}
+
+// Resolve forgets that the condition key was reported, so it is reported
+// again when it recurs
+func (n *Notifier) Resolve(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, sent := n.sent[key]; !sent {
+		return
+	}
+	delete(n.sent, key)
+	n.save()
+}
+
+// Sent returns the keys of the conditions reported, sorted
+func (n *Notifier) Sent() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	keys := make([]string, 0, len(n.sent))
+	for key := range n.sent {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Wait waits for the events being sent
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// save writes the keys of the reported conditions, with n.mu held
+func (n *Notifier) save() {
+	data, err := json.MarshalIndent(n.sent, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(n.path), 0755)
+	}
+	if err == nil {
+		tmp := n.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, n.path)
+		}
+	}
+	if err != nil {
+		n.logger.Warn("Failed to save sent notifications: %v", err)
+	}
+}
+
+// post sends event to hook
+func (n *Notifier) post(hook webhook, event Event) error {
+	var payload interface{} = event
+	if hook.format == FormatSlack {
+		payload = slackMessage(event)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(hook.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// slackMessage formats event as a Slack incoming webhook message, understood
+// by Slack compatible services as well
+func slackMessage(event Event) map[string]string {
+	icon := ":warning:"
+	if event.Kind != EventCertificateExpiring {
+		icon = ":rotating_light:"
+	}
+	return map[string]string{"text": fmt.Sprintf("%s *nginx-proxy-go*: %s", icon, event.Message)}
+}
+
+// redact strips the path and query of a webhook URL, which often hold its
+// secret, for logging
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
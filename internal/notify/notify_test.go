@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookServer stands in for a webhook receiver, recording the bodies posted
+// to it and answering with status
+type webhookServer struct {
+	*httptest.Server
+	status int
+	bodies []map[string]interface{}
+	mu     sync.Mutex
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	t.Helper()
+	s := &webhookServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// received returns the bodies posted so far
+func (s *webhookServer) received() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.bodies...)
+}
+
+func newTestNotifier(t *testing.T, path string) *Notifier {
+	t.Helper()
+	logCfg := logger.DefaultConfig()
+	logCfg.OutputPath = filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.New(logCfg)
+	require.NoError(t, err)
+	return NewNotifier(path, log)
+}
+
+func TestAddWebhook(t *testing.T) {
+	n := newTestNotifier(t, filepath.Join(t.TempDir(), "notifications.json"))
+	assert.False(t, n.Enabled())
+	assert.Error(t, n.AddWebhook("hooks.example.com/abc", FormatJSON))
+	assert.Error(t, n.AddWebhook("ftp://hooks.example.com/abc", FormatJSON))
+	assert.Error(t, n.AddWebhook("https://hooks.example.com/abc", "xml"))
+	assert.False(t, n.Enabled())
+
+	require.NoError(t, n.AddWebhook("https://hooks.example.com/abc", FormatSlack))
+	assert.True(t, n.Enabled())
+}
+
+func TestNotify(t *testing.T) {
+	generic, slack := newWebhookServer(t), newWebhookServer(t)
+	path := filepath.Join(t.TempDir(), "notifications.json")
+	n := newTestNotifier(t, path)
+	require.NoError(t, n.AddWebhook(generic.URL+"/hook", FormatJSON))
+	require.NoError(t, n.AddWebhook(slack.URL+"/services/T0/B0/secret", FormatSlack))
+
+	notAfter := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	event := Event{
+		Kind:        EventCertificateExpiring,
+		Certificate: "example.com",
+		Domains:     []string{"example.com"},
+		NotAfter:    &notAfter,
+		Message:     "Certificate example.com expires in 13 days",
+	}
+	n.Notify("expiring:example.com", event)
+	n.Wait()
+
+	require.Len(t, generic.received(), 1)
+	body := generic.received()[0]
+	assert.Equal(t, EventCertificateExpiring, body["event"])
+	assert.Equal(t, "example.com", body["certificate"])
+	assert.Equal(t, "2026-11-01T00:00:00Z", body["not_after"])
+	assert.NotEmpty(t, body["time"])
+	assert.NotContains(t, body, "failures")
+
+	require.Len(t, slack.received(), 1)
+	assert.Equal(t, map[string]interface{}{"text": ":warning: *nginx-proxy-go*: Certificate example.com expires in 13 days"}, slack.received()[0])
+
+	// A reported condition is not reported again, even after a restart
+	n.Notify("expiring:example.com", event)
+	n.Wait()
+	n = newTestNotifier(t, path)
+	require.NoError(t, n.AddWebhook(generic.URL+"/hook", FormatJSON))
+	n.Notify("expiring:example.com", event)
+	n.Wait()
+	assert.Len(t, generic.received(), 1)
+	assert.Equal(t, []string{"expiring:example.com"}, n.Sent())
+
+	// A resolved condition is reported again when it recurs
+	n.Resolve("expiring:example.com")
+	assert.Empty(t, n.Sent())
+	n.Notify("expiring:example.com", event)
+	n.Wait()
+	assert.Len(t, generic.received(), 2)
+}
+
+func TestNotifyRetriesFailedDelivery(t *testing.T) {
+	server := newWebhookServer(t)
+	server.status = http.StatusInternalServerError
+	n := newTestNotifier(t, filepath.Join(t.TempDir(), "notifications.json"))
+	require.NoError(t, n.AddWebhook(server.URL, FormatJSON))
+
+	event := Event{Kind: EventRenewalFailed, Certificate: "example.com", Failures: 3, Message: "failed"}
+	n.Notify("failed:example.com", event)
+	n.Wait()
+	assert.Empty(t, n.Sent())
+
+	server.mu.Lock()
+	server.status = http.StatusNoContent
+	server.mu.Unlock()
+	n.Notify("failed:example.com", event)
+	n.Wait()
+	assert.Len(t, server.received(), 2)
+	assert.Equal(t, float64(3), server.received()[1]["failures"])
+	assert.Equal(t, []string{"failed:example.com"}, n.Sent())
+}
+
+func TestNotifyWithoutWebhooks(t *testing.T) {
+	n := newTestNotifier(t, filepath.Join(t.TempDir(), "notifications.json"))
+	n.Notify("expiring:example.com", Event{Kind: EventCertificateExpiring, Message: "expiring"})
+	n.Wait()
+	assert.Empty(t, n.Sent())
+}
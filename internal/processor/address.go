@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Address families of container addresses
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// AddressFamilies decides whether containers reachable over both IPv4 and IPv6
+// are proxied to by their IPv4 or IPv6 address. The other family is used when
+// the container has no address of the preferred one.
+type AddressFamilies struct {
+	Default  string            // Preferred family, ipv4 unless set
+	Networks map[string]string // Preferred family by network name or ID, overriding the default
+}
+
+// ParseAddressFamilies parses the global preference and a list of network=family
+// overrides
+func ParseAddressFamilies(defaultFamily string, networks []string) (*AddressFamilies, error) {
+	families := &AddressFamilies{Default: FamilyIPv4, Networks: make(map[string]string)}
+	if defaultFamily != "" {
+		family, err := parseAddressFamily(defaultFamily)
+		if err != nil {
+			return nil, err
+		}
+		families.Default = family
+	}
+	for _, entry := range networks {
+		network, value, ok := strings.Cut(entry, "=")
+		network = strings.TrimSpace(network)
+		if !ok || network == "" {
+			return nil, fmt.Errorf("invalid network address family %q, expected network=ipv4 or network=ipv6", entry)
+		}
+		family, err := parseAddressFamily(value)
+		if err != nil {
+			return nil, err
+		}
+		families.Networks[network] = family
+	}
+	return families, nil
+}
+
+// parseAddressFamily parses ipv4 or ipv6
+func parseAddressFamily(s string) (string, error) {
+	switch family := strings.ToLower(strings.TrimSpace(s)); family {
+	case FamilyIPv4, FamilyIPv6:
+		return family, nil
+	default:
+		return "", fmt.Errorf("invalid address family %q, expected ipv4 or ipv6", s)
+	}
+}
+
+// Prefer returns the family preferred on a network
+func (f *AddressFamilies) Prefer(networkName, networkID string) string {
+	if f == nil {
+		return FamilyIPv4
+	}
+	if family, ok := f.Networks[networkName]; ok {
+		return family
+	}
+	if family, ok := f.Networks[networkID]; ok {
+		return family
+	}
+	if f.Default == "" {
+		return FamilyIPv4
+	}
+	return f.Default
+}
+
+// ContainerAddress returns the address of a container on the first of its
+// networks, by name, that is known and gives it an address, in the family
+// preferred on that network
+func ContainerAddress(container types.ContainerJSON, knownNetworks map[string]string, families *AddressFamilies) string {
+	if container.NetworkSettings == nil {
+		return ""
+	}
+	names := make([]string, 0, len(container.NetworkSettings.Networks))
+	for name := range container.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		network := container.NetworkSettings.Networks[name]
+		if network == nil || network.NetworkID == "" {
+			continue
+		}
+		if _, exists := knownNetworks[network.NetworkID]; !exists {
+			continue
+		}
+		ipv4, ipv6 := network.IPAddress, network.GlobalIPv6Address
+		if families.Prefer(name, network.NetworkID) == FamilyIPv6 && ipv6 != "" {
+			return ipv6
+		}
+		if ipv4 != "" {
+			return ipv4
+		}
+		if ipv6 != "" {
+			return ipv6
+		}
+	}
+	return ""
+}
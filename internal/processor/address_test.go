@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDualStackContainer() types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "123", Name: "/app"},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"frontend": {NetworkID: "n1", IPAddress: "172.20.0.10", GlobalIPv6Address: "fd00:20::10"},
+				"v6only":   {NetworkID: "n2", GlobalIPv6Address: "fd00:30::10"},
+			},
+		},
+	}
+}
+
+func TestParseAddressFamilies(t *testing.T) {
+	families, err := ParseAddressFamilies("", []string{"frontend=IPv6", " n2 = ipv4"})
+	require.NoError(t, err)
+	assert.Equal(t, FamilyIPv4, families.Default)
+	assert.Equal(t, FamilyIPv6, families.Prefer("frontend", "n1"))
+	assert.Equal(t, FamilyIPv4, families.Prefer("v6only", "n2"))
+	assert.Equal(t, FamilyIPv4, families.Prefer("backend", "n3"))
+
+	_, err = ParseAddressFamilies("ipv5", nil)
+	assert.Error(t, err)
+	_, err = ParseAddressFamilies("ipv4", []string{"frontend"})
+	assert.Error(t, err)
+
+	// Without preferences IPv4 is preferred
+	var none *AddressFamilies
+	assert.Equal(t, FamilyIPv4, none.Prefer("frontend", "n1"))
+}
+
+func TestContainerAddress(t *testing.T) {
+	cont := newTestDualStackContainer()
+
+	assert.Equal(t, "172.20.0.10", ContainerAddress(cont, map[string]string{"n1": "frontend"}, nil))
+
+	families, err := ParseAddressFamilies("ipv6", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "fd00:20::10", ContainerAddress(cont, map[string]string{"n1": "frontend"}, families))
+
+	families, err = ParseAddressFamilies("ipv6", []string{"frontend=ipv4"})
+	require.NoError(t, err)
+	assert.Equal(t, "172.20.0.10", ContainerAddress(cont, map[string]string{"n1": "frontend"}, families))
+
+	// IPv6-only networks give the IPv6 address whatever the preference
+	assert.Equal(t, "fd00:30::10", ContainerAddress(cont, map[string]string{"n2": "v6only"}, nil))
+
+	assert.Equal(t, "", ContainerAddress(cont, map[string]string{"n3": "backend"}, nil))
+}
+
+func TestProcessVirtualHosts_IPv6(t *testing.T) {
+	cont := newTestDualStackContainer()
+	env := map[string]string{"VIRTUAL_HOST": "app.example.com -> :8080"}
+
+	result := ProcessVirtualHosts(cont, env, map[string]string{"n2": "v6only"}, nil)
+	h, ok := result["app.example.com:80"]
+	require.True(t, ok)
+	assert.Equal(t, "[fd00:30::10]:8080", h.Locations["/"].ContainerHostPort())
+}
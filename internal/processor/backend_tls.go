@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/config"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+)
+
+// BackendTLSProcessor handles TLS settings for https:// and grpcs:// backends
+type BackendTLSProcessor struct {
+	globalVerify bool
+	systemCA     string
+	secretsDir   string
+	log          *logger.Logger
+}
+
+// NewBackendTLSProcessor creates a new backend TLS processor from global config
+func NewBackendTLSProcessor(cfg *config.Config, log *logger.Logger) *BackendTLSProcessor {
+	return &BackendTLSProcessor{
+		globalVerify: cfg.BackendTLSVerify,
+		systemCA:     constants.SystemCABundle,
+		secretsDir:   constants.DockerSecretsDir,
+		log:          log,
+	}
+}
+
+// ProcessBackendTLS applies PROXY_BACKEND_TLS_* settings to the TLS locations of a container.
+// Locations proxying to plain http/grpc backends are left untouched. Backends are
+// verified against the virtual hostname unless PROXY_BACKEND_TLS_NAME is set,
+// since they are addressed by IP. Wildcard and regex hosts are verified against
+// the requested host.
+func (p *BackendTLSProcessor) ProcessBackendTLS(env map[string]string, hosts map[string]map[int]*host.Host) {
+	tlsConfig, err := p.BuildBackendTLS(env)
+	if err != nil {
+		p.log.Warn("Invalid backend TLS configuration: %v", err)
+		return
+	}
+	if tlsConfig == nil {
+		return
+	}
+
+	for _, portMap := range hosts {
+		for _, h := range portMap {
+			hostTLS := tlsConfig
+			if hostTLS.Verify && hostTLS.ServerName == "" {
+				named := *tlsConfig
+				named.ServerName = h.Hostname
+				if !isBackendServerName(h.Hostname) {
+					named.ServerName = "$host"
+				}
+				hostTLS = &named
+			}
+			h.SetBackendTLS(hostTLS)
+		}
+	}
+}
+
+// isBackendServerName reports whether a virtual hostname can be sent as SNI name
+// and matched against a backend certificate
+func isBackendServerName(name string) bool {
+	if name == "" || name == "_" || strings.HasPrefix(name, "~") || strings.ContainsAny(name, "*/: ") {
+		return false
+	}
+	return net.ParseIP(name) == nil
+}
+
+// BuildBackendTLS builds the backend TLS settings from container environment.
+// It returns nil when neither the container nor the global config asks for TLS options.
+func (p *BackendTLSProcessor) BuildBackendTLS(env map[string]string) (*host.BackendTLS, error) {
+	verifyStr := strings.ToLower(strings.TrimSpace(env["PROXY_BACKEND_TLS_VERIFY"]))
+	caSpec := strings.TrimSpace(env["PROXY_BACKEND_TLS_CA"])
+	serverName := strings.TrimSpace(env["PROXY_BACKEND_TLS_NAME"])
+	certSpec := strings.TrimSpace(env["PROXY_BACKEND_TLS_CERT"])
+	keySpec := strings.TrimSpace(env["PROXY_BACKEND_TLS_KEY"])
+
+	if verifyStr == "" && caSpec == "" && serverName == "" && certSpec == "" && keySpec == "" && !p.globalVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &host.BackendTLS{ServerName: serverName}
+
+	// A custom CA implies verification unless explicitly disabled
+	switch verifyStr {
+	case "":
+		tlsConfig.Verify = p.globalVerify || caSpec != ""
+	case "on", "true":
+		tlsConfig.Verify = true
+	case "off", "false":
+		tlsConfig.Verify = false
+	default:
+		return nil, fmt.Errorf("unsupported PROXY_BACKEND_TLS_VERIFY %q (expected on or off)", verifyStr)
+	}
+
+	if caSpec != "" {
+		caFile, err := readPEMCertificates(p.secretsDir, caSpec)
+		if err != nil {
+			return nil, fmt.Errorf("PROXY_BACKEND_TLS_CA: %w", err)
+		}
+		tlsConfig.TrustedCA = caFile
+	} else if tlsConfig.Verify {
+		tlsConfig.TrustedCA = p.systemCA
+	}
+
+	if (certSpec == "") != (keySpec == "") {
+		return nil, fmt.Errorf("PROXY_BACKEND_TLS_CERT and PROXY_BACKEND_TLS_KEY must be set together")
+	}
+	if certSpec != "" {
+		certFile, err := resolveSecretPath(p.secretsDir, certSpec)
+		if err != nil {
+			return nil, fmt.Errorf("PROXY_BACKEND_TLS_CERT: %w", err)
+		}
+		keyFile, err := resolveSecretPath(p.secretsDir, keySpec)
+		if err != nil {
+			return nil, fmt.Errorf("PROXY_BACKEND_TLS_KEY: %w", err)
+		}
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return nil, fmt.Errorf("invalid backend client certificate: %w", err)
+		}
+		tlsConfig.ClientCert = certFile
+		tlsConfig.ClientKey = keyFile
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,160 @@
+package processor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/config"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestKeyPair writes a self-signed certificate and matching key to dir
+func writeTestKeyPair(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "proxy-client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestProcessBackendTLS_FullConfig(t *testing.T) {
+	proc := NewBackendTLSProcessor(&config.Config{}, newTestLogger(t))
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTestCABundle(t, caFile)
+	certFile, keyFile := writeTestKeyPair(t, dir)
+
+	h := host.NewHost("api.example.com", 443)
+	h.AddLocation("/", &host.Container{ID: "c1", Address: "172.20.0.5", Port: 8443, Scheme: "https"}, nil)
+	hosts := map[string]map[int]*host.Host{"api.example.com": {443: h}}
+	proc.ProcessBackendTLS(map[string]string{
+		"PROXY_BACKEND_TLS_CA":   caFile,
+		"PROXY_BACKEND_TLS_NAME": "api.internal",
+		"PROXY_BACKEND_TLS_CERT": certFile,
+		"PROXY_BACKEND_TLS_KEY":  keyFile,
+	}, hosts)
+
+	tlsConfig := h.Locations["/"].BackendTLS
+	require.NotNil(t, tlsConfig)
+	assert.True(t, tlsConfig.Verify)
+	assert.Equal(t, caFile, tlsConfig.TrustedCA)
+	assert.Equal(t, "api.internal", tlsConfig.ServerName)
+	assert.Equal(t, certFile, tlsConfig.ClientCert)
+	assert.Equal(t, keyFile, tlsConfig.ClientKey)
+}
+
+func TestProcessBackendTLS_GRPCS(t *testing.T) {
+	proc := NewBackendTLSProcessor(&config.Config{}, newTestLogger(t))
+
+	h := host.NewHost("api.example.com", 443)
+	h.AddLocation("/", &host.Container{ID: "c1", Address: "172.20.0.5", Port: 8443, Scheme: "grpcs"}, nil)
+	hosts := map[string]map[int]*host.Host{"api.example.com": {443: h}}
+	proc.ProcessBackendTLS(map[string]string{"PROXY_BACKEND_TLS_NAME": "grpc.internal"}, hosts)
+
+	tlsConfig := h.Locations["/"].BackendTLS
+	require.NotNil(t, tlsConfig)
+	assert.False(t, tlsConfig.Verify)
+	assert.Equal(t, "grpc.internal", tlsConfig.ServerName)
+}
+
+func TestProcessBackendTLS_PlainBackendUntouched(t *testing.T) {
+	proc := NewBackendTLSProcessor(&config.Config{BackendTLSVerify: true}, newTestLogger(t))
+
+	h := host.NewHost("api.example.com", 443)
+	h.AddLocation("/", &host.Container{ID: "c1", Address: "172.20.0.5", Port: 8443, Scheme: "http"}, nil)
+	hosts := map[string]map[int]*host.Host{"api.example.com": {443: h}}
+	proc.ProcessBackendTLS(map[string]string{}, hosts)
+
+	assert.Nil(t, h.Locations["/"].BackendTLS)
+}
+
+func TestProcessBackendTLS_GlobalVerifyUsesSystemCA(t *testing.T) {
+	proc := NewBackendTLSProcessor(&config.Config{BackendTLSVerify: true}, newTestLogger(t))
+
+	h := host.NewHost("api.example.com", 443)
+	h.AddLocation("/", &host.Container{ID: "c1", Address: "172.20.0.5", Port: 8443, Scheme: "https"}, nil)
+	hosts := map[string]map[int]*host.Host{"api.example.com": {443: h}}
+	proc.ProcessBackendTLS(map[string]string{}, hosts)
+
+	tlsConfig := h.Locations["/"].BackendTLS
+	require.NotNil(t, tlsConfig)
+	assert.True(t, tlsConfig.Verify)
+	assert.Equal(t, proc.systemCA, tlsConfig.TrustedCA)
+	// Verified backends are matched against the virtual hostname by default
+	assert.Equal(t, "api.example.com", tlsConfig.ServerName)
+}
+
+func TestProcessBackendTLS_VerifyWithoutServerName(t *testing.T) {
+	proc := NewBackendTLSProcessor(&config.Config{BackendTLSVerify: true}, newTestLogger(t))
+
+	h := host.NewHost("*.example.com", 443)
+	h.AddLocation("/", &host.Container{ID: "c1", Address: "172.20.0.5", Port: 8443, Scheme: "https"}, nil)
+	hosts := map[string]map[int]*host.Host{"*.example.com": {443: h}}
+
+	// A wildcard is no name to verify against, the requested host is
+	proc.ProcessBackendTLS(map[string]string{}, hosts)
+	tlsConfig := h.Locations["/"].BackendTLS
+	require.NotNil(t, tlsConfig)
+	assert.True(t, tlsConfig.Verify)
+	assert.Equal(t, proc.systemCA, tlsConfig.TrustedCA)
+	assert.Equal(t, "$host", tlsConfig.ServerName)
+
+	proc.ProcessBackendTLS(map[string]string{"PROXY_BACKEND_TLS_NAME": "api.internal"}, hosts)
+	tlsConfig = h.Locations["/"].BackendTLS
+	require.NotNil(t, tlsConfig)
+	assert.Equal(t, "api.internal", tlsConfig.ServerName)
+}
+
+func TestProcessBackendTLS_ExplicitVerifyOff(t *testing.T) {
+	proc := NewBackendTLSProcessor(&config.Config{BackendTLSVerify: true}, newTestLogger(t))
+
+	h := host.NewHost("api.example.com", 443)
+	h.AddLocation("/", &host.Container{ID: "c1", Address: "172.20.0.5", Port: 8443, Scheme: "https"}, nil)
+	hosts := map[string]map[int]*host.Host{"api.example.com": {443: h}}
+	proc.ProcessBackendTLS(map[string]string{"PROXY_BACKEND_TLS_VERIFY": "off"}, hosts)
+
+	tlsConfig := h.Locations["/"].BackendTLS
+	require.NotNil(t, tlsConfig)
+	assert.False(t, tlsConfig.Verify)
+	assert.Empty(t, tlsConfig.TrustedCA)
+}
+
+func TestBuildBackendTLS_Errors(t *testing.T) {
+	proc := NewBackendTLSProcessor(&config.Config{}, newTestLogger(t))
+	proc.secretsDir = t.TempDir()
+	certFile, _ := writeTestKeyPair(t, t.TempDir())
+
+	_, err := proc.BuildBackendTLS(map[string]string{"PROXY_BACKEND_TLS_CERT": certFile})
+	assert.Error(t, err, "cert without key")
+
+	_, err = proc.BuildBackendTLS(map[string]string{"PROXY_BACKEND_TLS_VERIFY": "maybe"})
+	assert.Error(t, err)
+
+	_, err = proc.BuildBackendTLS(map[string]string{"PROXY_BACKEND_TLS_CA": "secret:missing"})
+	assert.Error(t, err)
+}
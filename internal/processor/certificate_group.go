@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+)
+
+// CertificateGroupProcessor groups the SSL hostnames of a container into one
+// SAN certificate
+type CertificateGroupProcessor struct {
+	log *logger.Logger
+}
+
+// NewCertificateGroupProcessor creates a new certificate group processor
+func NewCertificateGroupProcessor(log *logger.Logger) *CertificateGroupProcessor {
+	return &CertificateGroupProcessor{
+		log: log,
+	}
+}
+
+// ProcessCertificateGroup sets the SAN certificate of the SSL hosts of a container.
+// LETSENCRYPT_HOST lists the names of the certificate explicitly, the first one
+// naming it. Without it all SSL hostnames of the container share a certificate
+// named after the first hostname in alphabetical order. LETSENCRYPT_CHALLENGE
+// selects the ACME challenge type used to validate them and LETSENCRYPT_CA the
+// CA issuing the certificate.
+func (p *CertificateGroupProcessor) ProcessCertificateGroup(env map[string]string, hosts map[string]map[int]*host.Host) {
+	var challenge acme.ChallengeType
+	if name := strings.TrimSpace(env["LETSENCRYPT_CHALLENGE"]); name != "" {
+		parsed, err := acme.ParseChallengeType(name)
+		if err != nil {
+			p.log.Warn("Ignoring LETSENCRYPT_CHALLENGE: %v", err)
+		} else {
+			challenge = parsed
+		}
+	}
+
+	var ca string
+	if name := strings.TrimSpace(env["LETSENCRYPT_CA"]); name != "" {
+		if _, err := acme.CAFromEnv(name); err != nil {
+			p.log.Warn("Ignoring LETSENCRYPT_CA: %v", err)
+		} else {
+			ca = name
+		}
+	}
+
+	var domains []string
+	if strings.TrimSpace(env["LETSENCRYPT_HOST"]) != "" {
+		for _, name := range strings.Split(env["LETSENCRYPT_HOST"], ",") {
+			name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+			if name == "" {
+				continue
+			}
+			if !IsCertificateHostname(name) {
+				p.log.Warn("Ignoring %q in LETSENCRYPT_HOST, it cannot be validated by ACME", name)
+				continue
+			}
+			domains = appendUnique(domains, name)
+		}
+	} else {
+		for hostname, portMap := range hosts {
+			name := strings.ToLower(hostname)
+			for _, h := range portMap {
+				if h.SSLEnabled && IsCertificateHostname(name) {
+					domains = appendUnique(domains, name)
+				}
+			}
+		}
+		sort.Strings(domains)
+	}
+
+	for hostname, portMap := range hosts {
+		name := strings.ToLower(hostname)
+		for _, h := range portMap {
+			if !h.SSLEnabled || !IsCertificateHostname(name) {
+				continue
+			}
+			if containsString(domains, name) {
+				h.SetCertDomains(domains)
+			} else {
+				// SSL hosts missing from LETSENCRYPT_HOST keep a certificate of their own
+				p.log.Debug("%s is not listed in LETSENCRYPT_HOST, using a separate certificate", hostname)
+				h.SetCertDomains([]string{name})
+			}
+			h.SetACMEChallenge(string(challenge))
+			h.SetACMECA(ca)
+		}
+	}
+}
+
+// IsCertificateHostname reports whether an ACME certificate can be issued for
+// a hostname. Wildcards are issued through WILDCARD_DOMAINS instead.
+func IsCertificateHostname(name string) bool {
+	if name == "" || name == "_" || !strings.Contains(name, ".") {
+		return false
+	}
+	if strings.HasPrefix(name, "~") || strings.ContainsAny(name, "*/: ") {
+		return false
+	}
+	return net.ParseIP(name) == nil
+}
+
+// appendUnique appends value to values unless it is already present
+func appendUnique(values []string, value string) []string {
+	if containsString(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessCertificateGroup_ContainerHostnames(t *testing.T) {
+	proc := NewCertificateGroupProcessor(newTestLogger(t))
+	hosts := make(map[string]map[int]*host.Host)
+	for _, name := range []string{"www.example.com", "example.com", "api.example.com"} {
+		h := host.NewHost(name, 443)
+		h.SetSSL(true, name)
+		hosts[name] = map[int]*host.Host{443: h}
+	}
+	plain := host.NewHost("plain.example.com", 80)
+	hosts["plain.example.com"] = map[int]*host.Host{80: plain}
+
+	proc.ProcessCertificateGroup(map[string]string{}, hosts)
+
+	expected := []string{"api.example.com", "example.com", "www.example.com"}
+	for _, name := range expected {
+		h := hosts[name][443]
+		assert.Equal(t, expected, h.CertDomains)
+		assert.Equal(t, "api.example.com", h.CertificateName())
+	}
+	assert.Nil(t, plain.CertDomains)
+	assert.Equal(t, "plain.example.com", plain.CertificateName())
+}
+
+func TestProcessCertificateGroup_LetsEncryptHost(t *testing.T) {
+	proc := NewCertificateGroupProcessor(newTestLogger(t))
+	hosts := make(map[string]map[int]*host.Host)
+	for _, name := range []string{"www.example.com", "example.com", "admin.example.com"} {
+		h := host.NewHost(name, 443)
+		h.SetSSL(true, name)
+		hosts[name] = map[int]*host.Host{443: h}
+	}
+
+	proc.ProcessCertificateGroup(map[string]string{
+		"LETSENCRYPT_HOST": "Example.com, www.example.com., *.example.com, mail.example.com",
+	}, hosts)
+
+	expected := []string{"example.com", "www.example.com", "mail.example.com"}
+	assert.Equal(t, expected, hosts["example.com"][443].CertDomains)
+	assert.Equal(t, expected, hosts["www.example.com"][443].CertDomains)
+	assert.Equal(t, []string{"admin.example.com"}, hosts["admin.example.com"][443].CertDomains)
+}
+
+func TestIsCertificateHostname(t *testing.T) {
+	assert.True(t, IsCertificateHostname("www.example.com"))
+	assert.False(t, IsCertificateHostname("localhost"))
+	assert.False(t, IsCertificateHostname("_"))
+	assert.False(t, IsCertificateHostname("*.example.com"))
+	assert.False(t, IsCertificateHostname("~^api\\.example\\.com$"))
+	assert.False(t, IsCertificateHostname("10.0.0.1"))
+}
+
+func TestProcessCertificateGroup_Challenge(t *testing.T) {
+	proc := NewCertificateGroupProcessor(newTestLogger(t))
+	h := host.NewHost("example.com", 443)
+	h.SetSSL(true, "example.com")
+	hosts := map[string]map[int]*host.Host{"example.com": {443: h}}
+	proc.ProcessCertificateGroup(map[string]string{"LETSENCRYPT_CHALLENGE": "TLS-ALPN-01"}, hosts)
+	assert.Equal(t, "tls-alpn-01", h.ACMEChallenge)
+
+	h = host.NewHost("example.com", 443)
+	h.SetSSL(true, "example.com")
+	hosts = map[string]map[int]*host.Host{"example.com": {443: h}}
+	proc.ProcessCertificateGroup(map[string]string{"LETSENCRYPT_CHALLENGE": "tls-sni-01"}, hosts)
+	assert.Equal(t, "", h.ACMEChallenge)
+}
+
+func TestProcessCertificateGroup_CA(t *testing.T) {
+	proc := NewCertificateGroupProcessor(newTestLogger(t))
+	h := host.NewHost("example.com", 443)
+	h.SetSSL(true, "example.com")
+	hosts := map[string]map[int]*host.Host{"example.com": {443: h}}
+	proc.ProcessCertificateGroup(map[string]string{"LETSENCRYPT_CA": "letsencrypt-staging"}, hosts)
+	assert.Equal(t, "letsencrypt-staging", h.ACMECA)
+
+	h = host.NewHost("example.com", 443)
+	h.SetSSL(true, "example.com")
+	hosts = map[string]map[int]*host.Host{"example.com": {443: h}}
+	proc.ProcessCertificateGroup(map[string]string{"LETSENCRYPT_CA": "no-such-ca"}, hosts)
+	assert.Equal(t, "", h.ACMECA)
+}
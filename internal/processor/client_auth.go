@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+)
+
+// ClientAuthProcessor handles mutual TLS client certificate configuration
+type ClientAuthProcessor struct {
+	secretsDir string
+	log        *logger.Logger
+}
+
+// NewClientAuthProcessor creates a new client certificate auth processor
+func NewClientAuthProcessor(log *logger.Logger) *ClientAuthProcessor {
+	return &ClientAuthProcessor{
+		secretsDir: constants.DockerSecretsDir,
+		log:        log,
+	}
+}
+
+// ProcessClientAuth applies PROXY_CLIENT_* settings to the SSL hosts of a container.
+// Non-SSL hosts are skipped since client certificates are only negotiated over TLS.
+func (p *ClientAuthProcessor) ProcessClientAuth(env map[string]string, hosts map[string]map[int]*host.Host) {
+	caSpec := strings.TrimSpace(env["PROXY_CLIENT_CA"])
+	if caSpec == "" {
+		return
+	}
+
+	caFile, err := p.ResolveCAFile(caSpec)
+	if err != nil {
+		p.log.Warn("Invalid PROXY_CLIENT_CA %q: %v", caSpec, err)
+		return
+	}
+
+	verify, err := ParseClientVerify(env["PROXY_CLIENT_VERIFY"])
+	if err != nil {
+		p.log.Warn("Invalid PROXY_CLIENT_VERIFY: %v", err)
+		return
+	}
+
+	depth := constants.DefaultClientVerifyDepth
+	if depthStr := strings.TrimSpace(env["PROXY_CLIENT_VERIFY_DEPTH"]); depthStr != "" {
+		parsed, err := strconv.Atoi(depthStr)
+		if err != nil || parsed < 0 {
+			p.log.Warn("Invalid PROXY_CLIENT_VERIFY_DEPTH %q, using %d", depthStr, depth)
+		} else {
+			depth = parsed
+		}
+	}
+
+	forwardHeaders := strings.EqualFold(strings.TrimSpace(env["PROXY_CLIENT_CERT_HEADERS"]), "true")
+
+	for _, portMap := range hosts {
+		for _, h := range portMap {
+			if !h.SSLEnabled {
+				p.log.Warn("Ignoring client certificate auth for non-SSL host %s:%d", h.Hostname, h.Port)
+				continue
+			}
+			h.SetClientAuth(caFile, verify, depth, forwardHeaders)
+		}
+	}
+}
+
+// ResolveCAFile resolves a CA bundle reference to a file path. A "secret:<name>"
+// reference points at a Docker secret mounted in the proxy container.
+// The file must contain at least one PEM encoded certificate.
+func (p *ClientAuthProcessor) ResolveCAFile(spec string) (string, error) {
+	return readPEMCertificates(p.secretsDir, spec)
+}
+
+// ParseClientVerify validates an ssl_verify_client mode. Empty defaults to "on".
+func ParseClientVerify(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return "on", nil
+	case "on", "optional":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported verify mode %q (expected on or optional)", mode)
+	}
+}
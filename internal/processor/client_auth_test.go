@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLogger returns a logger writing to the test's temporary directory
+func newTestLogger(t *testing.T) *logger.Logger {
+	logCfg := logger.DefaultConfig()
+	logCfg.OutputPath = filepath.Join(t.TempDir(), "test.log")
+	log, _ := logger.New(logCfg)
+	return log
+}
+
+func writeTestCABundle(t *testing.T, path string) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("test-ca")})
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func TestProcessClientAuth_FilePath(t *testing.T) {
+	proc := NewClientAuthProcessor(newTestLogger(t))
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCABundle(t, caFile)
+
+	h := host.NewHost("admin.example.com", 443)
+	h.SSLEnabled = true
+	hosts := map[string]map[int]*host.Host{"admin.example.com": {443: h}}
+
+	proc.ProcessClientAuth(map[string]string{
+		"PROXY_CLIENT_CA":           caFile,
+		"PROXY_CLIENT_VERIFY":       "optional",
+		"PROXY_CLIENT_VERIFY_DEPTH": "3",
+		"PROXY_CLIENT_CERT_HEADERS": "true",
+	}, hosts)
+
+	assert.Equal(t, caFile, h.ClientCAFile)
+	assert.Equal(t, "optional", h.ClientVerify)
+	assert.Equal(t, 3, h.ClientDepth)
+	assert.True(t, h.ClientHeaders)
+}
+
+func TestProcessClientAuth_DockerSecret(t *testing.T) {
+	proc := NewClientAuthProcessor(newTestLogger(t))
+	proc.secretsDir = t.TempDir()
+	writeTestCABundle(t, filepath.Join(proc.secretsDir, "admin_ca"))
+
+	h := host.NewHost("admin.example.com", 443)
+	h.SSLEnabled = true
+	hosts := map[string]map[int]*host.Host{"admin.example.com": {443: h}}
+
+	proc.ProcessClientAuth(map[string]string{"PROXY_CLIENT_CA": "secret:admin_ca"}, hosts)
+
+	assert.Equal(t, filepath.Join(proc.secretsDir, "admin_ca"), h.ClientCAFile)
+	assert.Equal(t, "on", h.ClientVerify)
+	assert.Equal(t, 1, h.ClientDepth)
+	assert.False(t, h.ClientHeaders)
+}
+
+func TestProcessClientAuth_SkipsNonSSLHosts(t *testing.T) {
+	proc := NewClientAuthProcessor(newTestLogger(t))
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCABundle(t, caFile)
+
+	h := host.NewHost("admin.example.com", 80)
+	hosts := map[string]map[int]*host.Host{"admin.example.com": {80: h}}
+
+	proc.ProcessClientAuth(map[string]string{"PROXY_CLIENT_CA": caFile}, hosts)
+
+	assert.Empty(t, h.ClientCAFile)
+}
+
+func TestProcessClientAuth_InvalidVerifyMode(t *testing.T) {
+	proc := NewClientAuthProcessor(newTestLogger(t))
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCABundle(t, caFile)
+
+	h := host.NewHost("admin.example.com", 443)
+	h.SSLEnabled = true
+	hosts := map[string]map[int]*host.Host{"admin.example.com": {443: h}}
+
+	proc.ProcessClientAuth(map[string]string{
+		"PROXY_CLIENT_CA":     caFile,
+		"PROXY_CLIENT_VERIFY": "optional_no_ca",
+	}, hosts)
+
+	assert.Empty(t, h.ClientCAFile)
+}
+
+func TestResolveCAFile_Errors(t *testing.T) {
+	proc := NewClientAuthProcessor(newTestLogger(t))
+	proc.secretsDir = t.TempDir()
+
+	_, err := proc.ResolveCAFile(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+
+	_, err = proc.ResolveCAFile("secret:../etc/passwd")
+	assert.Error(t, err)
+
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o644))
+	_, err = proc.ResolveCAFile(notPEM)
+	assert.Error(t, err)
+}
@@ -0,0 +1,44 @@
+package processor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+)
+
+// HTTP3Processor decides which SSL hosts are served over HTTP/3
+type HTTP3Processor struct {
+	enabled bool
+	log     *logger.Logger
+}
+
+// NewHTTP3Processor creates a new HTTP/3 processor, enabled is the global
+// default from HTTP3
+func NewHTTP3Processor(enabled bool, log *logger.Logger) *HTTP3Processor {
+	return &HTTP3Processor{
+		enabled: enabled,
+		log:     log,
+	}
+}
+
+// ProcessHTTP3 enables HTTP/3 on the hosts of a container by the global
+// default, or by PROXY_HTTP3 when the container sets it
+func (p *HTTP3Processor) ProcessHTTP3(env map[string]string, hosts map[string]map[int]*host.Host) {
+	enabled := p.enabled
+	if value := strings.TrimSpace(env["PROXY_HTTP3"]); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			p.log.Warn("Ignoring invalid PROXY_HTTP3 %q, expected true or false", value)
+		} else {
+			enabled = parsed
+		}
+	}
+
+	for _, portMap := range hosts {
+		for _, h := range portMap {
+			h.HTTP3 = enabled
+		}
+	}
+}
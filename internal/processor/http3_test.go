@@ -0,0 +1,27 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessHTTP3(t *testing.T) {
+	h := host.NewHost("app.example.com", 443)
+	h.SetSSL(true, "app.example.com")
+	hosts := map[string]map[int]*host.Host{"app.example.com": {443: h}}
+
+	// The global default applies unless the container overrides it
+	NewHTTP3Processor(true, newTestLogger(t)).ProcessHTTP3(map[string]string{}, hosts)
+	assert.True(t, h.HTTP3)
+
+	NewHTTP3Processor(true, newTestLogger(t)).ProcessHTTP3(map[string]string{"PROXY_HTTP3": "false"}, hosts)
+	assert.False(t, h.HTTP3)
+
+	NewHTTP3Processor(false, newTestLogger(t)).ProcessHTTP3(map[string]string{"PROXY_HTTP3": "true"}, hosts)
+	assert.True(t, h.HTTP3)
+
+	NewHTTP3Processor(false, newTestLogger(t)).ProcessHTTP3(map[string]string{"PROXY_HTTP3": "sometimes"}, hosts)
+	assert.False(t, h.HTTP3)
+}
@@ -15,6 +15,7 @@ type IPFilterProcessor struct {
 	globalIPs       []string
 	globalHeader    string
 	globalRecursive string
+	proxyProtocol   []string // Load balancers sending the PROXY protocol, nil when it is not accepted
 	log             *logger.Logger
 }
 
@@ -22,10 +23,16 @@ type IPFilterProcessor struct {
 func NewIPFilterProcessor(cfg *config.Config, log *logger.Logger) *IPFilterProcessor {
 	validIPs, _ := ParseAndValidateCIDRs(strings.Join(cfg.TrustedProxyIPs, ","))
 
+	var proxyProtocolIPs []string
+	if cfg.ProxyProtocol {
+		proxyProtocolIPs, _ = ParseAndValidateCIDRs(strings.Join(cfg.ProxyProtocolIPs, ","))
+	}
+
 	return &IPFilterProcessor{
 		globalIPs:       validIPs,
 		globalHeader:    cfg.RealIPHeader,
 		globalRecursive: cfg.RealIPRecursive,
+		proxyProtocol:   proxyProtocolIPs,
 		log:             log,
 	}
 }
@@ -66,10 +73,21 @@ func (p *IPFilterProcessor) ProcessIPFilter(env map[string]string, hosts map[str
 		realIPHeader = effectiveHeader
 	}
 
+	// Without a header the client address comes from the PROXY protocol, as
+	// configured for all servers. A header replaces it, so the load balancers
+	// the connections come from must be trusted to send the header as well.
+	var realIPFrom []string
+	if realIPHeader != "" && len(p.proxyProtocol) > 0 {
+		realIPFrom = append(append(realIPFrom, effectiveIPs...), p.proxyProtocol...)
+	}
+
 	// Apply to all hosts
 	for _, portMap := range hosts {
 		for _, h := range portMap {
 			h.SetIPFilter(effectiveIPs, true, realIPHeader, effectiveRecursive)
+			if realIPFrom != nil {
+				h.RealIPFrom = realIPFrom
+			}
 		}
 	}
 }
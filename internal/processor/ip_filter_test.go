@@ -217,3 +217,32 @@ func TestProcessIPFilter_PerContainerOverridesGlobalCompletely(t *testing.T) {
 	// Header should fall back to global since not overridden
 	assert.Equal(t, "X-Real-IP", h.RealIPHeader)
 }
+
+func TestProcessIPFilter_ProxyProtocol(t *testing.T) {
+	cfg := &config.Config{
+		TrustedProxyIPs:  []string{"173.245.48.0/20"},
+		RealIPRecursive:  "on",
+		ProxyProtocol:    true,
+		ProxyProtocolIPs: []string{"10.0.0.5"},
+	}
+	logCfg := logger.DefaultConfig()
+	logCfg.OutputPath = ""
+	log, _ := logger.New(logCfg)
+	proc := NewIPFilterProcessor(cfg, log)
+
+	h := host.NewHost("example.com", 80)
+	hosts := map[string]map[int]*host.Host{
+		"example.com": {80: h},
+	}
+
+	// Without a header the client address comes from the PROXY protocol
+	proc.ProcessIPFilter(map[string]string{}, hosts)
+	assert.Equal(t, "", h.RealIPHeader)
+	assert.Equal(t, []string{"173.245.48.0/20"}, h.AllowedIPs)
+
+	// A header must be trusted from the load balancer as well
+	proc.ProcessIPFilter(map[string]string{"PROXY_REAL_IP_HEADER": "CF-Connecting-IP"}, hosts)
+	assert.Equal(t, "CF-Connecting-IP", h.RealIPHeader)
+	assert.Equal(t, []string{"173.245.48.0/20"}, h.AllowedIPs)
+	assert.Equal(t, []string{"173.245.48.0/20", "10.0.0.5/32"}, h.RealIPFrom)
+}
@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+)
+
+// ListenProcessor decides which addresses the servers of hosts bind to
+type ListenProcessor struct {
+	addresses []string
+	log       *logger.Logger
+}
+
+// NewListenProcessor creates a new listen processor, addresses are the global
+// default from LISTEN_ADDRESSES. With dualStack servers listen on [::] as well,
+// next to the IPv4 addresses or 0.0.0.0 when none are given.
+func NewListenProcessor(addresses []string, dualStack bool, log *logger.Logger) *ListenProcessor {
+	parsed, err := host.ParseListenAddresses(strings.Join(addresses, ","))
+	if err != nil {
+		log.Warn("Ignoring invalid LISTEN_ADDRESSES: %v", err)
+	}
+	if dualStack {
+		parsed = dualStackAddresses(parsed)
+	}
+	return &ListenProcessor{
+		addresses: parsed,
+		log:       log,
+	}
+}
+
+// Global returns the addresses servers bind to by default, empty to bind to all
+func (p *ListenProcessor) Global() []string {
+	return p.addresses
+}
+
+// ProcessListen binds the hosts of a container to the global addresses, or to
+// PROXY_LISTEN_ADDRESSES when the container sets it
+func (p *ListenProcessor) ProcessListen(env map[string]string, hosts map[string]map[int]*host.Host) {
+	addresses := p.addresses
+	if value := strings.TrimSpace(env["PROXY_LISTEN_ADDRESSES"]); value != "" {
+		parsed, err := host.ParseListenAddresses(value)
+		if err != nil {
+			p.log.Warn("Ignoring invalid PROXY_LISTEN_ADDRESSES: %v", err)
+		} else {
+			addresses = parsed
+		}
+	}
+
+	for _, portMap := range hosts {
+		for _, h := range portMap {
+			h.ListenAddrs = addresses
+		}
+	}
+}
+
+// dualStackAddresses adds [::] to the addresses, and 0.0.0.0 when they bind to
+// all addresses
+func dualStackAddresses(addresses []string) []string {
+	if len(addresses) == 0 {
+		addresses = []string{"0.0.0.0"}
+	}
+	for _, address := range addresses {
+		if address == "[::]" {
+			return addresses
+		}
+	}
+	return append(addresses, "[::]")
+}
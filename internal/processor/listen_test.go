@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessListen(t *testing.T) {
+	h := host.NewHost("app.example.com", 8443)
+	hosts := map[string]map[int]*host.Host{"app.example.com": {8443: h}}
+
+	// The global default applies unless the container overrides it
+	proc := NewListenProcessor([]string{"0.0.0.0", "::"}, false, newTestLogger(t))
+	assert.Equal(t, []string{"0.0.0.0", "[::]"}, proc.Global())
+
+	proc.ProcessListen(map[string]string{}, hosts)
+	assert.Equal(t, []string{"0.0.0.0", "[::]"}, h.ListenAddrs)
+
+	proc.ProcessListen(map[string]string{"PROXY_LISTEN_ADDRESSES": "192.168.1.10"}, hosts)
+	assert.Equal(t, []string{"192.168.1.10"}, h.ListenAddrs)
+	assert.Equal(t, []string{"192.168.1.10:8443"}, h.Listen(h.Port))
+
+	// Invalid addresses fall back to the global default
+	proc.ProcessListen(map[string]string{"PROXY_LISTEN_ADDRESSES": "lan"}, hosts)
+	assert.Equal(t, []string{"0.0.0.0", "[::]"}, h.ListenAddrs)
+
+	// Without addresses the servers bind to all
+	NewListenProcessor(nil, false, newTestLogger(t)).ProcessListen(map[string]string{}, hosts)
+	assert.Empty(t, h.ListenAddrs)
+	assert.Equal(t, []string{"8443"}, h.Listen(h.Port))
+
+	// Dual-stack servers listen on [::] next to the IPv4 addresses
+	assert.Equal(t, []string{"0.0.0.0", "[::]"}, NewListenProcessor(nil, true, newTestLogger(t)).Global())
+	assert.Equal(t, []string{"192.168.1.10", "[::]"}, NewListenProcessor([]string{"192.168.1.10"}, true, newTestLogger(t)).Global())
+	assert.Equal(t, []string{"[::]", "10.0.0.1"}, NewListenProcessor([]string{"::", "10.0.0.1"}, true, newTestLogger(t)).Global())
+}
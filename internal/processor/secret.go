@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveSecretPath resolves a file reference from a container setting. A
+// "secret:<name>" reference points at a Docker secret mounted in the proxy
+// container; anything else is treated as a path.
+func resolveSecretPath(secretsDir, spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	name, ok := strings.CutPrefix(spec, "secret:")
+	if !ok {
+		return spec, nil
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, `/\`) || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	return filepath.Join(secretsDir, name), nil
+}
+
+// readPEMCertificates resolves a CA bundle reference and ensures the file
+// contains at least one PEM encoded certificate
+func readPEMCertificates(secretsDir, spec string) (string, error) {
+	path, err := resolveSecretPath(secretsDir, spec)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read CA bundle: %w", err)
+	}
+
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return "", fmt.Errorf("no PEM certificates found in %s", path)
+		}
+		if block.Type == "CERTIFICATE" {
+			return path, nil
+		}
+	}
+}
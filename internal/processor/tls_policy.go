@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/config"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+)
+
+// TLSPolicyProcessor resolves the global TLS policy and per-host profile overrides
+type TLSPolicyProcessor struct {
+	global *host.TLSPolicy
+	log    *logger.Logger
+}
+
+// NewTLSPolicyProcessor creates a new TLS policy processor from global config.
+// An invalid global profile or override falls back to the default profile.
+func NewTLSPolicyProcessor(cfg *config.Config, log *logger.Logger) *TLSPolicyProcessor {
+	global, err := host.LookupTLSProfile(cfg.TLSProfile)
+	if err != nil {
+		log.Warn("Invalid TLS_PROFILE: %v, using %s", err, constants.DefaultTLSProfile)
+		global, _ = host.LookupTLSProfile(constants.DefaultTLSProfile)
+	}
+	if err := global.Override(cfg.TLSProtocols, cfg.TLSCiphers, cfg.TLSECDHCurves); err != nil {
+		log.Warn("Ignoring invalid global TLS override: %v", err)
+		global, _ = host.LookupTLSProfile(global.Profile)
+	}
+	global.SessionCache = cfg.TLSSessionCache
+	global.SessionTickets = cfg.TLSSessionTickets
+	if cfg.TLSSessionTimeout != "" {
+		global.SessionTimeout = cfg.TLSSessionTimeout
+	}
+
+	return &TLSPolicyProcessor{
+		global: global,
+		log:    log,
+	}
+}
+
+// Global returns the policy applied to hosts without a per-host override
+func (p *TLSPolicyProcessor) Global() *host.TLSPolicy {
+	return p.global
+}
+
+// ProcessTLSPolicy applies PROXY_TLS_PROFILE, PROXY_TLS_PROTOCOLS and PROXY_TLS_CIPHERS
+// to the SSL hosts of a container. Session cache settings stay global since nginx
+// shares the cache zone between servers.
+func (p *TLSPolicyProcessor) ProcessTLSPolicy(env map[string]string, hosts map[string]map[int]*host.Host) {
+	profileName := strings.TrimSpace(env["PROXY_TLS_PROFILE"])
+	protocols := strings.TrimSpace(env["PROXY_TLS_PROTOCOLS"])
+	ciphers := strings.TrimSpace(env["PROXY_TLS_CIPHERS"])
+	if profileName == "" && protocols == "" && ciphers == "" {
+		return
+	}
+
+	var policy *host.TLSPolicy
+	if profileName != "" {
+		profile, err := host.LookupTLSProfile(profileName)
+		if err != nil {
+			p.log.Warn("Invalid PROXY_TLS_PROFILE: %v", err)
+			return
+		}
+		policy = profile
+		policy.SessionTimeout = p.global.SessionTimeout
+	} else {
+		copied := *p.global
+		copied.DHParamFile = ""
+		policy = &copied
+	}
+	policy.SessionTickets = p.global.SessionTickets
+
+	if err := policy.Override(protocols, ciphers, ""); err != nil {
+		p.log.Warn("Invalid per-host TLS override: %v", err)
+		return
+	}
+
+	for _, portMap := range hosts {
+		for _, h := range portMap {
+			if h.SSLEnabled {
+				h.SetTLSPolicy(policy)
+			}
+		}
+	}
+}
+
+// EffectivePolicy returns the TLS policy that applies to a host
+func (p *TLSPolicyProcessor) EffectivePolicy(h *host.Host) *host.TLSPolicy {
+	if h.TLSPolicy != nil {
+		return h.TLSPolicy
+	}
+	return p.global
+}
+
+// SetDHParamFile enables ssl_dhparam on the global policy once the file exists
+func (p *TLSPolicyProcessor) SetDHParamFile(path string) {
+	p.global.DHParamFile = path
+}
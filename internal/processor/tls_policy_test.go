@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/config"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTLSPolicyProcessor(t *testing.T, cfg *config.Config) *TLSPolicyProcessor {
+	if cfg.TLSProfile == "" {
+		cfg.TLSProfile = constants.DefaultTLSProfile
+	}
+	return NewTLSPolicyProcessor(cfg, newTestLogger(t))
+}
+
+func newTLSPolicyHosts(ssl bool) (*host.Host, map[string]map[int]*host.Host) {
+	port := 80
+	if ssl {
+		port = 443
+	}
+	h := host.NewHost("app.example.com", port)
+	if ssl {
+		h.SetSSL(true, "app.example.com")
+	}
+	return h, map[string]map[int]*host.Host{"app.example.com": {port: h}}
+}
+
+func TestLookupTLSProfile(t *testing.T) {
+	modern, err := host.LookupTLSProfile("Modern")
+	require.NoError(t, err)
+	assert.Equal(t, "TLSv1.3", modern.Protocols)
+	assert.Empty(t, modern.Ciphers)
+
+	// Lookups return copies so callers cannot alter the built-in profiles
+	modern.Protocols = "TLSv1.2"
+	again, _ := host.LookupTLSProfile("modern")
+	assert.Equal(t, "TLSv1.3", again.Protocols)
+
+	_, err = host.LookupTLSProfile("paranoid")
+	assert.Error(t, err)
+}
+
+func TestTLSPolicyOverride(t *testing.T) {
+	policy, _ := host.LookupTLSProfile("intermediate")
+	require.NoError(t, policy.Override("TLSv1.2  TLSv1.3", "", ""))
+	assert.Equal(t, "TLSv1.2 TLSv1.3", policy.Protocols)
+	assert.Equal(t, "intermediate+custom", policy.Name())
+
+	assert.Error(t, policy.Override("SSLv3", "", ""))
+	assert.Error(t, policy.Override("", "AES128-SHA; include /etc/passwd", ""))
+	assert.Error(t, policy.Override("", "", "X25519 }"))
+}
+
+func TestNewTLSPolicyProcessorGlobal(t *testing.T) {
+	proc := newTestTLSPolicyProcessor(t, &config.Config{
+		TLSProfile:        "old",
+		TLSSessionCache:   "shared:SSL:10m",
+		TLSSessionTimeout: "4h",
+	})
+	global := proc.Global()
+	assert.Equal(t, "old", global.Name())
+	assert.True(t, global.PreferServerCiphers)
+	assert.Equal(t, "shared:SSL:10m", global.SessionCache)
+	assert.Equal(t, "4h", global.SessionTimeout)
+
+	// Invalid settings fall back to the default profile
+	proc = newTestTLSPolicyProcessor(t, &config.Config{TLSProfile: "bogus"})
+	assert.Equal(t, constants.DefaultTLSProfile, proc.Global().Name())
+
+	proc = newTestTLSPolicyProcessor(t, &config.Config{TLSProfile: "modern", TLSProtocols: "SSLv2"})
+	assert.Equal(t, "modern", proc.Global().Name())
+	assert.Equal(t, "TLSv1.3", proc.Global().Protocols)
+}
+
+func TestProcessTLSPolicy(t *testing.T) {
+	proc := newTestTLSPolicyProcessor(t, &config.Config{})
+
+	t.Run("no settings keeps global policy", func(t *testing.T) {
+		h, hosts := newTLSPolicyHosts(true)
+		proc.ProcessTLSPolicy(map[string]string{}, hosts)
+		assert.Nil(t, h.TLSPolicy)
+		assert.Same(t, proc.Global(), proc.EffectivePolicy(h))
+	})
+
+	t.Run("profile override", func(t *testing.T) {
+		h, hosts := newTLSPolicyHosts(true)
+		proc.ProcessTLSPolicy(map[string]string{"PROXY_TLS_PROFILE": "modern"}, hosts)
+		require.NotNil(t, h.TLSPolicy)
+		assert.Equal(t, "modern", h.TLSPolicy.Name())
+		assert.Equal(t, "TLSv1.3", proc.EffectivePolicy(h).Protocols)
+	})
+
+	t.Run("protocol override on global profile", func(t *testing.T) {
+		h, hosts := newTLSPolicyHosts(true)
+		proc.SetDHParamFile("/etc/nginx/dhparam/dhparam.pem")
+		proc.ProcessTLSPolicy(map[string]string{"PROXY_TLS_PROTOCOLS": "TLSv1.3"}, hosts)
+		require.NotNil(t, h.TLSPolicy)
+		assert.Equal(t, "intermediate+custom", h.TLSPolicy.Name())
+		assert.Empty(t, h.TLSPolicy.DHParamFile)
+		assert.Equal(t, "TLSv1.2 TLSv1.3", proc.Global().Protocols)
+	})
+
+	t.Run("invalid profile is ignored", func(t *testing.T) {
+		h, hosts := newTLSPolicyHosts(true)
+		proc.ProcessTLSPolicy(map[string]string{"PROXY_TLS_PROFILE": "bogus"}, hosts)
+		assert.Nil(t, h.TLSPolicy)
+	})
+
+	t.Run("non-SSL host is untouched", func(t *testing.T) {
+		h, hosts := newTLSPolicyHosts(false)
+		proc.ProcessTLSPolicy(map[string]string{"PROXY_TLS_PROFILE": "modern"}, hosts)
+		assert.Nil(t, h.TLSPolicy)
+	})
+}
@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+)
+
+// composeServiceLabel is the label Docker Compose sets to the service name of
+// its containers
+const composeServiceLabel = "com.docker.compose.service"
+
+// UpstreamDNSProcessor decides which containers are proxied to by a DNS name
+// nginx resolves at runtime rather than by the address they had when inspected
+type UpstreamDNSProcessor struct {
+	enabled bool
+	log     *logger.Logger
+}
+
+// NewUpstreamDNSProcessor creates a new upstream DNS processor, enabled is the
+// global default from UPSTREAM_DNS
+func NewUpstreamDNSProcessor(enabled bool, log *logger.Logger) *UpstreamDNSProcessor {
+	return &UpstreamDNSProcessor{
+		enabled: enabled,
+		log:     log,
+	}
+}
+
+// ProcessUpstreamDNS sets the DNS name of the container in the locations of its
+// hosts. PROXY_UPSTREAM_DNS set to true or false overrides the global default,
+// any other value is the name to use. The name defaults to the Compose service
+// of the container, then its first alias on a known network, then its name.
+func (p *UpstreamDNSProcessor) ProcessUpstreamDNS(container types.ContainerJSON, env map[string]string, knownNetworks map[string]string, hosts map[string]map[int]*host.Host) {
+	name := ""
+	enabled := p.enabled
+	if value := strings.TrimSpace(env["PROXY_UPSTREAM_DNS"]); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			enabled = parsed
+		} else {
+			enabled, name = true, value
+		}
+	}
+	if !enabled {
+		return
+	}
+	if name == "" {
+		name = containerDNSName(container, knownNetworks)
+	}
+	if name == "" {
+		p.log.Warn("No DNS name for container %s, proxying to its address", container.ID)
+		return
+	}
+
+	for _, portMap := range hosts {
+		for _, h := range portMap {
+			for _, location := range h.Locations {
+				for _, c := range location.Containers {
+					if c.ID == container.ID {
+						c.DNSName = name
+					}
+				}
+			}
+		}
+	}
+}
+
+// containerDNSName returns the name Docker's embedded DNS server resolves to
+// the container on a known network
+func containerDNSName(container types.ContainerJSON, knownNetworks map[string]string) string {
+	if container.Config != nil {
+		if service := container.Config.Labels[composeServiceLabel]; service != "" {
+			return service
+		}
+	}
+
+	if container.NetworkSettings != nil {
+		names := make([]string, 0, len(container.NetworkSettings.Networks))
+		for name := range container.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			network := container.NetworkSettings.Networks[name]
+			if network == nil {
+				continue
+			}
+			if _, exists := knownNetworks[network.NetworkID]; !exists {
+				continue
+			}
+			for _, alias := range network.Aliases {
+				// Docker adds the short container ID as an alias
+				if alias != "" && !strings.HasPrefix(container.ID, alias) {
+					return alias
+				}
+			}
+		}
+	}
+
+	if container.ContainerJSONBase != nil {
+		return strings.TrimPrefix(container.Name, "/")
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessUpstreamDNS(t *testing.T) {
+	knownNetworks := map[string]string{"n1": "frontend"}
+	cont := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "0123456789ab", Name: "/project-web-1"},
+		Config:            &container.Config{Labels: map[string]string{composeServiceLabel: "web"}},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"frontend": {NetworkID: "n1", IPAddress: "172.20.0.10", Aliases: []string{"0123456789ab", "web-alias"}},
+			},
+		},
+	}
+	c := &host.Container{ID: cont.ID, Address: "172.20.0.10", Port: 8080}
+	h := host.NewHost("app.example.com", 80)
+	h.AddLocation("/", c, map[string]string{})
+	hosts := map[string]map[int]*host.Host{"app.example.com": {80: h}}
+
+	// The Compose service name balances replicas by DNS
+	NewUpstreamDNSProcessor(true, newTestLogger(t)).ProcessUpstreamDNS(cont, map[string]string{}, knownNetworks, hosts)
+	assert.Equal(t, "web", c.DNSName)
+
+	// Without it the first alias that is not the short ID is used
+	cont.Config.Labels = nil
+	c.DNSName = ""
+	NewUpstreamDNSProcessor(true, newTestLogger(t)).ProcessUpstreamDNS(cont, map[string]string{}, knownNetworks, hosts)
+	assert.Equal(t, "web-alias", c.DNSName)
+
+	// Then the container name
+	c.DNSName = ""
+	NewUpstreamDNSProcessor(true, newTestLogger(t)).ProcessUpstreamDNS(cont, map[string]string{}, map[string]string{}, hosts)
+	assert.Equal(t, "project-web-1", c.DNSName)
+
+	// Containers opt in, out or name themselves with PROXY_UPSTREAM_DNS
+	c.DNSName = ""
+	NewUpstreamDNSProcessor(false, newTestLogger(t)).ProcessUpstreamDNS(cont, map[string]string{}, knownNetworks, hosts)
+	assert.Empty(t, c.DNSName)
+
+	NewUpstreamDNSProcessor(false, newTestLogger(t)).ProcessUpstreamDNS(cont, map[string]string{"PROXY_UPSTREAM_DNS": "true"}, knownNetworks, hosts)
+	assert.Equal(t, "web-alias", c.DNSName)
+
+	c.DNSName = ""
+	NewUpstreamDNSProcessor(true, newTestLogger(t)).ProcessUpstreamDNS(cont, map[string]string{"PROXY_UPSTREAM_DNS": "false"}, knownNetworks, hosts)
+	assert.Empty(t, c.DNSName)
+
+	NewUpstreamDNSProcessor(false, newTestLogger(t)).ProcessUpstreamDNS(cont, map[string]string{"PROXY_UPSTREAM_DNS": "api.internal"}, knownNetworks, hosts)
+	assert.Equal(t, "api.internal", c.DNSName)
+	assert.Equal(t, "api.internal:8080", h.Locations["/"].DNSTarget())
+}
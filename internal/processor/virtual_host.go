@@ -67,6 +67,10 @@ func (p *VirtualHostProcessor) Process(cont types.Container) ([]*host.Host, erro
 
 	// Process each virtual host
 	for _, vh := range virtualHosts {
+		// TLS passthrough hosts are streams, see ProcessVirtualStreams
+		if host.IsPassthroughVirtualHost(vh) {
+			continue
+		}
 		config, err := host.ParseVirtualHost(vh)
 		if err != nil {
 			log.Printf("Error parsing virtual host %s: %v", vh, err)
@@ -203,8 +207,9 @@ func (p *VirtualHostProcessor) ProcessStaticHosts(staticHosts []string) ([]*host
 	return hosts, nil
 }
 
-// ProcessVirtualHosts processes virtual host configurations from container environment variables
-func ProcessVirtualHosts(container types.ContainerJSON, env map[string]string, knownNetworks map[string]string) map[string]*host.Host {
+// ProcessVirtualHosts processes virtual host configurations from container environment variables,
+// proxying to the container's address in the family families prefer on its network
+func ProcessVirtualHosts(container types.ContainerJSON, env map[string]string, knownNetworks map[string]string, families *AddressFamilies) map[string]*host.Host {
 	hosts := make(map[string]*host.Host)
 
 	// Get virtual host configurations
@@ -223,16 +228,7 @@ func ProcessVirtualHosts(container types.ContainerJSON, env map[string]string, k
 	}
 
 	// Get container IP address from known networks
-	var containerIP string
-	for _, network := range container.NetworkSettings.Networks {
-		if network.NetworkID != "" {
-			if _, exists := knownNetworks[network.NetworkID]; exists {
-				containerIP = network.IPAddress
-				break
-			}
-		}
-	}
-
+	containerIP := ContainerAddress(container, knownNetworks, families)
 	if containerIP == "" {
 		return hosts
 	}
@@ -362,6 +358,11 @@ func ProcessVirtualHosts(container types.ContainerJSON, env map[string]string, k
 
 // parseHostEntry parses a host entry and returns the host, location, container data, and extras
 func parseHostEntry(hostConfig string) (*host.Host, string, *host.Container, map[string]string) {
+	// TLS passthrough hosts are streams, see ProcessVirtualStreams
+	if host.IsPassthroughVirtualHost(hostConfig) {
+		return nil, "", nil, nil
+	}
+
 	config, err := host.ParseVirtualHost(hostConfig)
 	if err != nil {
 		log.Printf("Error parsing virtual host %s: %v", hostConfig, err)
@@ -29,7 +29,7 @@ func TestProcessVirtualHosts(t *testing.T) {
 	knownNetworks := map[string]string{"n1": "frontend"}
 	env := map[string]string{"VIRTUAL_HOST": "https://app.example.com -> :8080/api"}
 
-	result := ProcessVirtualHosts(cont, env, knownNetworks)
+	result := ProcessVirtualHosts(cont, env, knownNetworks, nil)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 host, got %d", len(result))
 	}
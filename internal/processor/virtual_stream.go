@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+)
+
+// ProcessVirtualStreams processes the VIRTUAL_STREAM environment variables of a
+// container, and its tls-passthrough VIRTUAL_HOST variables, into streams keyed
+// by host.StreamKey. PROXY_PROTOCOL_BACKEND asks for connections to the
+// container to start with a PROXY protocol header.
+func ProcessVirtualStreams(container types.ContainerJSON, env map[string]string, knownNetworks map[string]string, families *AddressFamilies) map[string]*host.Host {
+	streams := make(map[string]*host.Host)
+
+	virtualStreams := make([]string, 0)
+	for k, v := range env {
+		if strings.HasPrefix(k, "VIRTUAL_STREAM") ||
+			(strings.HasPrefix(k, "VIRTUAL_HOST") && host.IsPassthroughVirtualHost(v)) {
+			virtualStreams = append(virtualStreams, v)
+		}
+	}
+	if len(virtualStreams) == 0 {
+		return streams
+	}
+
+	// Get container IP address from known networks
+	containerIP := ContainerAddress(container, knownNetworks, families)
+	if containerIP == "" {
+		return streams
+	}
+
+	var proxyProtocol bool
+	if value := strings.TrimSpace(env["PROXY_PROTOCOL_BACKEND"]); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("Ignoring invalid PROXY_PROTOCOL_BACKEND %q, expected true or false", value)
+		}
+		proxyProtocol = parsed
+	}
+
+	for _, streamConfig := range virtualStreams {
+		config, err := host.ParseVirtualStream(streamConfig)
+		if err != nil {
+			log.Printf("Error parsing virtual stream %s: %v", streamConfig, err)
+			continue
+		}
+
+		key := host.StreamKey(config.Protocol, config.Hostname, config.ListenPort)
+		h, exists := streams[key]
+		if !exists {
+			h = host.NewStream(config.Protocol, config.Hostname, config.ListenPort)
+			streams[key] = h
+		}
+		h.AddLocation("/", &host.Container{
+			ID:            container.ID,
+			Address:       containerIP,
+			Port:          config.ContainerPort,
+			Scheme:        config.Protocol,
+			ProxyProtocol: proxyProtocol,
+		}, nil)
+	}
+
+	return streams
+}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
+)
+
+func TestProcessVirtualStreams(t *testing.T) {
+	env := map[string]string{
+		"VIRTUAL_STREAM":   "tcp://:5432",
+		"VIRTUAL_STREAM_1": "tls://db.example.com:6432 -> :5432",
+		"VIRTUAL_STREAM_2": "udp://dns.example.com:53",
+		"VIRTUAL_HOST":     "tls-passthrough://secure.example.com -> :8443",
+	}
+	cont := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:   "123",
+			Name: "/db",
+		},
+		Config: &container.Config{},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"frontend": {NetworkID: "n1", IPAddress: "172.20.0.10"},
+			},
+		},
+	}
+
+	result := ProcessVirtualStreams(cont, env, map[string]string{"n1": "frontend"}, nil)
+	if len(result) != 3 {
+		t.Fatalf("expected 3 streams, got %d", len(result))
+	}
+
+	s, ok := result["tcp:5432:"]
+	if !ok {
+		t.Fatalf("expected stream key tcp:5432:")
+	}
+	containers := s.Locations["/"].GetContainers()
+	if len(containers) != 1 || containers[0].Address != "172.20.0.10" || containers[0].Port != 5432 {
+		t.Fatalf("expected container 172.20.0.10:5432, got %v", containers)
+	}
+
+	s, ok = result["tls:6432:db.example.com"]
+	if !ok {
+		t.Fatalf("expected stream key tls:6432:db.example.com")
+	}
+	if s.Scheme != host.StreamTLS || !s.SSLEnabled || s.SSLFile != "db.example.com" {
+		t.Fatalf("expected TLS stream with certificate db.example.com")
+	}
+	if port := s.Locations["/"].GetContainers()[0].Port; port != 5432 {
+		t.Fatalf("expected container port 5432, got %d", port)
+	}
+
+	s, ok = result["tcp:443:secure.example.com"]
+	if !ok || !s.IsPassthrough() {
+		t.Fatalf("expected passthrough stream key tcp:443:secure.example.com")
+	}
+	if port := s.Locations["/"].GetContainers()[0].Port; port != 8443 {
+		t.Fatalf("expected container port 8443, got %d", port)
+	}
+
+	// Passthrough hosts are not HTTP hosts
+	if hosts := ProcessVirtualHosts(cont, env, map[string]string{"n1": "frontend"}, nil); len(hosts) != 0 {
+		t.Fatalf("expected no virtual hosts, got %d", len(hosts))
+	}
+
+	if s.Locations["/"].GetContainers()[0].ProxyProtocol {
+		t.Fatalf("expected no PROXY protocol without PROXY_PROTOCOL_BACKEND")
+	}
+
+	env["PROXY_PROTOCOL_BACKEND"] = "true"
+	result = ProcessVirtualStreams(cont, env, map[string]string{"n1": "frontend"}, nil)
+	for key, s := range result {
+		if !s.Locations["/"].GetContainers()[0].ProxyProtocol {
+			t.Fatalf("expected PROXY protocol to the container of stream %s", key)
+		}
+	}
+
+	// Containers on unknown networks are not proxied to
+	result = ProcessVirtualStreams(cont, env, map[string]string{"n2": "backend"}, nil)
+	if len(result) != 0 {
+		t.Fatalf("expected no streams, got %d", len(result))
+	}
+}
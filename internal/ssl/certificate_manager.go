@@ -3,12 +3,10 @@ package ssl
 import (
 	"context"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
-	"math/big"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +14,8 @@ import (
 	"time"
 
 	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/rahulshinde/nginx-proxy-go/internal/notify"
 )
 
 // Logger interface for certificate manager
@@ -37,14 +37,41 @@ type CertificateOptions struct {
 	AccountKeyPath string
 }
 
+// ECDSASuffix is appended to the certificate name of the ECDSA certificate held
+// alongside an RSA certificate
+const ECDSASuffix = ".ecdsa"
+
+// CertificateGroup is a set of domains sharing one certificate, named after
+// the first domain
+type CertificateGroup struct {
+	Domains   []string
+	Challenge acme.ChallengeType // Empty selects the default challenge
+	CA        string             // CA name or directory URL, empty for the default CA
+}
+
 // CertificateManager manages SSL certificates
 type CertificateManager struct {
 	sslPath       string
 	acmeManager   *acme.Manager
 	logger        Logger
-	certCache     map[string]time.Time
-	blacklist     map[string]time.Time
-	selfSigned    map[string]bool
+	ocsp          *OCSPStapler
+	state         *stateStore // Metadata, failures and renewal schedule of every certificate
+	onUpdate      func()
+	keyType       acme.KeyType
+	dualCert      bool
+	localCA       *LocalCA // Issues certificates instead of ACME when set
+	notifier      *notify.Notifier
+	expiryWarning time.Duration // Certificates expiring within it are reported
+	failureAlert  int           // Certificates failing this many times in a row are reported
+	wildcards     []string
+	groups        map[string]CertificateGroup // Certificate name to the group it covers
+	groupsMu      sync.Mutex
+	pending       map[string]bool                // Certificates being obtained in the background
+	heldBack      bool                           // Groups were left to a wildcard certificate being obtained
+	index         map[string]*indexedCertificate // Certificates on disk by name
+	watchDelay    time.Duration
+	watchMu       sync.Mutex
+	selfSignedMu  sync.Mutex // Serializes writing self-signed certificates
 	mu            sync.RWMutex
 	renewalCtx    context.Context
 	renewalCancel context.CancelFunc
@@ -59,9 +86,12 @@ func NewCertificateManager(sslPath string, acmeManager *acme.Manager, logger Log
 		sslPath:       sslPath,
 		acmeManager:   acmeManager,
 		logger:        logger,
-		certCache:     make(map[string]time.Time),
-		blacklist:     make(map[string]time.Time),
-		selfSigned:    make(map[string]bool),
+		groups:        make(map[string]CertificateGroup),
+		pending:       make(map[string]bool),
+		index:         make(map[string]*indexedCertificate),
+		watchDelay:    certificateWatchDelay,
+		ocsp:          NewOCSPStapler(filepath.Join(sslPath, "ocsp"), logger),
+		keyType:       acme.DefaultKeyType,
 		renewalCtx:    ctx,
 		renewalCancel: cancel,
 	}
@@ -71,6 +101,18 @@ func NewCertificateManager(sslPath string, acmeManager *acme.Manager, logger Log
 	os.MkdirAll(filepath.Join(sslPath, "private"), 0755)
 	os.MkdirAll(filepath.Join(sslPath, "accounts"), 0755)
 
+	state, err := newStateStore(filepath.Join(sslPath, "state.json"))
+	if err != nil {
+		logger.Warn("Failed to load the certificate state, it is rebuilt: %v", err)
+	}
+	cm.state = state
+	cm.rebuildState()
+
+	// Certificates are issued to one ACME account per CA
+	if acmeManager != nil {
+		acmeManager.SetAccountDir(filepath.Join(sslPath, "accounts"))
+	}
+
 	// Start renewal thread
 	cm.startRenewalThread()
 
@@ -84,36 +126,58 @@ func (cm *CertificateManager) startRenewalThread() {
 		defer cm.renewalWG.Done()
 		cm.logger.Info("SSL certificate renewal thread started")
 
-		ticker := time.NewTicker(24 * time.Hour) // Check daily
+		ticker := time.NewTicker(renewalCheckInterval)
 		defer ticker.Stop()
 
+		ocspTicker := time.NewTicker(time.Hour) // OCSP responses are refreshed at half their validity
+		defer ocspTicker.Stop()
+
 		for {
 			select {
 			case <-cm.renewalCtx.Done():
 				cm.logger.Info("SSL certificate renewal thread stopped")
 				return
 			case <-ticker.C:
+				if cm.EnsureWildcardCertificates() {
+					cm.notifyUpdate()
+				}
 				cm.checkAndRenewCertificates()
+			case <-ocspTicker.C:
+				cm.refreshOCSPResponses()
 			}
 		}
 	}()
 }
 
-// checkAndRenewCertificates checks and renews certificates that are about to expire
+// checkAndRenewCertificates renews the managed certificates whose scheduled
+// renewal time has come, and retries the certificates that could not be
+// obtained once their backoff is over
 func (cm *CertificateManager) checkAndRenewCertificates() {
-	cm.mu.RLock()
 	var toRenew []string
 	now := time.Now()
 
-	for domain, expiry := range cm.certCache {
-		daysRemaining := int(expiry.Sub(now).Hours() / 24)
-		cm.logger.Info("Certificate for %s expires in %d days", domain, daysRemaining)
+	for _, domain := range cm.renewalCandidates() {
+		cert, err := cm.loadCertificate(domain)
+		if err != nil {
+			continue
+		}
+		daysRemaining := int(cert.NotAfter.Sub(now).Hours() / 24)
+		cm.notifyExpiry(domain, cert.NotAfter, cert.DNSNames, now)
+
+		// Certificates provided by the user are never renewed
+		if !cm.isManaged(domain) {
+			if cert.NotAfter.Sub(now) <= constants.CertificateRenewalThreshold {
+				cm.logger.Warn("Certificate for %s expires in %d days and is not managed through ACME", domain, daysRemaining)
+			}
+			continue
+		}
 
-		if daysRemaining <= 7 { // Renew certificates expiring in 7 days or less
+		schedule := cm.scheduleRenewal(domain, cert, now)
+		cm.logger.Debug("Certificate for %s expires in %d days, renewal at %s", domain, daysRemaining, schedule.RenewAt.Format(time.RFC3339))
+		if !now.Before(schedule.RenewAt) && !cm.inBackoff(domain) {
 			toRenew = append(toRenew, domain)
 		}
 	}
-	cm.mu.RUnlock()
 
 	if len(toRenew) > 0 {
 		cm.logger.Info("Renewing certificates for domains: %v", toRenew)
@@ -123,20 +187,382 @@ func (cm *CertificateManager) checkAndRenewCertificates() {
 			}
 		}
 	}
+	cm.retryFailedCertificates()
+	cm.notifyFailures()
 }
 
-// GetCertificate gets or creates a certificate for the given domain
-func (cm *CertificateManager) GetCertificate(domain string) (string, error) {
+// retryFailedCertificates requests again the certificates of container groups
+// that failed to be obtained and are past their backoff. Wildcard certificates
+// are retried by EnsureWildcardCertificates.
+func (cm *CertificateManager) retryFailedCertificates() {
+	var groups []CertificateGroup
+	for name, state := range cm.state.All() {
+		if state.Failures == 0 || cm.inBackoff(name) || cm.certificateExists(name) {
+			continue
+		}
+		if group := cm.group(name); group.Domains != nil {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) > 0 {
+		cm.RequestCertificates(groups)
+	}
+}
+
+// SetKeyType sets the key type of new certificates. With dual enabled, ACME
+// certificates are obtained twice: an RSA certificate in <domain>.crt and an
+// ECDSA certificate in <domain>.ecdsa.crt.
+func (cm *CertificateManager) SetKeyType(kt acme.KeyType, dual bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.keyType = kt
+	cm.dualCert = dual
+}
+
+// issuanceSettings returns the key types and the local CA certificates are
+// issued with. The second key type is empty without dual certificates.
+func (cm *CertificateManager) issuanceSettings() (keyType, dualKeyType acme.KeyType, localCA *LocalCA) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	keyType = cm.keyType
+	if cm.dualCert {
+		keyType, dualKeyType = acme.DualKeyTypes(cm.keyType)
+	}
+	return keyType, dualKeyType, cm.localCA
+}
+
+// SetWildcardDomains sets the domains holding a wildcard certificate. Each
+// certificate covers *.domain and the domain itself and is shared by all hosts
+// it covers.
+func (cm *CertificateManager) SetWildcardDomains(domains []string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.wildcards = nil
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(domain, ".")), "*.")
+		if domain != "" {
+			cm.wildcards = append(cm.wildcards, domain)
+		}
+	}
+}
+
+// ClaimWildcardCertificates marks the missing wildcard certificates as being
+// obtained, so RequestCertificates does not issue certificates for the names
+// they cover until EnsureWildcardCertificates is done with them
+func (cm *CertificateManager) ClaimWildcardCertificates() {
+	cm.mu.RLock()
+	domains := append([]string(nil), cm.wildcards...)
+	cm.mu.RUnlock()
+
+	for _, domain := range domains {
+		name := "*." + domain
+		if !cm.certificateExists(name) && !cm.inBackoff(name) {
+			cm.mu.Lock()
+			cm.pending[name] = true
+			cm.mu.Unlock()
+		}
+	}
+}
+
+// EnsureWildcardCertificates obtains the wildcard certificates that are
+// missing or about to expire. It returns true if any certificate was obtained,
+// or if groups left to a wildcard certificate that could not be obtained now
+// need their own.
+func (cm *CertificateManager) EnsureWildcardCertificates() bool {
+	cm.mu.RLock()
+	domains := append([]string(nil), cm.wildcards...)
+	cm.mu.RUnlock()
+
+	obtained, failed := false, false
+	for _, domain := range domains {
+		name := "*." + domain
+		if cm.certificateExists(name) {
+			if expiry, err := cm.getCertificateExpiry(name); err == nil && time.Until(expiry) > constants.CertificateRenewalThreshold {
+				cm.releaseWildcard(name)
+				cm.recordCertificate(name)
+				continue
+			}
+		}
+		if cm.inBackoff(name) {
+			failed = cm.releaseWildcard(name) || failed
+			continue
+		}
+
+		err := cm.obtainCertificate(name)
+		released := cm.releaseWildcard(name)
+		if err != nil {
+			cm.logger.Error("Failed to obtain wildcard certificate for %s: %v", domain, err)
+			failed = released || failed
+			continue
+		}
+		obtained = true
+	}
+
+	cm.mu.Lock()
+	heldBack := cm.heldBack
+	if !cm.hasPendingWildcard() {
+		cm.heldBack = false
+	}
+	cm.mu.Unlock()
+	return obtained || (failed && heldBack)
+}
+
+// releaseWildcard ends the claim on a wildcard certificate, reporting whether
+// it was claimed
+func (cm *CertificateManager) releaseWildcard(name string) bool {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
+	claimed := cm.pending[name]
+	delete(cm.pending, name)
+	return claimed
+}
+
+// hasPendingWildcard reports whether a wildcard certificate is claimed. The
+// caller must hold cm.mu.
+func (cm *CertificateManager) hasPendingWildcard() bool {
+	for _, domain := range cm.wildcards {
+		if cm.pending["*."+domain] {
+			return true
+		}
+	}
+	return false
+}
+
+// coveredByPendingWildcards reports whether every domain is covered by a
+// wildcard certificate being obtained
+func (cm *CertificateManager) coveredByPendingWildcards(domains []string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	for _, domain := range domains {
+		if !cm.pending["*."+domain] && !cm.pending[cm.getWildcardDomain(domain)] {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestCertificates obtains in the background the certificates of groups of
+// domains that are missing or do not cover exactly the domains of their group.
+// The first domain of a group names the certificate. Groups served entirely by
+// other certificates in the index are not requested. Certificates not marked as
+// obtained through ACME were provided by the user and are never replaced.
+func (cm *CertificateManager) RequestCertificates(groups []CertificateGroup) {
+	for _, group := range groups {
+		domains := group.Domains
+		if len(domains) == 0 {
+			continue
+		}
+		name := domains[0]
+
+		cm.groupsMu.Lock()
+		cm.groups[name] = group
+		cm.groupsMu.Unlock()
+
+		if cm.certificateExists(name) {
+			if !cm.isManaged(name) {
+				continue
+			}
+			if !cm.issuedByCurrentCA(name) {
+				cm.logger.Info("Certificate %s was issued in another SSL mode, obtaining a new one", name)
+			} else if cm.certificateMatches(name, domains) {
+				cm.recordCertificate(name)
+				continue
+			} else {
+				cm.logger.Info("Certificate %s does not match %s, obtaining a new one", name, strings.Join(domains, ", "))
+			}
+		} else if cm.coveredByCertificates(domains) {
+			continue
+		} else if cm.coveredByPendingWildcards(domains) {
+			// The wildcard certificate will serve them, unless it cannot be
+			// obtained
+			cm.mu.Lock()
+			cm.heldBack = true
+			cm.mu.Unlock()
+			continue
+		}
+
+		cm.mu.Lock()
+		if cm.pending[name] || cm.inBackoff(name) {
+			cm.mu.Unlock()
+			continue
+		}
+		cm.pending[name] = true
+		cm.mu.Unlock()
+
+		cm.renewalWG.Add(1)
+		go cm.obtainGroupCertificate(name)
+	}
+}
+
+// obtainGroupCertificate obtains the certificate of a group, falling back to a
+// self-signed certificate when the CA cannot validate the domains
+func (cm *CertificateManager) obtainGroupCertificate(name string) {
+	defer cm.renewalWG.Done()
 
+	err := cm.obtainCertificate(name)
+	if err != nil {
+		cm.logger.Error("Failed to obtain certificate for %s: %v", name, err)
+		if _, err := cm.generateSelfSignedCertificate(name); err != nil {
+			cm.logger.Error("Failed to generate self-signed certificate for %s: %v", name, err)
+		}
+	}
+
+	cm.mu.Lock()
+	delete(cm.pending, name)
+	cm.mu.Unlock()
+
+	// The cached OCSP response belongs to the replaced certificate
+	cm.ocsp.Forget(name)
+	cm.notifyUpdate()
+}
+
+// CertificateCovers reports whether the certificate with the given name is
+// valid for hostname
+func (cm *CertificateManager) CertificateCovers(name, hostname string) bool {
+	if !cm.CertificateUsable(name) {
+		return false
+	}
+	cert, err := cm.loadCertificate(name)
+	if err != nil {
+		return false
+	}
+	return cert.VerifyHostname(hostname) == nil
+}
+
+// certificateMatches reports whether the certificate holds exactly the domains
+// of its group, so added and removed names cause the group to be re-issued
+func (cm *CertificateManager) certificateMatches(name string, domains []string) bool {
+	cert, err := cm.loadCertificate(name)
+	if err != nil {
+		return false
+	}
+
+	names := make(map[string]bool, len(cert.DNSNames))
+	for _, dnsName := range cert.DNSNames {
+		names[strings.ToLower(dnsName)] = true
+	}
+	for _, domain := range domains {
+		if !names[domain] {
+			return false
+		}
+		delete(names, domain)
+	}
+	return len(names) == 0
+}
+
+// coveredByCertificates reports whether every domain is served by a valid
+// certificate in the index
+func (cm *CertificateManager) coveredByCertificates(domains []string) bool {
+	for _, domain := range domains {
+		if name, _ := cm.SelectCertificate(domain); name == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// isManaged reports whether a certificate was obtained through ACME, which
+// leaves a marker naming the CA. Older versions left an account key per
+// certificate instead.
+func (cm *CertificateManager) isManaged(name string) bool {
+	managed, _ := managedBy(cm.sslPath, name)
+	return managed
+}
+
+// MarkManaged records that the certificate name in sslPath was obtained from
+// ca, so that it is renewed and replaced when its domains change
+func MarkManaged(sslPath, name, ca string) error {
+	if err := os.MkdirAll(filepath.Join(sslPath, "managed"), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(sslPath, "managed", name), []byte(ca+"\n"), 0644)
+}
+
+// group returns the certificate group named name, with no domains if no
+// container requested it
+func (cm *CertificateManager) group(name string) CertificateGroup {
+	cm.groupsMu.Lock()
+	defer cm.groupsMu.Unlock()
+	return cm.groups[name]
+}
+
+// CertificateDomains returns the domains a certificate name covers, a wildcard
+// certificate also covering its apex
+func CertificateDomains(name string) []string {
+	if strings.HasPrefix(name, "*.") {
+		return []string{name, strings.TrimPrefix(name, "*.")}
+	}
+	return []string{name}
+}
+
+// refreshOCSPResponses refreshes due OCSP responses and notifies the update handler
+func (cm *CertificateManager) refreshOCSPResponses() {
+	if updated := cm.ocsp.RefreshDue(); len(updated) > 0 {
+		cm.logger.Info("Refreshed OCSP responses for: %v", updated)
+		cm.notifyUpdate()
+	}
+}
+
+// notifyUpdate calls the update handler if one is set
+func (cm *CertificateManager) notifyUpdate() {
+	cm.mu.RLock()
+	handler := cm.onUpdate
+	cm.mu.RUnlock()
+
+	if handler != nil {
+		handler()
+	}
+}
+
+// SetUpdateHandler sets a function called after certificates are obtained in
+// the background or cached OCSP responses change, typically to reload nginx
+func (cm *CertificateManager) SetUpdateHandler(handler func()) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.onUpdate = handler
+}
+
+// OCSPStapleFile returns the cached OCSP response to staple for a certificate,
+// or an empty string if none is available yet. Responses for certificates seen
+// for the first time are fetched in the background and the update handler is
+// called on success.
+func (cm *CertificateManager) OCSPStapleFile(name string) string {
+	certPath := filepath.Join(cm.sslPath, "certs", name+".crt")
+	if !cm.ocsp.Track(name, certPath) {
+		return ""
+	}
+
+	if cm.ocsp.claimRefresh(name) {
+		cm.renewalWG.Add(1)
+		go func() {
+			defer cm.renewalWG.Done()
+			if err := cm.ocsp.Refresh(name); err != nil {
+				cm.logger.Warn("Failed to fetch OCSP response for %s: %v", name, err)
+				return
+			}
+			cm.notifyUpdate()
+		}()
+	}
+
+	return cm.ocsp.StapleFile(name)
+}
+
+// OCSPFailures returns the OCSP refresh errors keyed by certificate name
+func (cm *CertificateManager) OCSPFailures() map[string]string {
+	return cm.ocsp.Failures()
+}
+
+// GetCertificate gets or creates a certificate for the given domain
+func (cm *CertificateManager) GetCertificate(domain string) (string, error) {
 	// Check if certificate exists and is valid
 	if cm.certificateExists(domain) {
 		expiry, err := cm.getCertificateExpiry(domain)
 		if err == nil {
 			daysRemaining := int(expiry.Sub(time.Now()).Hours() / 24)
 			if daysRemaining > 2 {
-				cm.certCache[domain] = expiry
+				cm.recordCertificate(domain)
 				return domain, nil
 			}
 		}
@@ -149,24 +575,18 @@ func (cm *CertificateManager) GetCertificate(domain string) (string, error) {
 		}
 	}
 
-	// Check if domain is blacklisted
-	if cm.isBlacklisted(domain) {
-		cm.logger.Info(fmt.Sprintf("Domain %s is blacklisted, using self-signed certificate", domain))
+	// Issuance recently failed, wait before asking the CA again
+	if cm.inBackoff(domain) {
+		cm.logger.Info(fmt.Sprintf("Issuance for %s is backing off, using self-signed certificate", domain))
 		return cm.generateSelfSignedCertificate(domain)
 	}
 
 	// Try to get certificate from ACME
 	if err := cm.obtainCertificate(domain); err != nil {
 		cm.logger.Error(fmt.Sprintf("Failed to obtain certificate for %s: %v", domain, err))
-		cm.addToBlacklist(domain, 3*time.Hour) // Blacklist for 3 hours
 		return cm.generateSelfSignedCertificate(domain)
 	}
 
-	// Update cache
-	if expiry, err := cm.getCertificateExpiry(domain); err == nil {
-		cm.certCache[domain] = expiry
-	}
-
 	return domain, nil
 }
 
@@ -183,24 +603,29 @@ func (cm *CertificateManager) certificateExists(domain string) bool {
 
 // getCertificateExpiry gets the expiry time of a certificate
 func (cm *CertificateManager) getCertificateExpiry(domain string) (time.Time, error) {
-	certPath := filepath.Join(cm.sslPath, "certs", domain+".crt")
+	cert, err := cm.loadCertificate(domain)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return cert.NotAfter, nil
+}
+
+// loadCertificate parses the leaf certificate with the given name
+func (cm *CertificateManager) loadCertificate(name string) (*x509.Certificate, error) {
+	certPath := filepath.Join(cm.sslPath, "certs", name+".crt")
 
 	certData, err := os.ReadFile(certPath)
 	if err != nil {
-		return time.Time{}, err
+		return nil, err
 	}
 
 	block, _ := pem.Decode(certData)
 	if block == nil {
-		return time.Time{}, fmt.Errorf("failed to decode certificate")
+		return nil, fmt.Errorf("failed to decode certificate")
 	}
 
-	cert, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return time.Time{}, err
-	}
-
-	return cert.NotAfter, nil
+	return x509.ParseCertificate(block.Bytes)
 }
 
 // getWildcardDomain returns the wildcard domain name if applicable
@@ -212,37 +637,71 @@ func (cm *CertificateManager) getWildcardDomain(domain string) string {
 	return ""
 }
 
-// isBlacklisted checks if a domain is blacklisted
-func (cm *CertificateManager) isBlacklisted(domain string) bool {
-	if expiry, exists := cm.blacklist[domain]; exists {
-		if time.Now().Before(expiry) {
-			return true
-		}
-		// Remove expired blacklist entry
-		delete(cm.blacklist, domain)
+// obtainCertificate obtains a certificate from ACME, recording the outcome in
+// the certificate state
+func (cm *CertificateManager) obtainCertificate(domain string) error {
+	if err := cm.requestCertificate(domain); err != nil {
+		cm.recordFailure(domain, err)
+		return err
 	}
-	return false
-}
 
-// addToBlacklist adds a domain to the blacklist for the specified duration
-func (cm *CertificateManager) addToBlacklist(domain string, duration time.Duration) {
-	cm.blacklist[domain] = time.Now().Add(duration)
-	cm.logger.Info(fmt.Sprintf("Added %s to blacklist for %v", domain, duration))
+	cm.recordSuccess(domain)
+	if cert, err := cm.loadCertificate(domain); err == nil {
+		cm.scheduleRenewal(domain, cert, time.Now())
+	}
+	return nil
 }
 
-// obtainCertificate obtains a certificate from ACME
-func (cm *CertificateManager) obtainCertificate(domain string) error {
+// requestCertificate requests a certificate from the CA
+func (cm *CertificateManager) requestCertificate(domain string) error {
 	cm.logger.Info(fmt.Sprintf("Obtaining certificate for %s", domain))
 
 	certPath := filepath.Join(cm.sslPath, "certs", domain+".crt")
 	keyPath := filepath.Join(cm.sslPath, "private", domain+".key")
-	accountKeyPath := filepath.Join(cm.sslPath, "accounts", domain+".account.key")
 
-	// Use ACME manager to obtain certificate
-	if err := cm.acmeManager.ObtainCertificate(domain, certPath, keyPath, accountKeyPath); err != nil {
+	keyType, dualKeyType, localCA := cm.issuanceSettings()
+
+	group := cm.group(domain)
+	domains := group.Domains
+	if domains == nil {
+		domains = CertificateDomains(domain)
+	}
+
+	if localCA != nil {
+		return cm.issueLocalCertificate(localCA, domain, domains, keyType, dualKeyType)
+	}
+
+	// Use ACME manager to obtain certificate, with the shared account of the CA
+	req := acme.CertificateRequest{
+		Domains:   domains,
+		CertPath:  certPath,
+		KeyPath:   keyPath,
+		KeyType:   keyType,
+		Challenge: group.Challenge,
+		CA:        group.CA,
+	}
+	ca, err := cm.acmeManager.Obtain(req)
+	if err != nil {
 		return fmt.Errorf("ACME certificate request failed: %v", err)
 	}
 
+	// Record the CA that issued the certificate, which is the fallback CA when
+	// the requested one failed
+	if err := MarkManaged(cm.sslPath, domain, ca.Name); err != nil {
+		cm.logger.Warn("Failed to mark certificate %s as managed: %v", domain, err)
+	}
+
+	// The ECDSA certificate is optional, clients fall back to the RSA certificate.
+	// It is obtained from the CA that issued the RSA certificate.
+	if dualKeyType != "" {
+		dualCertPath := filepath.Join(cm.sslPath, "certs", domain+ECDSASuffix+".crt")
+		dualKeyPath := filepath.Join(cm.sslPath, "private", domain+ECDSASuffix+".key")
+		req.CertPath, req.KeyPath, req.KeyType, req.CA = dualCertPath, dualKeyPath, dualKeyType, ca.Name
+		if _, err := cm.acmeManager.Obtain(req); err != nil {
+			cm.logger.Warn("Failed to obtain ECDSA certificate for %s: %v", domain, err)
+		}
+	}
+
 	cm.logger.Info(fmt.Sprintf("Successfully obtained certificate for %s", domain))
 	return nil
 }
@@ -251,21 +710,15 @@ func (cm *CertificateManager) obtainCertificate(domain string) error {
 func (cm *CertificateManager) renewCertificate(domain string) error {
 	cm.logger.Info(fmt.Sprintf("Renewing certificate for %s", domain))
 
-	// Remove from cache to force renewal
-	cm.mu.Lock()
-	delete(cm.certCache, domain)
-	cm.mu.Unlock()
-
 	// Obtain new certificate
 	if err := cm.obtainCertificate(domain); err != nil {
 		return err
 	}
 
-	// Update cache with new expiry
+	// The cached OCSP response belongs to the old certificate
+	cm.ocsp.Forget(domain)
+
 	if expiry, err := cm.getCertificateExpiry(domain); err == nil {
-		cm.mu.Lock()
-		cm.certCache[domain] = expiry
-		cm.mu.Unlock()
 		cm.logger.Info(fmt.Sprintf("Certificate renewed for %s, expires: %v", domain, expiry))
 	}
 
@@ -274,17 +727,28 @@ func (cm *CertificateManager) renewCertificate(domain string) error {
 
 // generateSelfSignedCertificate generates a self-signed certificate
 func (cm *CertificateManager) generateSelfSignedCertificate(domain string) (string, error) {
+	cm.selfSignedMu.Lock()
+	defer cm.selfSignedMu.Unlock()
 	cm.logger.Info(fmt.Sprintf("Generating self-signed certificate for %s", domain))
 
+	cm.mu.RLock()
+	keyType := cm.keyType
+	cm.mu.RUnlock()
+
 	// Generate private key
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, err := acme.GenerateKey(keyType)
+	if err != nil {
+		return "", err
+	}
+
+	serial, err := randomSerial()
 	if err != nil {
 		return "", err
 	}
 
 	// Create certificate template
 	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			Country:      []string{"US"},
 			Organization: []string{"Nginx-Proxy-Go"},
@@ -296,9 +760,18 @@ func (cm *CertificateManager) generateSelfSignedCertificate(domain string) (stri
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 	}
+	if keyType.IsECDSA() {
+		// Key encipherment only applies to RSA key exchange
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	// Clients ignore the common name, the certificate names its domains
+	template.DNSNames = CertificateDomains(domain)
+	if domains := cm.group(domain).Domains; domains != nil {
+		template.DNSNames = domains
+	}
 
 	// Generate certificate
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, privateKey.Public(), privateKey)
 	if err != nil {
 		return "", err
 	}
@@ -332,32 +805,54 @@ func (cm *CertificateManager) generateSelfSignedCertificate(domain string) (stri
 		return "", err
 	}
 
-	cm.selfSigned[domain] = true
+	err = cm.state.Update(domain, func(state *CertificateState) {
+		state.SelfSigned = true
+	})
+	if err != nil {
+		cm.logger.Warn("Failed to save the state of certificate %s: %v", domain, err)
+	}
 	cm.logger.Info(fmt.Sprintf("Generated self-signed certificate for %s", domain))
 
 	return domain + ".selfsigned", nil
 }
 
-// GetCertificateStatus returns status information about certificates
+// GetCertificateStatus returns status information about certificates: the
+// stored state of each, and the certificates whose issuance is backing off
 func (cm *CertificateManager) GetCertificateStatus() map[string]interface{} {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
-
-	status := make(map[string]interface{})
-	status["certificates"] = make(map[string]interface{})
+	certificates := make(map[string]interface{})
+	backoff := make(map[string]time.Time)
 
 	now := time.Now()
-	for domain, expiry := range cm.certCache {
+	for domain, state := range cm.state.All() {
 		domainStatus := map[string]interface{}{
-			"expiry":         expiry,
-			"days_remaining": int(expiry.Sub(now).Hours() / 24),
-			"self_signed":    cm.selfSigned[domain],
+			"domains":      state.Domains,
+			"issuer":       state.Issuer,
+			"self_signed":  state.SelfSigned,
+			"managed":      cm.isManaged(domain),
+			"last_attempt": state.LastAttempt,
+			"failures":     state.Failures,
+		}
+		if !state.NotAfter.IsZero() {
+			domainStatus["expiry"] = state.NotAfter
+			domainStatus["days_remaining"] = int(state.NotAfter.Sub(now).Hours() / 24)
+		}
+		if state.LastError != "" {
+			domainStatus["last_error"] = state.LastError
 		}
-		status["certificates"].(map[string]interface{})[domain] = domainStatus
+		if now.Before(state.NextRetry) {
+			domainStatus["next_retry"] = state.NextRetry
+			backoff[domain] = state.NextRetry
+		}
+		if state.Renewal != nil {
+			domainStatus["renewal"] = *state.Renewal
+		}
+		certificates[domain] = domainStatus
 	}
 
-	status["blacklisted"] = cm.blacklist
-	return status
+	return map[string]interface{}{
+		"certificates": certificates,
+		"backoff":      backoff,
+	}
 }
 
 // Shutdown gracefully shuts down the certificate manager
@@ -0,0 +1,171 @@
+package ssl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCertificateManager(t *testing.T) *CertificateManager {
+	t.Helper()
+
+	// A CA that is down, so issuance fails without leaving the host
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ca.Close)
+
+	return newTestCertificateManagerWithCA(t, ca.URL, t.TempDir())
+}
+
+// newTestCertificateManagerWithCA returns a certificate manager keeping its
+// files in sslPath and using the ACME directory at directoryURL
+func newTestCertificateManagerWithCA(t *testing.T, directoryURL, sslPath string) *CertificateManager {
+	t.Helper()
+	logCfg := logger.DefaultConfig()
+	logCfg.OutputPath = filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.New(logCfg)
+	require.NoError(t, err)
+
+	cm := NewCertificateManager(sslPath, acme.NewManager(directoryURL, t.TempDir()), log)
+	t.Cleanup(cm.Shutdown)
+	return cm
+}
+
+// writeTestCertificate writes a self-signed certificate for dnsNames under name
+func writeTestCertificate(t *testing.T, cm *CertificateManager, name string, dnsNames ...string) {
+	t.Helper()
+	writeTestCertificateExpiring(t, cm, name, time.Now().Add(90*24*time.Hour), dnsNames...)
+}
+
+// writeTestCertificateExpiring writes a self-signed certificate for dnsNames
+// valid until notAfter and its key under name
+func writeTestCertificateExpiring(t *testing.T, cm *CertificateManager, name string, notAfter time.Time, dnsNames ...string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyPEM, err := acme.EncodePrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(cm.sslPath, "certs", name+".crt"), certPEM, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(cm.sslPath, "private", name+".key"), keyPEM, 0600))
+}
+
+// markManaged leaves the marker of a certificate obtained by the proxy
+func markManaged(t *testing.T, cm *CertificateManager, name string) {
+	t.Helper()
+	require.NoError(t, MarkManaged(cm.sslPath, name, cm.acmeManager.CA().Name))
+}
+
+// writeCertificatePair writes placeholder certificate and key files for name
+func writeCertificatePair(t *testing.T, cm *CertificateManager, name string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(cm.sslPath, "certs", name+".crt"), []byte("cert"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(cm.sslPath, "private", name+".key"), []byte("key"), 0600))
+}
+
+func TestCertificateDomains(t *testing.T) {
+	assert.Equal(t, []string{"*.example.com", "example.com"}, CertificateDomains("*.example.com"))
+	assert.Equal(t, []string{"www.example.com"}, CertificateDomains("www.example.com"))
+}
+
+func TestCertificateCovers(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	writeTestCertificate(t, cm, "example.com", "example.com", "www.example.com")
+
+	assert.True(t, cm.CertificateCovers("example.com", "www.example.com"))
+	assert.False(t, cm.CertificateCovers("example.com", "api.example.com"))
+	assert.False(t, cm.CertificateCovers("missing.example.com", "missing.example.com"))
+
+	assert.True(t, cm.certificateMatches("example.com", []string{"example.com", "www.example.com"}))
+	assert.False(t, cm.certificateMatches("example.com", []string{"example.com"}))
+	assert.False(t, cm.certificateMatches("example.com", []string{"example.com", "www.example.com", "api.example.com"}))
+}
+
+func TestRequestCertificates(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	updates := make(chan struct{}, 10)
+	cm.SetUpdateHandler(func() { updates <- struct{}{} })
+
+	// A managed certificate holding exactly the group is only tracked for renewal
+	writeTestCertificate(t, cm, "example.com", "example.com", "www.example.com")
+	markManaged(t, cm, "example.com")
+
+	// A certificate provided by the user is never replaced
+	writeTestCertificate(t, cm, "custom.example.org", "custom.example.org")
+
+	cm.RequestCertificates([]CertificateGroup{
+		{Domains: []string{"example.com", "www.example.com"}},
+		{Domains: []string{"custom.example.org", "www.custom.example.org"}},
+	})
+	assert.Empty(t, cm.pending)
+	assert.Contains(t, cm.state.All(), "example.com")
+
+	// A missing certificate is requested for the whole group and falls back to
+	// a self-signed certificate covering every name
+	cm.RequestCertificates([]CertificateGroup{{Domains: []string{"app.example.net", "www.app.example.net"}}})
+	select {
+	case <-updates:
+	case <-time.After(10 * time.Second):
+		t.Fatal("certificate request did not complete")
+	}
+	assert.True(t, cm.CertificateCovers("app.example.net.selfsigned", "www.app.example.net"))
+
+	assert.True(t, cm.inBackoff("app.example.net"))
+
+	// Adding a name to a managed certificate's group requests it again
+	cm.RequestCertificates([]CertificateGroup{{Domains: []string{"example.com", "www.example.com", "api.example.com"}}})
+	select {
+	case <-updates:
+	case <-time.After(10 * time.Second):
+		t.Fatal("certificate request did not complete")
+	}
+	assert.True(t, cm.CertificateCovers("example.com.selfsigned", "api.example.com"))
+}
+
+func TestSettingsChangeDuringIssuance(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	updates := make(chan struct{}, 10)
+	cm.SetUpdateHandler(func() { updates <- struct{}{} })
+
+	// Settings are read once per issuance, they can change while it runs
+	cm.RequestCertificates([]CertificateGroup{{Domains: []string{"app.example.net"}}})
+	cm.SetKeyType(acme.KeyTypeEC256, true)
+	cm.SetNotifier(nil, 0, 1)
+	require.NoError(t, cm.EnableLocalCA())
+	select {
+	case <-updates:
+	case <-time.After(10 * time.Second):
+		t.Fatal("certificate request did not complete")
+	}
+
+	// Self-signed certificates do not wait for issuance
+	name, err := cm.SelfSignedCertificate("other.example.net")
+	require.NoError(t, err)
+	assert.Equal(t, "other.example.net.selfsigned", name)
+}
@@ -0,0 +1,198 @@
+package ssl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// selfSignedSuffix is appended to the name of a self-signed certificate
+// served while the certificate of a host is missing
+const selfSignedSuffix = ".selfsigned"
+
+// CertificateInfo describes a certificate in an SSL directory
+type CertificateInfo struct {
+	Name       string
+	Domains    []string
+	Issuer     string
+	NotAfter   time.Time
+	Managed    bool   // Obtained through ACME and renewed by the proxy
+	CA         string // CA a managed certificate was obtained from
+	SelfSigned bool
+}
+
+// BaseName returns the name of the certificate a variant stands in for or is
+// served alongside: the RSA certificate of an ECDSA certificate and the
+// missing certificate of a self-signed one
+func BaseName(name string) string {
+	name = strings.TrimSuffix(name, selfSignedSuffix)
+	return strings.TrimSuffix(name, ECDSASuffix)
+}
+
+// ListCertificates returns the certificates in sslPath, laid out as by
+// CertificateManager, sorted by name. Files that do not hold a certificate are
+// skipped.
+func ListCertificates(sslPath string) ([]CertificateInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(sslPath, "certs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []CertificateInfo
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".crt")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		// A certificate without its issuer in the chain is listed all the same
+		leaf, _, _ := loadCertificateChain(filepath.Join(sslPath, "certs", entry.Name()))
+		if leaf == nil {
+			continue
+		}
+
+		info := CertificateInfo{
+			Name:       name,
+			Domains:    certificateNames(leaf),
+			Issuer:     leaf.Issuer.CommonName,
+			NotAfter:   leaf.NotAfter,
+			SelfSigned: strings.HasSuffix(name, selfSignedSuffix),
+		}
+		if !info.SelfSigned {
+			info.Managed, info.CA = managedBy(sslPath, BaseName(name))
+		}
+		certs = append(certs, info)
+	}
+	sort.Slice(certs, func(i, j int) bool { return certs[i].Name < certs[j].Name })
+	return certs, nil
+}
+
+// certificateNames returns the DNS names of cert, its common name when it has
+// none
+func certificateNames(cert *x509.Certificate) []string {
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames
+	}
+	if cert.Subject.CommonName != "" {
+		return []string{cert.Subject.CommonName}
+	}
+	return nil
+}
+
+// managedBy reports whether the certificate name in sslPath was obtained
+// through ACME and from which CA, empty for certificates of older versions
+func managedBy(sslPath, name string) (bool, string) {
+	data, err := os.ReadFile(filepath.Join(sslPath, "managed", name))
+	if err == nil {
+		return true, strings.TrimSpace(string(data))
+	}
+	_, err = os.Stat(filepath.Join(sslPath, "accounts", name+".account.key"))
+	return err == nil, ""
+}
+
+// ReadCertificateUsers returns the server names using each certificate in the
+// generated nginx configuration and in the stream configuration, which is only
+// written once streams are configured and may be missing
+func ReadCertificateUsers(confPath, streamConfPath string) (map[string][]string, error) {
+	conf, err := os.ReadFile(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nginx configuration: %v", err)
+	}
+	users := CertificateUsers(conf)
+
+	if streamConfPath == "" {
+		return users, nil
+	}
+	streamConf, err := os.ReadFile(streamConfPath)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nginx stream configuration: %v", err)
+	}
+	for name, serverNames := range CertificateUsers(streamConf) {
+		if _, ok := users[name]; !ok {
+			users[name] = nil
+		}
+		for _, serverName := range serverNames {
+			if !slices.Contains(users[name], serverName) {
+				users[name] = append(users[name], serverName)
+			}
+		}
+	}
+	return users, nil
+}
+
+// CertificateUsers returns the server names using each certificate in a
+// generated nginx configuration, by certificate name. Stream servers have no
+// names and are given by their listen addresses instead.
+func CertificateUsers(conf []byte) map[string][]string {
+	users := make(map[string][]string)
+	var serverNames, listens []string
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ";"))
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "server":
+			serverNames, listens = nil, nil
+		case "server_name":
+			serverNames = fields[1:]
+		case "listen":
+			if len(fields) > 1 {
+				listens = append(listens, fields[1])
+			}
+		case "ssl_certificate":
+			if len(fields) < 2 {
+				continue
+			}
+			name := strings.TrimSuffix(filepath.Base(fields[1]), ".crt")
+			names := serverNames
+			if names == nil {
+				names = listens
+			}
+			for _, serverName := range names {
+				if serverName == "_" || slices.Contains(users[name], serverName) {
+					continue
+				}
+				users[name] = append(users[name], serverName)
+			}
+			if _, ok := users[name]; !ok {
+				users[name] = nil
+			}
+		}
+	}
+	return users
+}
+
+// RemoveCertificate deletes the certificate name from sslPath with its key,
+// cached OCSP response and managed marker
+func RemoveCertificate(sslPath, name string) error {
+	paths := []string{
+		filepath.Join(sslPath, "certs", name+".crt"),
+		filepath.Join(sslPath, "private", name+".key"),
+		filepath.Join(sslPath, "ocsp", name+".ocsp"),
+	}
+	if BaseName(name) == name {
+		paths = append(paths,
+			filepath.Join(sslPath, "managed", name),
+			filepath.Join(sslPath, "accounts", name+".account.key"))
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package ssl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseName(t *testing.T) {
+	assert.Equal(t, "example.com", BaseName("example.com"))
+	assert.Equal(t, "example.com", BaseName("example.com.ecdsa"))
+	assert.Equal(t, "example.com", BaseName("example.com.selfsigned"))
+	assert.Equal(t, "*.example.com", BaseName("*.example.com.ecdsa"))
+}
+
+func TestListCertificates(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	writeTestCertificate(t, cm, "example.com", "example.com", "www.example.com")
+	markManaged(t, cm, "example.com")
+	writeTestCertificate(t, cm, "example.com.ecdsa", "example.com", "www.example.com")
+	writeTestCertificate(t, cm, "custom.org", "custom.org")
+	writeTestCertificate(t, cm, "new.org.selfsigned", "new.org")
+	writeCertificatePair(t, cm, "broken.net")
+
+	certs, err := ListCertificates(cm.sslPath)
+	require.NoError(t, err)
+	require.Len(t, certs, 4)
+
+	assert.Equal(t, "custom.org", certs[0].Name)
+	assert.False(t, certs[0].Managed)
+
+	assert.Equal(t, "example.com", certs[1].Name)
+	assert.Equal(t, []string{"example.com", "www.example.com"}, certs[1].Domains)
+	assert.Equal(t, "example.com", certs[1].Issuer)
+	assert.True(t, certs[1].Managed)
+	assert.Equal(t, cm.acmeManager.CA().Name, certs[1].CA)
+
+	// The ECDSA certificate is managed with the RSA certificate
+	assert.Equal(t, "example.com.ecdsa", certs[2].Name)
+	assert.True(t, certs[2].Managed)
+
+	assert.Equal(t, "new.org.selfsigned", certs[3].Name)
+	assert.True(t, certs[3].SelfSigned)
+	assert.False(t, certs[3].Managed)
+
+	certs, err = ListCertificates(t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, certs)
+}
+
+func TestCertificateUsers(t *testing.T) {
+	conf := `
+upstream example.com-80 {
+    server 172.17.0.2:80 max_fails=3 fail_timeout=30s;
+}
+
+server {
+    server_name example.com;
+    listen 443 ssl ;
+    ssl_certificate /etc/ssl/custom/certs/example.com.crt;
+    ssl_certificate_key /etc/ssl/custom/private/example.com.key;
+    ssl_certificate /etc/ssl/custom/certs/example.com.ecdsa.crt;
+    ssl_certificate_key /etc/ssl/custom/private/example.com.ecdsa.key;
+}
+
+server {
+    server_name www.example.com;
+    listen 443 ssl ;
+    ssl_certificate /etc/ssl/custom/certs/example.com.crt;
+    ssl_certificate_key /etc/ssl/custom/private/example.com.key;
+}
+
+server {
+    server_name api.example.org;
+    listen 80 ;
+}
+
+server {
+    listen 443 ssl default_server;
+    server_name _;
+    ssl_certificate /etc/ssl/custom/certs/default.crt;
+    ssl_certificate_key /etc/ssl/custom/private/default.key;
+}
+`
+	users := CertificateUsers([]byte(conf))
+	assert.Equal(t, map[string][]string{
+		"example.com":       {"example.com", "www.example.com"},
+		"example.com.ecdsa": {"example.com"},
+		"default":           nil,
+	}, users)
+}
+
+func TestReadCertificateUsers(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "default.conf")
+	streamConfPath := filepath.Join(dir, "stream.conf")
+	require.NoError(t, os.WriteFile(confPath, []byte(`
+server {
+    server_name example.com;
+    listen 443 ssl ;
+    ssl_certificate /etc/ssl/custom/certs/example.com.crt;
+    ssl_certificate_key /etc/ssl/custom/private/example.com.key;
+}
+`), 0644))
+
+	// The stream configuration is only written once streams are configured
+	users, err := ReadCertificateUsers(confPath, streamConfPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"example.com": {"example.com"}}, users)
+
+	require.NoError(t, os.WriteFile(streamConfPath, []byte(`
+server {
+    listen 5432 ssl;
+    proxy_pass db-5432;
+    ssl_certificate /etc/ssl/custom/certs/db.example.com.crt;
+    ssl_certificate_key /etc/ssl/custom/private/db.example.com.key;
+}
+
+server {
+    listen 8443 ssl;
+    proxy_pass example.com-8443;
+    ssl_certificate /etc/ssl/custom/certs/example.com.crt;
+    ssl_certificate_key /etc/ssl/custom/private/example.com.key;
+}
+`), 0644))
+	users, err = ReadCertificateUsers(confPath, streamConfPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"example.com":    {"example.com", "8443"},
+		"db.example.com": {"5432"},
+	}, users)
+
+	_, err = ReadCertificateUsers(filepath.Join(dir, "missing.conf"), streamConfPath)
+	assert.Error(t, err)
+}
+
+func TestRemoveCertificate(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	writeCertificatePair(t, cm, "example.com")
+	writeCertificatePair(t, cm, "example.com.ecdsa")
+	markManaged(t, cm, "example.com")
+	require.NoError(t, os.MkdirAll(filepath.Join(cm.sslPath, "ocsp"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cm.sslPath, "ocsp", "example.com.ocsp"), []byte("ocsp"), 0644))
+
+	// Removing the ECDSA certificate keeps the marker of the RSA certificate
+	require.NoError(t, RemoveCertificate(cm.sslPath, "example.com.ecdsa"))
+	assert.NoFileExists(t, filepath.Join(cm.sslPath, "certs", "example.com.ecdsa.crt"))
+	assert.NoFileExists(t, filepath.Join(cm.sslPath, "private", "example.com.ecdsa.key"))
+	assert.FileExists(t, filepath.Join(cm.sslPath, "managed", "example.com"))
+
+	require.NoError(t, RemoveCertificate(cm.sslPath, "example.com"))
+	for _, path := range []string{"certs/example.com.crt", "private/example.com.key", "ocsp/example.com.ocsp", "managed/example.com"} {
+		assert.NoFileExists(t, filepath.Join(cm.sslPath, path))
+	}
+
+	// Removing a missing certificate is not an error
+	require.NoError(t, RemoveCertificate(cm.sslPath, "example.com"))
+}
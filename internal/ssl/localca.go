@@ -0,0 +1,267 @@
+package ssl
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+)
+
+// LocalCAName is the CA recorded in the managed marker of certificates issued
+// by the local CA
+const LocalCAName = "local-ca"
+
+// LocalCA is a certificate authority kept in the SSL directory that issues
+// certificates for development hosts. Browsers trust them once its root
+// certificate is installed.
+type LocalCA struct {
+	dir  string
+	cert *x509.Certificate
+	key  crypto.Signer
+	mu   sync.Mutex
+}
+
+// LoadLocalCA loads the local CA kept in dir, creating its root certificate
+// and key the first time and again once the root has expired
+func LoadLocalCA(dir string) (*LocalCA, error) {
+	ca := &LocalCA{dir: dir}
+	if err := ca.load(); err == nil && time.Now().Before(ca.cert.NotAfter) {
+		return ca, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load local CA: %v", err)
+	}
+
+	if err := ca.create(); err != nil {
+		return nil, fmt.Errorf("failed to create local CA: %v", err)
+	}
+	return ca, nil
+}
+
+// RootPath returns the path of the root certificate to install in browsers
+func (ca *LocalCA) RootPath() string {
+	return filepath.Join(ca.dir, "root.crt")
+}
+
+// keyPath returns the path of the root key
+func (ca *LocalCA) keyPath() string {
+	return filepath.Join(ca.dir, "root.key")
+}
+
+// RootPEM returns the PEM encoded root certificate
+func (ca *LocalCA) RootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// load reads the root certificate and key
+func (ca *LocalCA) load() error {
+	certData, err := os.ReadFile(ca.RootPath())
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(certData)
+	if block == nil {
+		return fmt.Errorf("no certificate found in %s", ca.RootPath())
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	keyData, err := os.ReadFile(ca.keyPath())
+	if err != nil {
+		return err
+	}
+	key, err := acme.ParsePrivateKey(keyData)
+	if err != nil {
+		return err
+	}
+
+	ca.cert, ca.key = cert, key
+	return nil
+}
+
+// create generates a new root certificate and key. Every installation gets
+// its own root, named after a random ID.
+func (ca *LocalCA) create() error {
+	if err := os.MkdirAll(ca.dir, 0755); err != nil {
+		return err
+	}
+	key, err := acme.GenerateKey(acme.KeyTypeEC256)
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"Nginx-Proxy-Go development CA"},
+			CommonName:   "Nginx-Proxy-Go Local CA " + hex.EncodeToString(id),
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(constants.LocalCARootLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	keyPEM, err := acme.EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(ca.keyPath(), keyPEM, 0600); err != nil {
+		return err
+	}
+	ca.cert, ca.key = cert, key
+	return writeFileAtomic(ca.RootPath(), ca.RootPEM(), 0644)
+}
+
+// Issue issues a certificate for domains with a new key of type kt, writing
+// the certificate followed by the root to certPath and the key to keyPath. IP
+// addresses among domains become IP address names.
+func (ca *LocalCA) Issue(domains []string, kt acme.KeyType, certPath, keyPath string) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	key, err := acme.GenerateKey(kt)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %v", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domains[0]},
+		NotBefore:    now.Add(-time.Hour), // Tolerate clocks running behind
+		NotAfter:     now.Add(constants.LocalCALeafLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if kt.IsECDSA() {
+		// Key encipherment only applies to RSA key exchange
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	if template.NotAfter.After(ca.cert.NotAfter) {
+		template.NotAfter = ca.cert.NotAfter
+	}
+	for _, domain := range domains {
+		if ip := net.ParseIP(domain); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, domain)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return fmt.Errorf("failed to issue certificate: %v", err)
+	}
+
+	keyPEM, err := acme.EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	chain = append(chain, ca.RootPEM()...)
+
+	if err := writeFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write key: %v", err)
+	}
+	if err := writeFileAtomic(certPath, chain, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %v", err)
+	}
+	return nil
+}
+
+// randomSerial returns a random 128 bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	return serial, nil
+}
+
+// EnableLocalCA issues all certificates from the local CA kept in the local-ca
+// directory of the SSL directory instead of an ACME CA
+func (cm *CertificateManager) EnableLocalCA() error {
+	ca, err := LoadLocalCA(filepath.Join(cm.sslPath, "local-ca"))
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	cm.localCA = ca
+	cm.mu.Unlock()
+	cm.logger.Info("Issuing certificates from the local CA %s, install %s to trust them", ca.cert.Subject.CommonName, ca.RootPath())
+	return nil
+}
+
+// LocalCA returns the local CA, nil unless it is enabled
+func (cm *CertificateManager) LocalCA() *LocalCA {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.localCA
+}
+
+// issueLocalCertificate issues the certificate name for domains from the
+// local CA, and its ECDSA certificate with dual certificates
+func (cm *CertificateManager) issueLocalCertificate(ca *LocalCA, name string, domains []string, keyType, dualKeyType acme.KeyType) error {
+	certPath := filepath.Join(cm.sslPath, "certs", name+".crt")
+	keyPath := filepath.Join(cm.sslPath, "private", name+".key")
+	if err := ca.Issue(domains, keyType, certPath, keyPath); err != nil {
+		return fmt.Errorf("local CA: %v", err)
+	}
+	if dualKeyType != "" {
+		dualCertPath := filepath.Join(cm.sslPath, "certs", name+ECDSASuffix+".crt")
+		dualKeyPath := filepath.Join(cm.sslPath, "private", name+ECDSASuffix+".key")
+		if err := ca.Issue(domains, dualKeyType, dualCertPath, dualKeyPath); err != nil {
+			cm.logger.Warn("Failed to issue ECDSA certificate for %s: %v", name, err)
+		}
+	}
+
+	if err := MarkManaged(cm.sslPath, name, LocalCAName); err != nil {
+		cm.logger.Warn("Failed to mark certificate %s as managed: %v", name, err)
+	}
+	cm.logger.Info("Issued certificate for %s from the local CA", name)
+	return nil
+}
+
+// issuedByCurrentCA reports whether the managed certificate name was issued
+// the way certificates are issued now, by the local CA or through ACME
+func (cm *CertificateManager) issuedByCurrentCA(name string) bool {
+	return (cm.managedCA(name) == LocalCAName) == (cm.LocalCA() != nil)
+}
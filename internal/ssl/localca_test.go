@@ -0,0 +1,144 @@
+package ssl
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readChain parses the certificates in path
+func readChain(t *testing.T, path string) []*x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		certs = append(certs, cert)
+	}
+}
+
+func TestLoadLocalCAKeepsRoot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "local-ca")
+	ca, err := LoadLocalCA(dir)
+	require.NoError(t, err)
+	assert.True(t, ca.cert.IsCA)
+	assert.FileExists(t, ca.RootPath())
+
+	info, err := os.Stat(filepath.Join(dir, "root.key"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	again, err := LoadLocalCA(dir)
+	require.NoError(t, err)
+	assert.Equal(t, ca.cert.Raw, again.cert.Raw)
+	assert.Equal(t, ca.RootPEM(), again.RootPEM())
+}
+
+func TestLocalCAIssue(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadLocalCA(filepath.Join(dir, "local-ca"))
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	certPath, keyPath := filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key")
+	require.NoError(t, ca.Issue([]string{"app.localhost", "*.app.test", "127.0.0.1"}, acme.KeyTypeEC256, certPath, keyPath))
+
+	chain := readChain(t, certPath)
+	require.Len(t, chain, 2)
+	leaf := chain[0]
+	assert.Equal(t, []string{"app.localhost", "*.app.test"}, leaf.DNSNames)
+	assert.True(t, leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	assert.LessOrEqual(t, leaf.NotAfter.Sub(leaf.NotBefore), constants.LocalCALeafLifetime+time.Hour)
+	for _, name := range []string{"app.localhost", "api.app.test", "127.0.0.1"} {
+		_, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		assert.NoError(t, err, name)
+	}
+
+	data, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+	key, err := acme.ParsePrivateKey(data)
+	require.NoError(t, err)
+	assert.Equal(t, leaf.PublicKey, key.Public())
+
+	// Every certificate gets its own serial
+	require.NoError(t, ca.Issue([]string{"app.localhost"}, acme.KeyTypeRSA2048, certPath, keyPath))
+	assert.NotEqual(t, leaf.SerialNumber, readChain(t, certPath)[0].SerialNumber)
+}
+
+func TestRequestCertificatesFromLocalCA(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	require.NoError(t, cm.EnableLocalCA())
+	updates := make(chan struct{}, 10)
+	cm.SetUpdateHandler(func() { updates <- struct{}{} })
+
+	// A certificate obtained through ACME is replaced as well
+	writeTestCertificate(t, cm, "example.test", "example.test")
+	markManaged(t, cm, "example.test")
+
+	cm.RequestCertificates([]CertificateGroup{
+		{Domains: []string{"app.localhost", "www.app.localhost"}},
+		{Domains: []string{"example.test"}},
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-updates:
+		case <-time.After(10 * time.Second):
+			t.Fatal("certificate request did not complete")
+		}
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cm.LocalCA().cert)
+	for _, name := range []string{"app.localhost", "example.test"} {
+		cert, err := cm.loadCertificate(name)
+		require.NoError(t, err)
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		assert.NoError(t, err, name)
+		assert.Equal(t, LocalCAName, cm.managedCA(name))
+		assert.False(t, cm.inBackoff(name))
+	}
+
+	// Renewal is scheduled from the lifetime without asking the ACME CA, which
+	// is down and would be asked again within the hour
+	state, ok := cm.state.Get("app.localhost")
+	require.True(t, ok)
+	require.NotNil(t, state.Renewal)
+	assert.Equal(t, RenewalSourceLifetime, state.Renewal.Source)
+	assert.WithinDuration(t, time.Now().Add(ariMaxRetry), state.Renewal.NextCheck, time.Minute)
+
+	// Certificates matching their group are kept
+	cm.RequestCertificates([]CertificateGroup{{Domains: []string{"app.localhost", "www.app.localhost"}}})
+	assert.Empty(t, cm.pending)
+}
+
+func TestSelfSignedCertificateNamesDomain(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	name, err := cm.generateSelfSignedCertificate("app.example.com")
+	require.NoError(t, err)
+	first, err := cm.loadCertificate(name)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app.example.com"}, first.DNSNames)
+
+	_, err = cm.generateSelfSignedCertificate("app.example.com")
+	require.NoError(t, err)
+	second, err := cm.loadCertificate(name)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.SerialNumber, second.SerialNumber)
+}
@@ -0,0 +1,88 @@
+package ssl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/notify"
+)
+
+// SetNotifier reports certificates through n once they expire within
+// expiryWarning, and once obtaining them failed failureThreshold times in a
+// row. A threshold of zero disables failure reports.
+func (cm *CertificateManager) SetNotifier(n *notify.Notifier, expiryWarning time.Duration, failureThreshold int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.notifier = n
+	cm.expiryWarning = expiryWarning
+	cm.failureAlert = failureThreshold
+}
+
+// notifyExpiry reports the certificate name when it entered the warning
+// window, and forgets the report once it was replaced by one outside of it.
+// Certificates of the local CA are short-lived by design and never reported.
+func (cm *CertificateManager) notifyExpiry(name string, notAfter time.Time, domains []string, now time.Time) {
+	cm.mu.RLock()
+	notifier, expiryWarning := cm.notifier, cm.expiryWarning
+	cm.mu.RUnlock()
+	if notifier == nil || cm.managedCA(name) == LocalCAName {
+		return
+	}
+
+	key := "expiring:" + name
+	remaining := notAfter.Sub(now)
+	if remaining > expiryWarning {
+		notifier.Resolve(key)
+		return
+	}
+
+	message := fmt.Sprintf("Certificate %s expires in %d days, on %s", name, int(remaining.Hours()/24), notAfter.UTC().Format(time.RFC1123))
+	if remaining <= 0 {
+		message = fmt.Sprintf("Certificate %s expired on %s", name, notAfter.UTC().Format(time.RFC1123))
+	}
+	if !cm.isManaged(name) {
+		message += ", it is not renewed by nginx-proxy-go"
+	}
+	notifier.Notify(key, notify.Event{
+		Kind:        notify.EventCertificateExpiring,
+		Certificate: name,
+		Domains:     domains,
+		NotAfter:    &notAfter,
+		Message:     message,
+	})
+}
+
+// notifyFailures reports the certificates whose issuance failed at least the
+// failure threshold times in a row, and forgets the report once they are
+// obtained
+func (cm *CertificateManager) notifyFailures() {
+	cm.mu.RLock()
+	notifier, failureAlert := cm.notifier, cm.failureAlert
+	cm.mu.RUnlock()
+	if notifier == nil || failureAlert <= 0 {
+		return
+	}
+
+	for name, state := range cm.state.All() {
+		key := "failed:" + name
+		if state.Failures < failureAlert {
+			notifier.Resolve(key)
+			continue
+		}
+		notifier.Notify(key, notify.Event{
+			Kind:        notify.EventRenewalFailed,
+			Certificate: name,
+			Domains:     state.Domains,
+			Failures:    state.Failures,
+			Error:       state.LastError,
+			Message:     fmt.Sprintf("Obtaining certificate %s failed %d times in a row: %s", name, state.Failures, state.LastError),
+		})
+	}
+}
+
+// IssuanceError returns the error of the last failed issuance of the
+// certificate name, empty if its last issuance succeeded
+func (cm *CertificateManager) IssuanceError(name string) string {
+	state, _ := cm.state.Get(name)
+	return state.LastError
+}
@@ -0,0 +1,96 @@
+package ssl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNotifier returns a notifier posting to a local webhook receiver and
+// a function returning the events it received
+func newTestNotifier(t *testing.T, cm *CertificateManager) (*notify.Notifier, func() []notify.Event) {
+	t.Helper()
+	var events []notify.Event
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	n := notify.NewNotifier(filepath.Join(cm.sslPath, "notifications.json"), cm.logger)
+	require.NoError(t, n.AddWebhook(server.URL, notify.FormatJSON))
+	return n, func() []notify.Event {
+		n.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]notify.Event(nil), events...)
+	}
+}
+
+func TestNotifyExpiringCertificates(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	n, received := newTestNotifier(t, cm)
+	cm.SetNotifier(n, 14*24*time.Hour, 3)
+
+	writeTestCertificateExpiring(t, cm, "custom.example.org", time.Now().Add(5*24*time.Hour), "custom.example.org")
+	cm.recordCertificate("custom.example.org")
+	writeTestCertificate(t, cm, "example.com", "example.com")
+	cm.recordCertificate("example.com")
+
+	cm.checkAndRenewCertificates()
+	events := received()
+	require.Len(t, events, 1)
+	assert.Equal(t, notify.EventCertificateExpiring, events[0].Kind)
+	assert.Equal(t, "custom.example.org", events[0].Certificate)
+	assert.Contains(t, events[0].Message, "expires in 4 days")
+	assert.Contains(t, events[0].Message, "not renewed by nginx-proxy-go")
+
+	// The renewal thread checks every hour, the warning is sent once
+	cm.checkAndRenewCertificates()
+	assert.Len(t, received(), 1)
+
+	// A replacement outside the window resolves the warning
+	writeTestCertificate(t, cm, "custom.example.org", "custom.example.org")
+	cm.checkAndRenewCertificates()
+	assert.NotContains(t, n.Sent(), "expiring:custom.example.org")
+}
+
+func TestNotifyRenewalFailures(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	n, received := newTestNotifier(t, cm)
+	cm.SetNotifier(n, 14*24*time.Hour, 3)
+
+	for i := 0; i < 2; i++ {
+		cm.recordFailure("app.example.com", assert.AnError)
+	}
+	cm.checkAndRenewCertificates()
+	assert.Empty(t, received())
+
+	cm.recordFailure("app.example.com", assert.AnError)
+	cm.checkAndRenewCertificates()
+	cm.checkAndRenewCertificates()
+	events := received()
+	require.Len(t, events, 1)
+	assert.Equal(t, notify.EventRenewalFailed, events[0].Kind)
+	assert.Equal(t, 3, events[0].Failures)
+	assert.Equal(t, assert.AnError.Error(), events[0].Error)
+	assert.Equal(t, assert.AnError.Error(), cm.IssuanceError("app.example.com"))
+
+	// Once obtained the failure is reported again when it recurs
+	cm.recordSuccess("app.example.com")
+	cm.checkAndRenewCertificates()
+	assert.Empty(t, n.Sent())
+	assert.Empty(t, cm.IssuanceError("app.example.com"))
+}
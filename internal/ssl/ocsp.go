@@ -0,0 +1,331 @@
+package ssl
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// maxOCSPResponseSize limits the size of responses read from a responder
+	maxOCSPResponseSize = 1 << 20
+	// ocspRetryInterval is the delay before retrying a failed refresh
+	ocspRetryInterval = time.Hour
+	// ocspDefaultValidity is used when a responder does not set nextUpdate
+	ocspDefaultValidity = 24 * time.Hour
+)
+
+// ocspEntry tracks the cached OCSP response of one certificate
+type ocspEntry struct {
+	certPath   string
+	certMod    time.Time // Modification time of the certificate when tracked
+	valid      bool      // A good response is cached on disk
+	nextUpdate time.Time // Cached response expires at this time
+	refreshAt  time.Time // Next refresh attempt
+	lastError  error
+}
+
+// OCSPStapler fetches OCSP responses for certificates and caches them on disk,
+// so nginx can staple them with ssl_stapling_file without resolver access
+type OCSPStapler struct {
+	dir     string
+	client  *http.Client
+	logger  Logger
+	entries map[string]*ocspEntry
+	mu      sync.RWMutex
+}
+
+// NewOCSPStapler creates a new OCSP stapler storing responses in dir
+func NewOCSPStapler(dir string, logger Logger) *OCSPStapler {
+	os.MkdirAll(dir, 0755)
+
+	return &OCSPStapler{
+		dir:     dir,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		logger:  logger,
+		entries: make(map[string]*ocspEntry),
+	}
+}
+
+// ResponsePath returns the path of the cached OCSP response for a certificate
+func (s *OCSPStapler) ResponsePath(name string) string {
+	return filepath.Join(s.dir, name+".ocsp")
+}
+
+// Track registers a certificate for OCSP stapling. It returns false when the
+// certificate has no OCSP responder, e.g. self-signed certificates.
+// A valid response already cached on disk is reused, and a certificate
+// replaced on disk is tracked afresh.
+func (s *OCSPStapler) Track(name, certPath string) bool {
+	info, err := os.Stat(certPath)
+	if err != nil {
+		return false
+	}
+
+	s.mu.RLock()
+	entry, exists := s.entries[name]
+	s.mu.RUnlock()
+	if exists && entry.certPath == certPath && entry.certMod.Equal(info.ModTime()) {
+		return true
+	}
+
+	leaf, issuer, err := loadCertificateChain(certPath)
+	if err != nil || len(leaf.OCSPServer) == 0 {
+		s.mu.Lock()
+		delete(s.entries, name)
+		s.mu.Unlock()
+		return false
+	}
+
+	entry = &ocspEntry{certPath: certPath, certMod: info.ModTime()}
+	if data, err := os.ReadFile(s.ResponsePath(name)); err == nil {
+		if resp, err := ocsp.ParseResponseForCert(data, leaf, issuer); err == nil &&
+			resp.Status == ocsp.Good && time.Now().Before(responseExpiry(resp)) {
+			entry.valid = true
+			entry.nextUpdate = responseExpiry(resp)
+			entry.refreshAt = refreshTime(resp)
+		}
+	}
+
+	s.mu.Lock()
+	s.entries[name] = entry
+	s.mu.Unlock()
+	return true
+}
+
+// StapleFile returns the cached response path if it holds a current good response
+func (s *OCSPStapler) StapleFile(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.entries[name]
+	if !ok || !entry.valid || !time.Now().Before(entry.nextUpdate) {
+		return ""
+	}
+	return s.ResponsePath(name)
+}
+
+// claimRefresh reports whether a tracked certificate is due for a refresh and
+// postpones its next attempt, so concurrent callers do not fetch it twice
+func (s *OCSPStapler) claimRefresh(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[name]
+	if !ok || time.Now().Before(entry.refreshAt) {
+		return false
+	}
+	entry.refreshAt = time.Now().Add(ocspRetryInterval)
+	return true
+}
+
+// Refresh fetches a new OCSP response for a tracked certificate and caches it
+func (s *OCSPStapler) Refresh(name string) error {
+	s.mu.RLock()
+	entry, ok := s.entries[name]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("certificate %s is not tracked for OCSP stapling", name)
+	}
+
+	resp, err := s.fetch(name, entry.certPath)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		entry.lastError = err
+		entry.refreshAt = time.Now().Add(ocspRetryInterval)
+		if resp != nil && resp.Status == ocsp.Revoked {
+			// Never staple a response for a revoked certificate
+			entry.valid = false
+			os.Remove(s.ResponsePath(name))
+		}
+		return err
+	}
+
+	entry.valid = true
+	entry.lastError = nil
+	entry.nextUpdate = responseExpiry(resp)
+	entry.refreshAt = refreshTime(resp)
+	s.logger.Info("Refreshed OCSP response for %s, next update %v", name, entry.nextUpdate)
+	return nil
+}
+
+// RefreshDue refreshes every tracked certificate that is due and returns the
+// names whose cached response changed
+func (s *OCSPStapler) RefreshDue() []string {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+
+	var due []string
+	for _, name := range names {
+		if s.claimRefresh(name) {
+			due = append(due, name)
+		}
+	}
+
+	var updated []string
+	for _, name := range due {
+		if err := s.Refresh(name); err != nil {
+			s.logger.Warn("Failed to refresh OCSP response for %s: %v", name, err)
+			continue
+		}
+		updated = append(updated, name)
+	}
+	return updated
+}
+
+// Forget drops the cached response of a certificate, e.g. after it was renewed
+func (s *OCSPStapler) Forget(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, name)
+	os.Remove(s.ResponsePath(name))
+}
+
+// Failures returns the last refresh error of every certificate that failed
+func (s *OCSPStapler) Failures() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	failures := make(map[string]string)
+	for name, entry := range s.entries {
+		if entry.lastError != nil {
+			failures[name] = entry.lastError.Error()
+		}
+	}
+	return failures
+}
+
+// fetch requests an OCSP response from the certificate's responder and writes
+// it to the cache if the certificate is good. The parsed response is returned
+// alongside the error when the certificate is not good.
+func (s *OCSPStapler) fetch(name, certPath string) (*ocsp.Response, error) {
+	leaf, issuer, err := loadCertificateChain(certPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return nil, fmt.Errorf("certificate has no OCSP responder")
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCSP request: %v", err)
+	}
+
+	httpResp, err := s.client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("OCSP request to %s failed: %v", leaf.OCSPServer[0], err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder %s returned status %d", leaf.OCSPServer[0], httpResp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCSP response: %v", err)
+	}
+
+	resp, err := ocsp.ParseResponseForCert(data, leaf, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP response: %v", err)
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		return resp, fmt.Errorf("certificate was revoked at %v", resp.RevokedAt)
+	default:
+		return resp, fmt.Errorf("OCSP responder does not know the certificate")
+	}
+
+	if err := writeFileAtomic(s.ResponsePath(name), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to cache OCSP response: %v", err)
+	}
+	return resp, nil
+}
+
+// loadCertificateChain reads a PEM chain and returns the leaf and its issuer
+func loadCertificateChain(certPath string) (*x509.Certificate, *x509.Certificate, error) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no certificate found in %s", certPath)
+	}
+	if len(certs) < 2 {
+		return certs[0], nil, fmt.Errorf("certificate chain in %s has no issuer", certPath)
+	}
+	return certs[0], certs[1], nil
+}
+
+// responseExpiry returns the time until which a response may be stapled
+func responseExpiry(resp *ocsp.Response) time.Time {
+	if resp.NextUpdate.IsZero() {
+		return resp.ThisUpdate.Add(ocspDefaultValidity)
+	}
+	return resp.NextUpdate
+}
+
+// refreshTime returns the halfway point of the response validity period
+func refreshTime(resp *ocsp.Response) time.Time {
+	return resp.ThisUpdate.Add(responseExpiry(resp).Sub(resp.ThisUpdate) / 2)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place,
+// so nginx never reads a partially written response
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
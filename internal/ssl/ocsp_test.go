@@ -0,0 +1,190 @@
+package ssl
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testResponder is a local stand-in for a CA's OCSP responder
+type testResponder struct {
+	issuer    *x509.Certificate
+	issuerKey crypto.Signer
+	status    atomic.Int32
+	requests  atomic.Int32
+	server    *httptest.Server
+}
+
+func newTestResponder(t *testing.T) *testResponder {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	issuer, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	r := &testResponder{issuer: issuer, issuerKey: key}
+	r.status.Store(int32(ocsp.Good))
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *testResponder) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	body, _ := io.ReadAll(req.Body)
+	ocspReq, err := ocsp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	tmpl := ocsp.Response{
+		Status:       int(r.status.Load()),
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   now.Add(-time.Minute),
+		NextUpdate:   now.Add(4 * 24 * time.Hour),
+	}
+	if tmpl.Status == ocsp.Revoked {
+		tmpl.RevokedAt = now.Add(-time.Hour)
+	}
+	resp, err := ocsp.CreateResponse(r.issuer, r.issuer, tmpl, r.issuerKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(resp)
+}
+
+// writeLeafChain writes a leaf certificate issued by the responder's CA,
+// followed by the CA certificate, and returns the chain path
+func (r *testResponder) writeLeafChain(t *testing.T, dir, name string, ocspServers []string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		OCSPServer:   ocspServers,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, r.issuer, &key.PublicKey, r.issuerKey)
+	require.NoError(t, err)
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: r.issuer.Raw})...)
+	path := filepath.Join(dir, name+".crt")
+	require.NoError(t, os.WriteFile(path, chain, 0644))
+	return path
+}
+
+func newTestStapler(t *testing.T, dir string) *OCSPStapler {
+	t.Helper()
+	logCfg := logger.DefaultConfig()
+	logCfg.OutputPath = filepath.Join(t.TempDir(), "test.log")
+	log, err := logger.New(logCfg)
+	require.NoError(t, err)
+	return NewOCSPStapler(dir, log)
+}
+
+func TestOCSPStaplerRefresh(t *testing.T) {
+	responder := newTestResponder(t)
+	certDir := t.TempDir()
+	cacheDir := t.TempDir()
+	certPath := responder.writeLeafChain(t, certDir, "example.com", []string{responder.server.URL})
+
+	stapler := newTestStapler(t, cacheDir)
+	require.True(t, stapler.Track("example.com", certPath))
+	assert.Empty(t, stapler.StapleFile("example.com"), "no response cached yet")
+
+	updated := stapler.RefreshDue()
+	assert.Equal(t, []string{"example.com"}, updated)
+	assert.Equal(t, stapler.ResponsePath("example.com"), stapler.StapleFile("example.com"))
+	assert.Empty(t, stapler.Failures())
+
+	data, err := os.ReadFile(stapler.ResponsePath("example.com"))
+	require.NoError(t, err)
+	resp, err := ocsp.ParseResponse(data, responder.issuer)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Good, resp.Status)
+
+	// Not due again until half of the validity period has passed
+	assert.Empty(t, stapler.RefreshDue())
+	assert.Equal(t, int32(1), responder.requests.Load())
+
+	// A new stapler reuses the response cached on disk
+	restarted := newTestStapler(t, cacheDir)
+	require.True(t, restarted.Track("example.com", certPath))
+	assert.Equal(t, restarted.ResponsePath("example.com"), restarted.StapleFile("example.com"))
+	assert.Empty(t, restarted.RefreshDue())
+	assert.Equal(t, int32(1), responder.requests.Load())
+}
+
+func TestOCSPStaplerRevoked(t *testing.T) {
+	responder := newTestResponder(t)
+	certPath := responder.writeLeafChain(t, t.TempDir(), "revoked.example.com", []string{responder.server.URL})
+	stapler := newTestStapler(t, t.TempDir())
+	require.True(t, stapler.Track("revoked.example.com", certPath))
+	require.NoError(t, stapler.Refresh("revoked.example.com"))
+
+	responder.status.Store(int32(ocsp.Revoked))
+	assert.Error(t, stapler.Refresh("revoked.example.com"))
+	assert.Empty(t, stapler.StapleFile("revoked.example.com"))
+	assert.NoFileExists(t, stapler.ResponsePath("revoked.example.com"))
+	assert.Contains(t, stapler.Failures()["revoked.example.com"], "revoked")
+}
+
+func TestOCSPStaplerResponderDown(t *testing.T) {
+	responder := newTestResponder(t)
+	certPath := responder.writeLeafChain(t, t.TempDir(), "down.example.com", []string{responder.server.URL})
+	stapler := newTestStapler(t, t.TempDir())
+	require.True(t, stapler.Track("down.example.com", certPath))
+	require.NoError(t, stapler.Refresh("down.example.com"))
+
+	// A failed refresh keeps stapling the previous response until it expires
+	responder.server.Close()
+	assert.Error(t, stapler.Refresh("down.example.com"))
+	assert.NotEmpty(t, stapler.StapleFile("down.example.com"))
+	assert.Contains(t, stapler.Failures(), "down.example.com")
+}
+
+func TestOCSPStaplerSkipsCertificatesWithoutResponder(t *testing.T) {
+	responder := newTestResponder(t)
+	certPath := responder.writeLeafChain(t, t.TempDir(), "no-ocsp.example.com", nil)
+	stapler := newTestStapler(t, t.TempDir())
+
+	assert.False(t, stapler.Track("no-ocsp.example.com", certPath))
+	assert.False(t, stapler.Track("missing.example.com", filepath.Join(t.TempDir(), "missing.crt")))
+	assert.Empty(t, stapler.RefreshDue())
+}
@@ -0,0 +1,151 @@
+package ssl
+
+import (
+	"crypto/x509"
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+)
+
+const (
+	// renewalCheckInterval is how often due renewals are looked for
+	renewalCheckInterval = time.Hour
+	// ariDefaultRetry is when renewal information is fetched again if the CA
+	// did not send Retry-After
+	ariDefaultRetry = 6 * time.Hour
+	// ariMinRetry and ariMaxRetry bound the Retry-After of the CA
+	ariMinRetry = time.Hour
+	ariMaxRetry = 24 * time.Hour
+)
+
+// Sources of a renewal window
+const (
+	RenewalSourceARI      = "ari"      // Suggested by the CA
+	RenewalSourceLifetime = "lifetime" // One third of the lifetime remaining
+)
+
+// RenewalSchedule is when a certificate is renewed, kept in its state
+type RenewalSchedule struct {
+	Serial         string    `json:"serial"`
+	NotAfter       time.Time `json:"not_after"`
+	WindowStart    time.Time `json:"window_start"`
+	WindowEnd      time.Time `json:"window_end"`
+	RenewAt        time.Time `json:"renew_at"` // Picked at random within the window
+	Source         string    `json:"source"`
+	ExplanationURL string    `json:"explanation_url,omitempty"`
+	NextCheck      time.Time `json:"next_check"` // Renewal information is fetched again then
+}
+
+// lifetimeRenewalWindow returns the renewal window of a certificate when the
+// CA suggests none: the last thirtieth of its lifetime before one third of it
+// remains, 3 days for a 90 day certificate
+func lifetimeRenewalWindow(cert *x509.Certificate) (time.Time, time.Time) {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	end := cert.NotAfter.Add(-lifetime / 3)
+	return end.Add(-lifetime / 30), end
+}
+
+// randomTimeIn picks a time within the window, so that certificates issued
+// together are not all renewed at the same moment
+func randomTimeIn(start, end time.Time) time.Time {
+	window := end.Sub(start)
+	if window <= 0 {
+		return start
+	}
+	return start.Add(time.Duration(rand.Int63n(int64(window))))
+}
+
+// scheduleRenewal returns the renewal schedule of a managed certificate,
+// fetching the window suggested by the CA when the certificate is new or the
+// time to check again has come. A renewal time already picked is kept while
+// the window does not change.
+func (cm *CertificateManager) scheduleRenewal(name string, cert *x509.Certificate, now time.Time) RenewalSchedule {
+	serial := cert.SerialNumber.Text(16)
+	var current RenewalSchedule
+	state, _ := cm.state.Get(name)
+	ok := state.Renewal != nil
+	if ok {
+		current = *state.Renewal
+	}
+	if ok && current.Serial == serial && now.Before(current.NextCheck) {
+		return current
+	}
+
+	schedule := RenewalSchedule{
+		Serial:    serial,
+		NotAfter:  cert.NotAfter,
+		Source:    RenewalSourceLifetime,
+		NextCheck: now.Add(ariMaxRetry),
+	}
+	schedule.WindowStart, schedule.WindowEnd = lifetimeRenewalWindow(cert)
+
+	// The local CA suggests no renewal window
+	var info *acme.RenewalInfo
+	err := acme.ErrRenewalInfoUnsupported
+	if ca := cm.managedCA(name); ca != LocalCAName {
+		info, err = cm.acmeManager.RenewalInfo(ca, cert)
+	}
+	switch {
+	case err == nil:
+		schedule.WindowStart, schedule.WindowEnd = info.Start, info.End
+		schedule.Source = RenewalSourceARI
+		schedule.ExplanationURL = info.ExplanationURL
+		retry := info.RetryAfter
+		if retry == 0 {
+			retry = ariDefaultRetry
+		}
+		schedule.NextCheck = now.Add(min(max(retry, ariMinRetry), ariMaxRetry))
+	case !errors.Is(err, acme.ErrRenewalInfoUnsupported):
+		cm.logger.Debug("Failed to get renewal information for %s: %v", name, err)
+		schedule.NextCheck = now.Add(ariMinRetry)
+	}
+
+	if ok && current.Serial == serial && current.WindowStart.Equal(schedule.WindowStart) && current.WindowEnd.Equal(schedule.WindowEnd) {
+		schedule.RenewAt = current.RenewAt
+	} else {
+		schedule.RenewAt = randomTimeIn(schedule.WindowStart, schedule.WindowEnd)
+		cm.logger.Info("Certificate %s will be renewed at %s (%s window)", name, schedule.RenewAt.Format(time.RFC3339), schedule.Source)
+		if schedule.ExplanationURL != "" {
+			cm.logger.Info("The CA explains the renewal window of %s at %s", name, schedule.ExplanationURL)
+		}
+	}
+
+	err = cm.state.Update(name, func(state *CertificateState) {
+		state.Renewal = &schedule
+	})
+	if err != nil {
+		cm.logger.Warn("Failed to save the renewal schedule of %s: %v", name, err)
+	}
+	return schedule
+}
+
+// managedCA returns the CA a managed certificate was obtained from, empty for
+// the default CA
+func (cm *CertificateManager) managedCA(name string) string {
+	_, ca := managedBy(cm.sslPath, name)
+	return ca
+}
+
+// renewalCandidates returns the names of all certificates the renewal thread
+// knows of: those with a state and those requested by containers
+func (cm *CertificateManager) renewalCandidates() []string {
+	names := make(map[string]bool)
+	for name := range cm.state.All() {
+		names[name] = true
+	}
+	cm.groupsMu.Lock()
+	for name := range cm.groups {
+		names[name] = true
+	}
+	cm.groupsMu.Unlock()
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,197 @@
+package ssl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeIssuedCertificate writes a managed certificate for name valid from
+// notBefore for lifetime, carrying an authority key identifier like
+// certificates issued by a CA
+func writeIssuedCertificate(t *testing.T, cm *CertificateManager, name string, notBefore time.Time, lifetime time.Duration) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(0x1234),
+		Subject:        pkix.Name{CommonName: name},
+		DNSNames:       []string{name},
+		NotBefore:      notBefore,
+		NotAfter:       notBefore.Add(lifetime),
+		AuthorityKeyId: []byte{1, 2, 3, 4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyPEM, err := acme.EncodePrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(cm.sslPath, "certs", name+".crt"), certPEM, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(cm.sslPath, "private", name+".key"), keyPEM, 0600))
+	markManaged(t, cm, name)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// newTestARIServer serves a directory with renewal information, the window
+// being read from *window for every request
+func newTestARIServer(t *testing.T, window *atomic.Value, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/directory":
+			fmt.Fprintf(w, `{"renewalInfo": %q}`, server.URL+"/renewal-info")
+		case strings.HasPrefix(r.URL.Path, "/renewal-info/"):
+			requests.Add(1)
+			w.Write([]byte(window.Load().(string)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLifetimeRenewalWindow(t *testing.T) {
+	notBefore := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(90 * 24 * time.Hour)}
+
+	start, end := lifetimeRenewalWindow(cert)
+	assert.Equal(t, notBefore.Add(57*24*time.Hour), start)
+	assert.Equal(t, notBefore.Add(60*24*time.Hour), end)
+
+	for i := 0; i < 100; i++ {
+		at := randomTimeIn(start, end)
+		assert.False(t, at.Before(start) || at.After(end))
+	}
+}
+
+func TestScheduleRenewalWithoutARI(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	now := time.Now()
+	cert := writeIssuedCertificate(t, cm, "example.com", now.Add(-time.Hour), 90*24*time.Hour)
+
+	schedule := cm.scheduleRenewal("example.com", cert, now)
+	start, end := lifetimeRenewalWindow(cert)
+	assert.Equal(t, RenewalSourceLifetime, schedule.Source)
+	assert.Equal(t, start, schedule.WindowStart)
+	assert.Equal(t, end, schedule.WindowEnd)
+	assert.False(t, schedule.RenewAt.Before(start) || schedule.RenewAt.After(end))
+
+	// The CA is down, renewal information is asked for again soon
+	assert.Equal(t, now.Add(ariMinRetry), schedule.NextCheck)
+
+	// The schedule survives a restart
+	store, err := newStateStore(filepath.Join(cm.sslPath, "state.json"))
+	require.NoError(t, err)
+	stored, ok := store.Get("example.com")
+	require.True(t, ok)
+	require.NotNil(t, stored.Renewal)
+	assert.True(t, schedule.RenewAt.Equal(stored.Renewal.RenewAt))
+}
+
+func TestScheduleRenewalFromARI(t *testing.T) {
+	var window atomic.Value
+	var requests atomic.Int32
+	window.Store(`{"suggestedWindow":{"start":"2030-01-10T00:00:00Z","end":"2030-01-12T00:00:00Z"}}`)
+	server := newTestARIServer(t, &window, &requests)
+
+	cm := newTestCertificateManagerWithCA(t, server.URL+"/directory", t.TempDir())
+	now := time.Now()
+	cert := writeIssuedCertificate(t, cm, "example.com", now.Add(-time.Hour), 90*24*time.Hour)
+
+	schedule := cm.scheduleRenewal("example.com", cert, now)
+	windowStart := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	windowEnd := time.Date(2030, 1, 12, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, RenewalSourceARI, schedule.Source)
+	assert.True(t, windowStart.Equal(schedule.WindowStart))
+	assert.True(t, windowEnd.Equal(schedule.WindowEnd))
+	assert.False(t, schedule.RenewAt.Before(windowStart) || schedule.RenewAt.After(windowEnd))
+	assert.Equal(t, now.Add(ariDefaultRetry), schedule.NextCheck)
+	assert.EqualValues(t, 1, requests.Load())
+
+	// The CA is not asked again before the next check
+	assert.Equal(t, schedule, cm.scheduleRenewal("example.com", cert, now.Add(time.Hour)))
+	assert.EqualValues(t, 1, requests.Load())
+
+	// An unchanged window keeps the renewal time
+	again := cm.scheduleRenewal("example.com", cert, now.Add(7*time.Hour))
+	assert.EqualValues(t, 2, requests.Load())
+	assert.True(t, schedule.RenewAt.Equal(again.RenewAt))
+
+	// A window moved by the CA, e.g. ahead of a revocation, is followed
+	window.Store(`{"suggestedWindow":{"start":"2020-01-01T00:00:00Z","end":"2020-01-01T01:00:00Z"},"explanationURL":"https://example.com/incident"}`)
+	moved := cm.scheduleRenewal("example.com", cert, now.Add(14*time.Hour))
+	assert.True(t, moved.RenewAt.Before(now))
+	assert.Equal(t, "https://example.com/incident", moved.ExplanationURL)
+
+	status := cm.GetCertificateStatus()["certificates"].(map[string]interface{})
+	require.Contains(t, status, "example.com")
+	assert.Equal(t, moved, status["example.com"].(map[string]interface{})["renewal"])
+}
+
+func TestCheckAndRenewSkipsUnmanagedCertificates(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	writeTestCertificate(t, cm, "example.com", "example.com")
+	cm.recordCertificate("example.com")
+
+	cm.checkAndRenewCertificates()
+	state, ok := cm.state.Get("example.com")
+	require.True(t, ok)
+	assert.Nil(t, state.Renewal)
+}
+
+func TestCheckAndRenewRetriesFailedCertificates(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	updates := make(chan struct{}, 10)
+	cm.SetUpdateHandler(func() { updates <- struct{}{} })
+	waitForUpdate := func() {
+		t.Helper()
+		select {
+		case <-updates:
+		case <-time.After(10 * time.Second):
+			t.Fatal("certificate request did not complete")
+		}
+	}
+
+	cm.RequestCertificates([]CertificateGroup{{Domains: []string{"app.example.net", "www.app.example.net"}}})
+	waitForUpdate()
+	state, _ := cm.state.Get("app.example.net")
+	require.Equal(t, 1, state.Failures)
+
+	// Nothing is attempted while backing off
+	cm.checkAndRenewCertificates()
+	assert.Empty(t, cm.pending)
+
+	// The group is requested again once the backoff is over, without any
+	// container event
+	require.NoError(t, cm.state.Update("app.example.net", func(s *CertificateState) {
+		s.NextRetry = time.Now().Add(-time.Minute)
+	}))
+	cm.checkAndRenewCertificates()
+	waitForUpdate()
+	state, _ = cm.state.Get("app.example.net")
+	assert.Equal(t, 2, state.Failures)
+	assert.Equal(t, []string{"app.example.net", "www.app.example.net"}, cm.group("app.example.net").Domains)
+}
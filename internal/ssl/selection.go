@@ -0,0 +1,110 @@
+package ssl
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexCertificates brings the index of certificates on disk up to date, so
+// that certificates changed since they were last seen are considered
+func (cm *CertificateManager) IndexCertificates() {
+	cm.scanCertificates()
+}
+
+// selectable reports whether the certificate name may serve any host it
+// covers. Self-signed certificates are only a fallback, ECDSA certificates are
+// served alongside their RSA certificate and the default certificate belongs
+// to the catch-all server.
+func selectable(name string) bool {
+	return BaseName(name) == name && name != "default" && !strings.HasPrefix(name, "_")
+}
+
+// rejection returns why the certificate cannot be served at now, empty if it
+// can
+func (c *indexedCertificate) rejection(now time.Time) string {
+	switch {
+	case c.err != "":
+		return c.err
+	case now.Before(c.notBefore):
+		return "not valid before " + c.notBefore.UTC().Format(time.RFC3339)
+	case !now.Before(c.notAfter):
+		return "expired on " + c.notAfter.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+// SelectCertificate returns the certificate in the index that serves hostname
+// best. Certificates naming hostname itself are preferred over wildcard
+// certificates, and among those the one valid the longest. Candidates that are
+// expired, not yet valid or whose key does not match are skipped and logged
+// once. An error lists the rejected candidates when none is left.
+func (cm *CertificateManager) SelectCertificate(hostname string) (string, error) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	wildcard := ""
+	if i := strings.IndexByte(hostname, '.'); i > 0 {
+		wildcard = "*" + hostname[i:]
+	}
+
+	cm.watchMu.Lock()
+	defer cm.watchMu.Unlock()
+
+	names := make([]string, 0, len(cm.index))
+	for name := range cm.index {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	var best *indexedCertificate
+	selected, selectedExact := "", false
+	var rejected []string
+	for _, name := range names {
+		entry := cm.index[name]
+		if !selectable(name) {
+			continue
+		}
+		exact := slices.Contains(entry.names, hostname)
+		if !exact && (wildcard == "" || !slices.Contains(entry.names, wildcard)) {
+			continue
+		}
+
+		if reason := entry.rejection(now); reason != "" {
+			if entry.reported != reason {
+				entry.reported = reason
+				cm.logger.Warn("Not using certificate %s: %s", name, reason)
+			}
+			rejected = append(rejected, fmt.Sprintf("%s: %s", name, reason))
+			continue
+		}
+
+		if best == nil || (exact && !selectedExact) ||
+			(exact == selectedExact && entry.notAfter.After(best.notAfter)) {
+			best, selected, selectedExact = entry, name, exact
+		}
+	}
+
+	if selected == "" && len(rejected) > 0 {
+		return "", fmt.Errorf("no valid certificate covers %s (%s)", hostname, strings.Join(rejected, "; "))
+	}
+	return selected, nil
+}
+
+// SelfSignedCertificate returns the self-signed certificate of hostname,
+// generating it when it is missing or cannot be served
+func (cm *CertificateManager) SelfSignedCertificate(hostname string) (string, error) {
+	name := hostname + selfSignedSuffix
+	if cm.CertificateUsable(name) {
+		cm.watchMu.Lock()
+		entry, ok := cm.index[name]
+		valid := ok && entry.rejection(time.Now()) == ""
+		cm.watchMu.Unlock()
+		if valid {
+			return name, nil
+		}
+	}
+
+	return cm.generateSelfSignedCertificate(hostname)
+}
@@ -0,0 +1,113 @@
+package ssl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selectCertificate indexes the certificates on disk and selects one for hostname
+func selectCertificate(t *testing.T, cm *CertificateManager, hostname string) string {
+	t.Helper()
+	cm.IndexCertificates()
+	name, err := cm.SelectCertificate(hostname)
+	require.NoError(t, err)
+	return name
+}
+
+func TestSelectCertificate(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	assert.Equal(t, "", selectCertificate(t, cm, "api.example.com"))
+
+	// Certificates are found by their names, not their file names
+	writeTestCertificate(t, cm, "*.example.com", "*.example.com", "example.com")
+	assert.Equal(t, "*.example.com", selectCertificate(t, cm, "api.example.com"))
+	assert.Equal(t, "*.example.com", selectCertificate(t, cm, "API.example.com"))
+	assert.Equal(t, "*.example.com", selectCertificate(t, cm, "example.com"))
+	writeTestCertificate(t, cm, "shop", "shop.example.org", "www.shop.example.org")
+	assert.Equal(t, "shop", selectCertificate(t, cm, "www.shop.example.org"))
+
+	// A wildcard only covers a single label
+	assert.Equal(t, "", selectCertificate(t, cm, "v1.api.example.com"))
+
+	// A certificate naming the host wins over a wildcard certificate valid longer
+	writeTestCertificateExpiring(t, cm, "api.example.com", time.Now().Add(24*time.Hour), "api.example.com")
+	assert.Equal(t, "api.example.com", selectCertificate(t, cm, "api.example.com"))
+
+	// Among certificates naming the host the one valid the longest wins
+	writeTestCertificateExpiring(t, cm, "apis", time.Now().Add(48*time.Hour), "api.example.com", "api.example.net")
+	assert.Equal(t, "apis", selectCertificate(t, cm, "api.example.com"))
+
+	// Self-signed, ECDSA and default certificates are never selected
+	writeTestCertificate(t, cm, "app.example.net.selfsigned", "app.example.net")
+	writeTestCertificate(t, cm, "app.example.net.ecdsa", "app.example.net")
+	writeTestCertificate(t, cm, "default", "app.example.net")
+	assert.Equal(t, "", selectCertificate(t, cm, "app.example.net"))
+}
+
+func TestSelectCertificateRejections(t *testing.T) {
+	cm := newTestCertificateManager(t)
+
+	writeTestCertificateExpiring(t, cm, "example.com", time.Now().Add(-time.Minute), "example.com", "www.example.com")
+	cm.IndexCertificates()
+	name, err := cm.SelectCertificate("www.example.com")
+	assert.Equal(t, "", name)
+	assert.ErrorContains(t, err, "example.com: expired on")
+
+	// An invalid certificate naming the host falls back to a wildcard certificate
+	writeTestCertificate(t, cm, "*.example.com", "*.example.com")
+	assert.Equal(t, "*.example.com", selectCertificate(t, cm, "www.example.com"))
+
+	writeTestCertificate(t, cm, "api.example.com", "api.example.com")
+	replaceKey(t, cm, "api.example.com")
+	assert.Equal(t, "*.example.com", selectCertificate(t, cm, "api.example.com"))
+
+	replaceKey(t, cm, "*.example.com")
+	cm.IndexCertificates()
+	_, err = cm.SelectCertificate("api.example.com")
+	assert.ErrorContains(t, err, "key does not match")
+
+	// A self-signed certificate is served instead
+	name, err = cm.SelfSignedCertificate("api.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.com.selfsigned", name)
+	assert.True(t, cm.CertificateCovers(name, "api.example.com"))
+
+	again, err := cm.SelfSignedCertificate("api.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, name, again)
+}
+
+func TestRequestCertificatesCoveredByIndex(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	writeTestCertificate(t, cm, "*.example.com", "*.example.com", "example.com")
+	writeTestCertificateExpiring(t, cm, "old.example.org", time.Now().Add(-time.Minute), "old.example.org")
+	cm.IndexCertificates()
+
+	// Groups served by other certificates are not requested
+	cm.RequestCertificates([]CertificateGroup{{Domains: []string{"app.example.com", "example.com"}}})
+	assert.Empty(t, cm.pending)
+	assert.False(t, cm.inBackoff("app.example.com"))
+
+	// Expired certificates do not cover their names
+	assert.False(t, cm.coveredByCertificates([]string{"old.example.org"}))
+	assert.False(t, cm.coveredByCertificates([]string{"app.example.com", "app.example.net"}))
+}
+
+func TestRequestCertificatesWaitForWildcard(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	cm.SetWildcardDomains([]string{"example.com"})
+	cm.ClaimWildcardCertificates()
+
+	// Names the wildcard certificate being obtained covers are left to it
+	cm.RequestCertificates([]CertificateGroup{{Domains: []string{"app.example.com", "example.com"}}})
+	assert.Equal(t, map[string]bool{"*.example.com": true}, cm.pending)
+	assert.False(t, cm.coveredByPendingWildcards([]string{"app.example.com", "app.example.net"}))
+
+	// They need their own certificates when it cannot be obtained
+	assert.True(t, cm.EnsureWildcardCertificates())
+	assert.Empty(t, cm.pending)
+	assert.False(t, cm.coveredByPendingWildcards([]string{"app.example.com"}))
+}
@@ -0,0 +1,202 @@
+package ssl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
+)
+
+// CertificateState is what is known of a certificate: its metadata, the
+// outcome of the last issuance attempts and its renewal schedule. It is kept
+// in state.json in the SSL directory across restarts.
+type CertificateState struct {
+	Domains     []string         `json:"domains,omitempty"`
+	Issuer      string           `json:"issuer,omitempty"`
+	NotAfter    time.Time        `json:"not_after"`
+	SelfSigned  bool             `json:"self_signed,omitempty"` // A self-signed certificate is served instead
+	LastAttempt time.Time        `json:"last_attempt"`          // Last issuance attempt
+	Failures    int              `json:"failures,omitempty"`    // Consecutive failed attempts
+	NextRetry   time.Time        `json:"next_retry"`            // No attempt is made before
+	LastError   string           `json:"last_error,omitempty"`
+	Renewal     *RenewalSchedule `json:"renewal,omitempty"`
+}
+
+// stateStore keeps the state of all certificates in a file
+type stateStore struct {
+	path  string
+	certs map[string]CertificateState
+	mu    sync.Mutex
+}
+
+// newStateStore loads the certificate state stored in path
+func newStateStore(path string) (*stateStore, error) {
+	s := &stateStore{
+		path:  path,
+		certs: make(map[string]CertificateState),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(data, &s.certs)
+}
+
+// Get returns the state of a certificate
+func (s *stateStore) Get(name string) (CertificateState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.certs[name]
+	return state, ok
+}
+
+// Update changes the state of a certificate and saves all states
+func (s *stateStore) Update(name string, update func(*CertificateState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.certs[name]
+	update(&state)
+	s.certs[name] = state
+	return s.save()
+}
+
+// Delete forgets a certificate
+func (s *stateStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.certs, name)
+	return s.save()
+}
+
+// All returns a copy of all states
+func (s *stateStore) All() map[string]CertificateState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make(map[string]CertificateState, len(s.certs))
+	for name, state := range s.certs {
+		all[name] = state
+	}
+	return all
+}
+
+// save writes the states, replacing the file atomically
+func (s *stateStore) save() error {
+	data, err := json.MarshalIndent(s.certs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// retryDelay returns how long to wait after the given number of consecutive
+// failed issuances, doubling from constants.CertificateRetryInitial up to
+// constants.CertificateRetryMax
+func retryDelay(failures int) time.Duration {
+	delay := constants.CertificateRetryInitial
+	for i := 1; i < failures && delay < constants.CertificateRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, constants.CertificateRetryMax)
+}
+
+// recordCertificate updates the metadata of a certificate from the file on
+// disk
+func (cm *CertificateManager) recordCertificate(name string) {
+	cert, err := cm.loadCertificate(name)
+	if err != nil {
+		return
+	}
+	err = cm.state.Update(name, func(state *CertificateState) {
+		state.Domains = cert.DNSNames
+		state.Issuer = cert.Issuer.CommonName
+		state.NotAfter = cert.NotAfter
+	})
+	if err != nil {
+		cm.logger.Warn("Failed to save the state of certificate %s: %v", name, err)
+	}
+}
+
+// recordSuccess records that a certificate was obtained
+func (cm *CertificateManager) recordSuccess(name string) {
+	err := cm.state.Update(name, func(state *CertificateState) {
+		state.LastAttempt = time.Now()
+		state.Failures = 0
+		state.NextRetry = time.Time{}
+		state.LastError = ""
+		state.SelfSigned = false
+	})
+	if err != nil {
+		cm.logger.Warn("Failed to save the state of certificate %s: %v", name, err)
+	}
+	cm.recordCertificate(name)
+}
+
+// recordFailure records a failed issuance and backs off exponentially before
+// the next attempt
+func (cm *CertificateManager) recordFailure(name string, cause error) {
+	var state CertificateState
+	err := cm.state.Update(name, func(s *CertificateState) {
+		s.LastAttempt = time.Now()
+		s.Failures++
+		s.NextRetry = s.LastAttempt.Add(retryDelay(s.Failures))
+		s.LastError = cause.Error()
+		state = *s
+	})
+	if err != nil {
+		cm.logger.Warn("Failed to save the state of certificate %s: %v", name, err)
+	}
+	cm.logger.Info("Certificate %s failed %d times, next attempt at %s", name, state.Failures, state.NextRetry.Format(time.RFC3339))
+}
+
+// inBackoff reports whether no issuance of a certificate may be attempted
+// yet because of recent failures
+func (cm *CertificateManager) inBackoff(name string) bool {
+	state, ok := cm.state.Get(name)
+	return ok && time.Now().Before(state.NextRetry)
+}
+
+// rebuildState brings the stored state in line with the certificates on
+// disk. Certificates that are gone are forgotten unless an issuance is backing
+// off or a self-signed certificate stands in for them.
+func (cm *CertificateManager) rebuildState() {
+	certDir := filepath.Join(cm.sslPath, "certs")
+	entries, err := os.ReadDir(certDir)
+	if err != nil {
+		return
+	}
+
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".crt")
+		if !ok || entry.IsDir() || strings.HasSuffix(name, ".selfsigned") || strings.HasSuffix(name, ECDSASuffix) {
+			continue
+		}
+		if !cm.certificateExists(name) {
+			continue
+		}
+		found[name] = true
+		cm.recordCertificate(name)
+	}
+
+	now := time.Now()
+	for name, state := range cm.state.All() {
+		if found[name] || state.SelfSigned || now.Before(state.NextRetry) {
+			continue
+		}
+		if err := cm.state.Delete(name); err != nil {
+			cm.logger.Warn("Failed to save the certificate state: %v", err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ssl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Hour, retryDelay(1))
+	assert.Equal(t, 2*time.Hour, retryDelay(2))
+	assert.Equal(t, 16*time.Hour, retryDelay(5))
+	assert.Equal(t, 24*time.Hour, retryDelay(6))
+	assert.Equal(t, 24*time.Hour, retryDelay(100))
+}
+
+func TestRecordFailureBacksOff(t *testing.T) {
+	sslPath := t.TempDir()
+	cm := newTestCertificateManagerWithCA(t, "http://127.0.0.1:1/directory", sslPath)
+
+	cm.recordFailure("example.com", errors.New("connection refused"))
+	cm.recordFailure("example.com", errors.New("connection refused"))
+	state, ok := cm.state.Get("example.com")
+	require.True(t, ok)
+	assert.Equal(t, 2, state.Failures)
+	assert.Equal(t, "connection refused", state.LastError)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), state.NextRetry, time.Minute)
+	assert.True(t, cm.inBackoff("example.com"))
+
+	// The backoff survives a restart, although there is no certificate
+	restarted := newTestCertificateManagerWithCA(t, "http://127.0.0.1:1/directory", sslPath)
+	assert.True(t, restarted.inBackoff("example.com"))
+
+	// A certificate obtained later clears the failures
+	writeTestCertificate(t, restarted, "example.com", "example.com")
+	restarted.recordSuccess("example.com")
+	state, _ = restarted.state.Get("example.com")
+	assert.Zero(t, state.Failures)
+	assert.Empty(t, state.LastError)
+	assert.False(t, restarted.inBackoff("example.com"))
+	assert.Equal(t, []string{"example.com"}, state.Domains)
+}
+
+func TestRebuildState(t *testing.T) {
+	sslPath := t.TempDir()
+	cm := newTestCertificateManagerWithCA(t, "http://127.0.0.1:1/directory", sslPath)
+	writeTestCertificate(t, cm, "example.com", "example.com", "www.example.com")
+	writeTestCertificate(t, cm, "gone.example.com", "gone.example.com")
+	cm.recordCertificate("gone.example.com")
+	require.NoError(t, os.Remove(filepath.Join(sslPath, "certs", "gone.example.com.crt")))
+
+	// Certificates found on disk at startup are known, vanished ones forgotten
+	restarted := newTestCertificateManagerWithCA(t, "http://127.0.0.1:1/directory", sslPath)
+	state, ok := restarted.state.Get("example.com")
+	require.True(t, ok)
+	assert.Equal(t, []string{"example.com", "www.example.com"}, state.Domains)
+	assert.Equal(t, "example.com", state.Issuer)
+	assert.False(t, state.NotAfter.IsZero())
+	assert.NotContains(t, restarted.state.All(), "gone.example.com")
+
+	status := restarted.GetCertificateStatus()["certificates"].(map[string]interface{})
+	assert.Contains(t, status, "example.com")
+}
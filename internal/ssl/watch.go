@@ -0,0 +1,227 @@
+package ssl
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+)
+
+// certificateWatchDelay is how long the certificate directories must be quiet
+// after a change before certificates are validated, so a certificate and its
+// key written one after the other are checked together
+const certificateWatchDelay = 2 * time.Second
+
+// pairStamp identifies the contents of a certificate and its key on disk
+type pairStamp struct {
+	certMod  time.Time
+	certSize int64
+	keyMod   time.Time
+	keySize  int64
+}
+
+// statPair returns the stamp of the certificate name and its key, false if
+// either is missing
+func (cm *CertificateManager) statPair(name string) (pairStamp, bool) {
+	certInfo, err := os.Stat(filepath.Join(cm.sslPath, "certs", name+".crt"))
+	if err != nil {
+		return pairStamp{}, false
+	}
+	keyInfo, err := os.Stat(filepath.Join(cm.sslPath, "private", name+".key"))
+	if err != nil {
+		return pairStamp{}, false
+	}
+	return pairStamp{
+		certMod:  certInfo.ModTime(),
+		certSize: certInfo.Size(),
+		keyMod:   keyInfo.ModTime(),
+		keySize:  keyInfo.Size(),
+	}, true
+}
+
+// WatchCertificates validates the certificates on disk and watches the certs
+// and private directories, so certificates replaced by other tools are
+// validated and the update handler is called. Certificates whose key does not
+// match are rejected until they are fixed.
+func (cm *CertificateManager) WatchCertificates() error {
+	cm.scanCertificates()
+
+	dirs := []string{filepath.Join(cm.sslPath, "certs"), filepath.Join(cm.sslPath, "private")}
+	changes, err := watchDirectories(cm.renewalCtx, dirs)
+	if err != nil {
+		return fmt.Errorf("failed to watch certificates: %v", err)
+	}
+
+	cm.renewalWG.Add(1)
+	go func() {
+		defer cm.renewalWG.Done()
+
+		var settled <-chan time.Time
+		for {
+			select {
+			case <-cm.renewalCtx.Done():
+				return
+			case _, ok := <-changes:
+				if !ok {
+					if cm.renewalCtx.Err() == nil {
+						cm.logger.Error("Stopped watching certificates on disk")
+					}
+					return
+				}
+				settled = time.After(cm.watchDelay)
+			case <-settled:
+				settled = nil
+				if cm.scanCertificates() {
+					cm.notifyUpdate()
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// indexedCertificate is a certificate on disk as last validated
+type indexedCertificate struct {
+	stamp     pairStamp
+	names     []string // DNS names and IP addresses in lower case
+	notBefore time.Time
+	notAfter  time.Time
+	err       string // Why the certificate cannot be served, empty if it can
+	reported  string // Rejection last logged
+}
+
+// scanCertificates validates the certificates that changed on disk since they
+// were last validated. It returns true if any certificate was added, replaced
+// or removed.
+func (cm *CertificateManager) scanCertificates() bool {
+	entries, err := os.ReadDir(filepath.Join(cm.sslPath, "certs"))
+	if err != nil {
+		cm.logger.Warn("Failed to list certificates: %v", err)
+		return false
+	}
+
+	changed := false
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".crt")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		stamp, ok := cm.statPair(name)
+		if !ok {
+			continue
+		}
+		present[name] = true
+		if cm.revalidate(name, stamp) {
+			changed = true
+		}
+	}
+
+	cm.watchMu.Lock()
+	defer cm.watchMu.Unlock()
+	for name := range cm.index {
+		if !present[name] {
+			delete(cm.index, name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// revalidate validates the certificate name again if it changed since it was
+// last validated, and returns true if it did
+func (cm *CertificateManager) revalidate(name string, stamp pairStamp) bool {
+	cm.watchMu.Lock()
+	defer cm.watchMu.Unlock()
+
+	previous, known := cm.index[name]
+	if known && previous.stamp == stamp {
+		return false
+	}
+
+	entry := &indexedCertificate{stamp: stamp}
+	if cert, err := cm.loadCertificate(name); err == nil {
+		entry.names = certificateNames(cert)
+		for _, ip := range cert.IPAddresses {
+			entry.names = append(entry.names, ip.String())
+		}
+		for i, certName := range entry.names {
+			entry.names[i] = strings.ToLower(certName)
+		}
+		entry.notBefore, entry.notAfter = cert.NotBefore, cert.NotAfter
+	}
+	cm.index[name] = entry
+
+	if err := cm.validateCertificatePair(name); err != nil {
+		entry.err = err.Error()
+		entry.reported = entry.err
+		cm.logger.Error("Rejecting certificate %s: %v", name, err)
+		return true
+	}
+	if known {
+		cm.logger.Info("Certificate %s changed on disk", name)
+		if _, ok := cm.state.Get(name); ok {
+			cm.recordCertificate(name)
+		}
+	}
+	return true
+}
+
+// validateCertificatePair checks that nginx can load the certificate name:
+// the certificate and key parse and the key belongs to the certificate
+func (cm *CertificateManager) validateCertificatePair(name string) error {
+	cert, err := cm.loadCertificate(name)
+	if err != nil {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+
+	keyData, err := os.ReadFile(filepath.Join(cm.sslPath, "private", name+".key"))
+	if err != nil {
+		return fmt.Errorf("failed to read key: %v", err)
+	}
+	key, err := acme.ParsePrivateKey(keyData)
+	if err != nil {
+		return fmt.Errorf("invalid key: %v", err)
+	}
+	public, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(cert.PublicKey) {
+		return fmt.Errorf("key does not match the certificate")
+	}
+
+	return nil
+}
+
+// CertificateUsable reports whether the certificate name and its key exist
+// and are valid. Certificates that changed since they were last validated are
+// validated again.
+func (cm *CertificateManager) CertificateUsable(name string) bool {
+	stamp, ok := cm.statPair(name)
+	if !ok {
+		return false
+	}
+	cm.revalidate(name, stamp)
+
+	cm.watchMu.Lock()
+	defer cm.watchMu.Unlock()
+	entry, ok := cm.index[name]
+	return ok && entry.err == ""
+}
+
+// CertificateErrors returns why certificates on disk were rejected keyed by
+// certificate name
+func (cm *CertificateManager) CertificateErrors() map[string]string {
+	cm.watchMu.Lock()
+	defer cm.watchMu.Unlock()
+
+	failures := make(map[string]string)
+	for name, entry := range cm.index {
+		if entry.err != "" {
+			failures[name] = entry.err
+		}
+	}
+	return failures
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package ssl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// inotifyEvents are the changes to files of a watched directory reported by
+// inotify. Mounted secrets are replaced by renaming a symlink.
+const inotifyEvents = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+
+// watchDirectories reports on the returned channel when files in dirs change,
+// until ctx is done. Reports are coalesced while they are not received.
+func watchDirectories(ctx context.Context, dirs []string) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %v", err)
+	}
+	// A non-blocking descriptor is read through the runtime poller, so closing
+	// the file stops a pending read
+	file := os.NewFile(uintptr(fd), "inotify")
+	for _, dir := range dirs {
+		if _, err := syscall.InotifyAddWatch(fd, dir, inotifyEvents); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to watch %s: %v", dir, err)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		file.Close()
+	}()
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		buf := make([]byte, 64*1024)
+		for {
+			// Events are not decoded, any change causes the directories to be
+			// scanned again, including a queue overflow
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			if n > 0 {
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
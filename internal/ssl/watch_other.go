@@ -0,0 +1,69 @@
+//go:build !linux
+
+package ssl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// directoryPollInterval is how often watched directories are listed where
+// inotify is not available
+const directoryPollInterval = 10 * time.Second
+
+// watchDirectories reports on the returned channel when files in dirs change,
+// until ctx is done. Directories are polled since inotify is Linux only.
+func watchDirectories(ctx context.Context, dirs []string) (<-chan struct{}, error) {
+	last, err := snapshotDirectories(dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(directoryPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, err := snapshotDirectories(dirs)
+				if err != nil || current == last {
+					continue
+				}
+				last = current
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// snapshotDirectories describes the names, sizes and modification times of
+// the files in dirs
+func snapshotDirectories(dirs []string) (string, error) {
+	var snapshot string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to watch %s: %v", dir, err)
+		}
+		for _, entry := range entries {
+			info, err := os.Stat(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			snapshot += fmt.Sprintf("%s/%s %d %d\n", dir, entry.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return snapshot, nil
+}
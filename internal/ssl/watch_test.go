@@ -0,0 +1,118 @@
+package ssl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replaceKey writes a new key for the certificate name that does not match it
+func replaceKey(t *testing.T, cm *CertificateManager, name string) {
+	t.Helper()
+	key, err := acme.GenerateKey(acme.KeyTypeEC256)
+	require.NoError(t, err)
+	keyPEM, err := acme.EncodePrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(cm.sslPath, "private", name+".key")
+	require.NoError(t, os.WriteFile(keyPath, keyPEM, 0600))
+	// Keys of one type have the same size, make sure the change is seen
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(keyPath, later, later))
+}
+
+// waitForUpdate waits for the update handler to be called
+func waitForUpdate(t *testing.T, updates <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-updates:
+	case <-time.After(10 * time.Second):
+		t.Fatal("certificate change was not picked up")
+	}
+}
+
+func TestValidateCertificatePair(t *testing.T) {
+	cm := newTestCertificateManager(t)
+
+	writeTestCertificate(t, cm, "example.com", "example.com", "www.example.com")
+	assert.NoError(t, cm.validateCertificatePair("example.com"))
+	writeTestCertificate(t, cm, "*.example.org", "*.example.org", "example.org")
+	assert.NoError(t, cm.validateCertificatePair("*.example.org"))
+	writeTestCertificate(t, cm, "example.net.selfsigned", "example.net")
+	assert.NoError(t, cm.validateCertificatePair("example.net.selfsigned"))
+	writeTestCertificate(t, cm, "default", "localhost")
+	assert.NoError(t, cm.validateCertificatePair("default"))
+
+	replaceKey(t, cm, "example.com")
+	assert.ErrorContains(t, cm.validateCertificatePair("example.com"), "key does not match")
+
+	writeCertificatePair(t, cm, "broken.com")
+	assert.ErrorContains(t, cm.validateCertificatePair("broken.com"), "invalid certificate")
+}
+
+func TestCertificateUsable(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	assert.False(t, cm.CertificateUsable("example.com"))
+
+	writeTestCertificate(t, cm, "example.com", "example.com")
+	assert.True(t, cm.CertificateUsable("example.com"))
+	assert.Empty(t, cm.CertificateErrors())
+
+	// A pair replaced since it was last validated is validated again
+	replaceKey(t, cm, "example.com")
+	assert.False(t, cm.CertificateUsable("example.com"))
+	assert.False(t, cm.CertificateCovers("example.com", "example.com"))
+	assert.Contains(t, cm.CertificateErrors()["example.com"], "key does not match")
+
+	writeTestCertificate(t, cm, "example.com", "example.com")
+	assert.True(t, cm.CertificateUsable("example.com"))
+	assert.Empty(t, cm.CertificateErrors())
+}
+
+func TestWatchCertificates(t *testing.T) {
+	cm := newTestCertificateManager(t)
+	cm.watchDelay = 50 * time.Millisecond
+	writeTestCertificate(t, cm, "example.com", "example.com")
+	writeCertificatePair(t, cm, "broken.com")
+
+	updates := make(chan struct{}, 10)
+	cm.SetUpdateHandler(func() { updates <- struct{}{} })
+	require.NoError(t, cm.WatchCertificates())
+
+	// Certificates on disk at startup are validated without a reload
+	assert.Equal(t, []string{"broken.com"}, mapKeys(cm.CertificateErrors()))
+	assert.Empty(t, updates)
+
+	// A certificate dropped in by another tool causes a reload
+	writeTestCertificate(t, cm, "app.example.com", "app.example.com")
+	waitForUpdate(t, updates)
+	assert.True(t, cm.CertificateUsable("app.example.com"))
+
+	// A mismatched key is rejected and reported until it is fixed
+	replaceKey(t, cm, "app.example.com")
+	waitForUpdate(t, updates)
+	assert.Contains(t, cm.CertificateErrors()["app.example.com"], "key does not match")
+	assert.False(t, cm.CertificateUsable("app.example.com"))
+
+	writeTestCertificate(t, cm, "app.example.com", "app.example.com")
+	waitForUpdate(t, updates)
+	assert.NotContains(t, cm.CertificateErrors(), "app.example.com")
+
+	// Removed certificates are no longer reported
+	require.NoError(t, RemoveCertificate(cm.sslPath, "broken.com"))
+	waitForUpdate(t, updates)
+	assert.Empty(t, cm.CertificateErrors())
+}
+
+// mapKeys returns the keys of m
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
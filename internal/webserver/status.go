@@ -0,0 +1,133 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rahulshinde/nginx-proxy-go/internal/health"
+)
+
+// TLSComplianceEntry describes the TLS policy used by one SSL host
+type TLSComplianceEntry struct {
+	Hostname  string `json:"hostname"`
+	Port      int    `json:"port"`
+	Profile   string `json:"profile"`
+	Override  bool   `json:"override"`
+	Protocols string `json:"protocols"`
+	Ciphers   string `json:"ciphers,omitempty"`
+}
+
+// TLSComplianceReport lists the TLS profile each host uses
+type TLSComplianceReport struct {
+	GlobalProfile string               `json:"global_profile"`
+	Hosts         []TLSComplianceEntry `json:"hosts"`
+}
+
+// startStatusServer serves health and compliance endpoints until ctx is cancelled
+func (ws *WebServer) startStatusServer(ctx context.Context) {
+	if ws.config.StatusAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", ws.health.Handler())
+	mux.HandleFunc("/ready", ws.health.ReadinessHandler())
+	mux.HandleFunc("/live", ws.health.LivenessHandler())
+	mux.HandleFunc("/tls", ws.handleTLSCompliance)
+	mux.HandleFunc("/certificates", ws.handleCertificates)
+	mux.HandleFunc("/local-ca.crt", ws.handleLocalCA)
+
+	srv := &http.Server{
+		Addr:              ws.config.StatusAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		ws.log.Info("Status server listening on %s", ws.config.StatusAddr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			ws.log.Error("Status server failed: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+}
+
+// handleTLSCompliance reports the TLS profile of every SSL host
+func (ws *WebServer) handleTLSCompliance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ws.TLSCompliance()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handleCertificates reports the expiry and renewal schedule of every certificate
+func (ws *WebServer) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ws.certificateManager.GetCertificateStatus()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handleLocalCA serves the root certificate of the local CA, to be installed
+// in browsers
+func (ws *WebServer) handleLocalCA(w http.ResponseWriter, r *http.Request) {
+	ca := ws.certificateManager.LocalCA()
+	if ca == nil {
+		http.Error(w, "SSL_MODE is not local-ca", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="nginx-proxy-go-local-ca.crt"`)
+	w.Write(ca.RootPEM())
+}
+
+// TLSCompliance builds the TLS compliance report for the current hosts
+func (ws *WebServer) TLSCompliance() TLSComplianceReport {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	report := TLSComplianceReport{
+		GlobalProfile: ws.tlsPolicyProcessor.Global().Name(),
+		Hosts:         make([]TLSComplianceEntry, 0),
+	}
+
+	for _, h := range ws.getAllHosts() {
+		if !h.SSLEnabled {
+			continue
+		}
+		policy := ws.tlsPolicyProcessor.EffectivePolicy(h)
+		report.Hosts = append(report.Hosts, TLSComplianceEntry{
+			Hostname:  h.Hostname,
+			Port:      h.Port,
+			Profile:   policy.Name(),
+			Override:  h.TLSPolicy != nil,
+			Protocols: policy.Protocols,
+			Ciphers:   policy.Ciphers,
+		})
+	}
+
+	sort.Slice(report.Hosts, func(i, j int) bool {
+		if report.Hosts[i].Hostname != report.Hosts[j].Hostname {
+			return report.Hosts[i].Hostname < report.Hosts[j].Hostname
+		}
+		return report.Hosts[i].Port < report.Hosts[j].Port
+	})
+	return report
+}
+
+// registerHealthCheckers registers the default health checks
+func (ws *WebServer) registerHealthCheckers() {
+	ws.health.RegisterChecker(health.NewDockerChecker(ws.dockerClient))
+	ws.health.RegisterChecker(health.NewNginxChecker())
+	ws.health.RegisterChecker(health.NewOCSPChecker(ws.certificateManager))
+	ws.health.RegisterChecker(health.NewCertificateChecker(ws.certificateManager))
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,13 +20,16 @@ import (
 	"github.com/docker/docker/api/types/events"
 	"github.com/rahulshinde/nginx-proxy-go/internal/acme"
 	"github.com/rahulshinde/nginx-proxy-go/internal/config"
+	"github.com/rahulshinde/nginx-proxy-go/internal/constants"
 	appcontainer "github.com/rahulshinde/nginx-proxy-go/internal/container"
 	"github.com/rahulshinde/nginx-proxy-go/internal/dockerapi"
 	"github.com/rahulshinde/nginx-proxy-go/internal/errors"
 	"github.com/rahulshinde/nginx-proxy-go/internal/event"
+	"github.com/rahulshinde/nginx-proxy-go/internal/health"
 	"github.com/rahulshinde/nginx-proxy-go/internal/host"
 	"github.com/rahulshinde/nginx-proxy-go/internal/logger"
 	"github.com/rahulshinde/nginx-proxy-go/internal/nginx"
+	"github.com/rahulshinde/nginx-proxy-go/internal/notify"
 	"github.com/rahulshinde/nginx-proxy-go/internal/processor"
 	"github.com/rahulshinde/nginx-proxy-go/internal/ssl"
 )
@@ -35,16 +40,30 @@ type WebServer struct {
 	config                 *config.Config
 	nginx                  *nginx.Nginx
 	hosts                  map[string]map[int]*host.Host
+	streams                map[string]*host.Host // TCP and UDP streams keyed by host.StreamKey
 	containers             map[string]*appcontainer.Container
 	networks               map[string]string
+	addressFamilies        *processor.AddressFamilies // Address family containers are proxied to by network
 	mu                     sync.RWMutex
 	template               *nginx.Template
+	streamTemplate         *nginx.Template
+	acmeManager            *acme.Manager
 	basicAuthProcessor     *processor.BasicAuthProcessor
 	ipFilterProcessor      *processor.IPFilterProcessor
+	clientAuthProcessor    *processor.ClientAuthProcessor
+	backendTLSProcessor    *processor.BackendTLSProcessor
+	tlsPolicyProcessor     *processor.TLSPolicyProcessor
+	certGroupProcessor     *processor.CertificateGroupProcessor
+	http3Processor         *processor.HTTP3Processor
+	listenProcessor        *processor.ListenProcessor
+	upstreamDNSProcessor   *processor.UpstreamDNSProcessor
+	http3Supported         bool // Whether nginx was built with HTTP/3, checked on start
 	redirectProcessor      *processor.RedirectProcessor
 	defaultServerProcessor *processor.DefaultServerProcessor
 	certificateManager     *ssl.CertificateManager
+	notifier               *notify.Notifier
 	eventProcessor         *event.Processor
+	health                 *health.Manager
 	log                    *logger.Logger
 }
 
@@ -58,27 +77,106 @@ func NewWebServer(dockerClient dockerapi.Client, cfg *config.Config, nginxInstan
 		return nil, errors.New(errors.ErrorTypeSystem, "failed to initialize logger", err)
 	}
 
+	// Containers are proxied to by IPv4 unless their network prefers IPv6
+	addressFamilies, err := processor.ParseAddressFamilies(cfg.AddressFamily, cfg.NetworkAddressFamily)
+	if err != nil {
+		logger.Warn("Invalid address family configuration: %v, preferring IPv4", err)
+	}
+
 	// Create ACME manager
-	apiURL := os.Getenv("LETSENCRYPT_API")
-	if apiURL == "" {
-		apiURL = "https://acme-v02.api.letsencrypt.org/directory"
+	ca, err := acme.CAFromEnv(cfg.ACMECA)
+	if err != nil {
+		logger.Warn("Invalid ACME CA: %v, using %s", err, constants.DefaultACMECA)
+		ca, _ = acme.CAFromEnv(constants.DefaultACMECA)
+	}
+	if cfg.ACMEEmail != "" {
+		ca.Email = cfg.ACMEEmail
+	}
+	if cfg.ACMEEABKeyID != "" {
+		ca.EABKeyID, ca.EABHMACKey = cfg.ACMEEABKeyID, cfg.ACMEEABHMACKey
+	}
+	acmeManager := acme.NewManager(ca.DirectoryURL, cfg.ChallengeDir)
+	acmeManager.SetCA(ca)
+	acmeManager.SetLogger(logger)
+	if cfg.ACMEFallbackCA != "" {
+		if fallback, err := acme.CAFromEnv(cfg.ACMEFallbackCA); err != nil {
+			logger.Warn("ACME fallback CA disabled: %v", err)
+		} else {
+			acmeManager.SetFallbackCA(fallback)
+		}
+	}
+	if cfg.ACMEDNSProvider != "" {
+		if _, err := acme.NewDNSProvider(cfg.ACMEDNSProvider); err != nil {
+			logger.Warn("DNS-01 challenges disabled: %v", err)
+		} else {
+			acmeManager.SetDNSProvider(cfg.ACMEDNSProvider)
+		}
+	}
+	if cfg.ACMETLSALPN {
+		acmeManager.SetTLSALPN(cfg.ACMETLSALPNAddr)
 	}
-	acmeManager := acme.NewManager(apiURL, cfg.ChallengeDir)
 
 	// Create certificate manager
 	certManager := ssl.NewCertificateManager("/etc/ssl/custom", acmeManager, logger)
 
+	// Configure the key type of new certificates
+	keyType, err := acme.ParseKeyType(cfg.SSLKeyType)
+	if err != nil {
+		logger.Warn("Invalid SSL_KEY_TYPE: %v, using %s", err, acme.DefaultKeyType)
+		keyType = acme.DefaultKeyType
+	}
+	acmeManager.SetKeyType(keyType)
+	certManager.SetKeyType(keyType, cfg.SSLDualCert)
+	certManager.SetWildcardDomains(cfg.WildcardDomains)
+
+	// Issue certificates from a local development CA instead of ACME
+	switch cfg.SSLMode {
+	case constants.SSLModeLocalCA:
+		if err := certManager.EnableLocalCA(); err != nil {
+			logger.Error("Local CA unavailable, obtaining certificates through ACME: %v", err)
+		}
+	case constants.SSLModeACME:
+	default:
+		logger.Warn("Invalid SSL_MODE %q, using %s", cfg.SSLMode, constants.SSLModeACME)
+	}
+
+	// Report certificate problems to webhooks
+	notifier := notify.NewNotifier(filepath.Join("/etc/ssl/custom", "notifications.json"), logger)
+	if cfg.NotifyWebhookURL != "" {
+		if err := notifier.AddWebhook(cfg.NotifyWebhookURL, notify.FormatJSON); err != nil {
+			logger.Warn("Invalid NOTIFY_WEBHOOK_URL: %v", err)
+		}
+	}
+	if cfg.NotifySlackWebhookURL != "" {
+		if err := notifier.AddWebhook(cfg.NotifySlackWebhookURL, notify.FormatSlack); err != nil {
+			logger.Warn("Invalid NOTIFY_SLACK_WEBHOOK_URL: %v", err)
+		}
+	}
+	certManager.SetNotifier(notifier, time.Duration(cfg.NotifyExpiryDays)*24*time.Hour, cfg.NotifyFailures)
+
 	ws := &WebServer{
 		dockerClient:           dockerClient,
 		config:                 cfg,
 		hosts:                  make(map[string]map[int]*host.Host),
+		streams:                make(map[string]*host.Host),
 		containers:             make(map[string]*appcontainer.Container),
 		networks:               make(map[string]string),
+		addressFamilies:        addressFamilies,
 		basicAuthProcessor:     processor.NewBasicAuthProcessor(filepath.Join(cfg.ConfDir, "basic_auth")),
 		ipFilterProcessor:      processor.NewIPFilterProcessor(cfg, logger),
+		clientAuthProcessor:    processor.NewClientAuthProcessor(logger),
+		backendTLSProcessor:    processor.NewBackendTLSProcessor(cfg, logger),
+		tlsPolicyProcessor:     processor.NewTLSPolicyProcessor(cfg, logger),
+		certGroupProcessor:     processor.NewCertificateGroupProcessor(logger),
+		http3Processor:         processor.NewHTTP3Processor(cfg.HTTP3, logger),
+		listenProcessor:        processor.NewListenProcessor(cfg.ListenAddresses, cfg.DualStack, logger),
+		upstreamDNSProcessor:   processor.NewUpstreamDNSProcessor(cfg.UpstreamDNS, logger),
 		redirectProcessor:      processor.NewRedirectProcessor(logger),
 		defaultServerProcessor: processor.NewDefaultServerProcessor(logger),
 		certificateManager:     certManager,
+		notifier:               notifier,
+		acmeManager:            acmeManager,
+		health:                 health.NewManager(),
 		log:                    logger,
 	}
 
@@ -88,15 +186,22 @@ func NewWebServer(dockerClient dockerapi.Client, cfg *config.Config, nginxInstan
 		ws.nginx = nginxInstance
 	} else {
 		ws.nginx = nginx.NewNginx(confFile, cfg.ChallengeDir, nil)
+		ws.nginx.SetStreamConfFile(filepath.Join(cfg.ConfDir, "stream.d", "default.conf"))
 	}
 
-	// Load template
-	tmpl, err := ws.loadTemplate()
+	// Load templates
+	tmpl, err := ws.loadTemplate("templates/nginx.conf.tmpl")
 	if err != nil {
 		return nil, err
 	}
 	ws.template = tmpl
 
+	streamTmpl, err := ws.loadTemplate("templates/stream.conf.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	ws.streamTemplate = streamTmpl
+
 	// Learn about self
 	if err := ws.learnYourself(); err != nil {
 		return nil, errors.New(errors.ErrorTypeSystem, "failed to learn about self", err)
@@ -109,9 +214,8 @@ func NewWebServer(dockerClient dockerapi.Client, cfg *config.Config, nginxInstan
 	return ws, nil
 }
 
-// loadTemplate loads the nginx configuration template from file
-func (ws *WebServer) loadTemplate() (*nginx.Template, error) {
-	templatePath := "templates/nginx.conf.tmpl"
+// loadTemplate loads an nginx configuration template from file
+func (ws *WebServer) loadTemplate(templatePath string) (*nginx.Template, error) {
 	ws.log.Debug("Loading nginx template from: %s", templatePath)
 
 	data, err := os.ReadFile(templatePath)
@@ -128,12 +232,8 @@ func (ws *WebServer) loadTemplate() (*nginx.Template, error) {
 func (ws *WebServer) Start(ctx context.Context) error {
 	ws.log.Info("Starting WebServer...")
 
-	// Print letsencrypt API URL
-	apiURL := os.Getenv("LETSENCRYPT_API")
-	if apiURL == "" {
-		apiURL = "https://acme-v02.api.letsencrypt.org/directory"
-	}
-	fmt.Printf("Using letsencrypt  url : %s\n", apiURL)
+	// Log the ACME directory URL
+	ws.log.Info("Using ACME CA: %s (%s)", ws.acmeManager.CA().Name, ws.acmeManager.CA().DirectoryURL)
 
 	// Check if nginx is alive
 	fmt.Printf("Nginx is alive\n")
@@ -143,6 +243,50 @@ func (ws *WebServer) Start(ctx context.Context) error {
 		ws.log.Warn("Failed to create default SSL certificate: %v", err)
 	}
 
+	// Generate DH parameters before the first reload so ssl_dhparam can be emitted
+	if err := ws.nginx.EnsureDHParam(ws.config.DHParamFile, ws.config.DHParamSize); err != nil {
+		ws.log.Warn("DH parameters unavailable, continuing without ssl_dhparam: %v", err)
+	} else {
+		ws.tlsPolicyProcessor.SetDHParamFile(ws.config.DHParamFile)
+	}
+
+	// QUIC listeners are only emitted when nginx can serve them
+	supported, err := ws.nginx.SupportsHTTP3()
+	if err != nil {
+		ws.log.Warn("Could not check nginx for HTTP/3 support, HTTP/3 is disabled: %v", err)
+	} else if !supported && ws.config.HTTP3 {
+		ws.log.Warn("HTTP3 is set but nginx was built without the HTTP/3 module, HTTP/3 is disabled")
+	}
+	ws.http3Supported = supported
+
+	// Reload nginx whenever certificates or cached OCSP responses change
+	ws.certificateManager.SetUpdateHandler(ws.reloadCertificates)
+
+	// Reload nginx when certificates are replaced on disk by other tools
+	if err := ws.certificateManager.WatchCertificates(); err != nil {
+		ws.log.Warn("Certificates changed on disk are picked up on the next reload only: %v", err)
+	}
+
+	// Obtain wildcard certificates in the background, they need DNS-01 challenges
+	// unless the local CA issues them
+	if len(ws.config.WildcardDomains) > 0 {
+		if ws.config.ACMEDNSProvider == "" && ws.certificateManager.LocalCA() == nil {
+			ws.log.Warn("WILDCARD_DOMAINS is set but ACME_DNS_PROVIDER is not, wildcard certificates cannot be obtained")
+		} else {
+			// Hosts they cover wait for them instead of getting certificates of their own
+			ws.certificateManager.ClaimWildcardCertificates()
+			go func() {
+				if ws.certificateManager.EnsureWildcardCertificates() {
+					ws.reloadCertificates()
+				}
+			}()
+		}
+	}
+
+	// Serve health and TLS compliance endpoints
+	ws.registerHealthCheckers()
+	ws.startStatusServer(ctx)
+
 	// Capture current time for event processing to avoid race conditions
 	// We want to capture events that happen while we are scanning containers
 	since := fmt.Sprintf("%d", time.Now().Unix())
@@ -461,6 +605,7 @@ func (ws *WebServer) rescanAllContainers() error {
 	// Clear existing containers and hosts
 	ws.containers = make(map[string]*appcontainer.Container)
 	ws.hosts = make(map[string]map[int]*host.Host)
+	ws.streams = make(map[string]*host.Host)
 
 	// Add all containers and process their virtual hosts
 	for _, c := range containers {
@@ -491,7 +636,7 @@ func (ws *WebServer) rescanAllContainers() error {
 		// Check if container has virtual host configuration
 		hasVirtualHost := false
 		for k := range env {
-			if strings.HasPrefix(k, "VIRTUAL_HOST") {
+			if strings.HasPrefix(k, "VIRTUAL_HOST") || strings.HasPrefix(k, "VIRTUAL_STREAM") {
 				hasVirtualHost = true
 				break
 			}
@@ -530,8 +675,10 @@ func (ws *WebServer) rescanAllContainers() error {
 			continue
 		}
 
-		hosts := processor.ProcessVirtualHosts(containerJSON, env, knownNetworks)
-		if len(hosts) > 0 {
+		hosts := processor.ProcessVirtualHosts(containerJSON, env, knownNetworks, ws.addressFamilies)
+		streams := processor.ProcessVirtualStreams(containerJSON, env, knownNetworks, ws.addressFamilies)
+		ws.addStreams(streams)
+		if len(hosts) > 0 || len(streams) > 0 {
 			// Print valid configuration message like Python version
 			containerName := strings.TrimPrefix(containerJSON.Name, "/")
 			fmt.Printf("Valid configuration   \tId:%s\t    %s\n", c.ID[:12], containerName)
@@ -552,6 +699,13 @@ func (ws *WebServer) rescanAllContainers() error {
 			}
 			ws.basicAuthProcessor.ProcessBasicAuth(env, hostsByPort)
 			ws.ipFilterProcessor.ProcessIPFilter(env, hostsByPort)
+			ws.clientAuthProcessor.ProcessClientAuth(env, hostsByPort)
+			ws.backendTLSProcessor.ProcessBackendTLS(env, hostsByPort)
+			ws.tlsPolicyProcessor.ProcessTLSPolicy(env, hostsByPort)
+			ws.certGroupProcessor.ProcessCertificateGroup(env, hostsByPort)
+			ws.http3Processor.ProcessHTTP3(env, hostsByPort)
+			ws.listenProcessor.ProcessListen(env, hostsByPort)
+			ws.upstreamDNSProcessor.ProcessUpstreamDNS(containerJSON, env, knownNetworks, hostsByPort)
 
 			// Add hosts to the web server
 			for _, h := range hosts {
@@ -687,7 +841,16 @@ func (ws *WebServer) updateContainer(containerID string) error {
 	for id, name := range ws.networks {
 		knownNetworks[id] = name
 	}
-	hosts := processor.ProcessVirtualHosts(container, env, knownNetworks)
+	hosts := processor.ProcessVirtualHosts(container, env, knownNetworks, ws.addressFamilies)
+	streams := processor.ProcessVirtualStreams(container, env, knownNetworks, ws.addressFamilies)
+	if len(streams) > 0 {
+		ws.log.Info("Found %d virtual stream(s) for container %s", len(streams), containerID)
+		ws.addStreams(streams)
+		if len(hosts) == 0 {
+			ws.log.Info("Reloading nginx configuration due to container %s update", containerID)
+			return ws.reload()
+		}
+	}
 	if len(hosts) > 0 {
 		ws.log.Info("Found %d virtual host(s) for container %s", len(hosts), containerID)
 
@@ -704,6 +867,13 @@ func (ws *WebServer) updateContainer(containerID string) error {
 		}
 		ws.basicAuthProcessor.ProcessBasicAuth(env, hostsByPort)
 		ws.ipFilterProcessor.ProcessIPFilter(env, hostsByPort)
+		ws.clientAuthProcessor.ProcessClientAuth(env, hostsByPort)
+		ws.backendTLSProcessor.ProcessBackendTLS(env, hostsByPort)
+		ws.tlsPolicyProcessor.ProcessTLSPolicy(env, hostsByPort)
+		ws.certGroupProcessor.ProcessCertificateGroup(env, hostsByPort)
+		ws.http3Processor.ProcessHTTP3(env, hostsByPort)
+		ws.listenProcessor.ProcessListen(env, hostsByPort)
+		ws.upstreamDNSProcessor.ProcessUpstreamDNS(container, env, knownNetworks, hostsByPort)
 
 		// Add hosts to the web server
 		for _, h := range hosts {
@@ -751,7 +921,16 @@ func (ws *WebServer) updateContainerLocked(containerID string) error {
 	for id, name := range ws.networks {
 		knownNetworks[id] = name
 	}
-	hosts := processor.ProcessVirtualHosts(container, env, knownNetworks)
+	hosts := processor.ProcessVirtualHosts(container, env, knownNetworks, ws.addressFamilies)
+	streams := processor.ProcessVirtualStreams(container, env, knownNetworks, ws.addressFamilies)
+	if len(streams) > 0 {
+		ws.log.Info("Found %d virtual stream(s) for container %s", len(streams), containerID)
+		ws.addStreams(streams)
+		if len(hosts) == 0 {
+			ws.log.Info("Reloading nginx configuration due to container %s update", containerID)
+			return ws.reload()
+		}
+	}
 	if len(hosts) > 0 {
 		ws.log.Info("Found %d virtual host(s) for container %s", len(hosts), containerID)
 
@@ -768,6 +947,13 @@ func (ws *WebServer) updateContainerLocked(containerID string) error {
 		}
 		ws.basicAuthProcessor.ProcessBasicAuth(env, hostsByPort)
 		ws.ipFilterProcessor.ProcessIPFilter(env, hostsByPort)
+		ws.clientAuthProcessor.ProcessClientAuth(env, hostsByPort)
+		ws.backendTLSProcessor.ProcessBackendTLS(env, hostsByPort)
+		ws.tlsPolicyProcessor.ProcessTLSPolicy(env, hostsByPort)
+		ws.certGroupProcessor.ProcessCertificateGroup(env, hostsByPort)
+		ws.http3Processor.ProcessHTTP3(env, hostsByPort)
+		ws.listenProcessor.ProcessListen(env, hostsByPort)
+		ws.upstreamDNSProcessor.ProcessUpstreamDNS(container, env, knownNetworks, hostsByPort)
 
 		// Add hosts to the web server
 		for _, h := range hosts {
@@ -820,6 +1006,11 @@ func (ws *WebServer) reload() error {
 		}
 	}
 
+	// Pick up certificates changed on disk, then obtain missing certificates in
+	// the background, nginx is reloaded once they arrive
+	ws.certificateManager.IndexCertificates()
+	ws.certificateManager.RequestCertificates(ws.certificateGroups())
+
 	// Process SSL certificates for hosts that require them
 	for hostname, portMap := range ws.hosts {
 		for port, h := range portMap {
@@ -831,42 +1022,38 @@ func (ws *WebServer) reload() error {
 					ws.log.Debug("SSL enabled for %s: changed port to 443 and enabled SSL redirect", hostname)
 				}
 
-				// Check for exact certificate files
-				certPath := filepath.Join("/etc/ssl/custom/certs", hostname+".crt")
-				keyPath := filepath.Join("/etc/ssl/custom/private", hostname+".key")
-
-				if _, err := os.Stat(certPath); err == nil {
-					if _, err := os.Stat(keyPath); err == nil {
-						h.SSLFile = hostname
-						ws.log.Debug("Found existing SSL certificate for %s", hostname)
-						continue
-					}
+				// Select the best valid certificate covering the host by its names
+				selected, err := ws.certificateManager.SelectCertificate(hostname)
+				if selected != "" {
+					h.SSLFile = selected
+					ws.log.Debug("Using SSL certificate %s for %s", selected, hostname)
+					ws.notifier.Resolve(selfSignedNotification + hostname)
+					continue
 				}
 
-				// Check for wildcard certificate files if exact not found
-				wildcardDomain := ""
-				parts := strings.Split(hostname, ".")
-				if len(parts) > 2 {
-					wildcardDomain = "*." + strings.Join(parts[1:], ".")
-					certPath = filepath.Join("/etc/ssl/custom/certs", wildcardDomain+".crt")
-					keyPath = filepath.Join("/etc/ssl/custom/private", wildcardDomain+".key")
-					if _, err := os.Stat(certPath); err == nil {
-						if _, err := os.Stat(keyPath); err == nil {
-							h.SSLFile = wildcardDomain
-							ws.log.Debug("Using wildcard SSL certificate %s for %s", wildcardDomain, hostname)
-							continue
-						}
-					}
+				// Check for a self-signed certificate of the SAN certificate group
+				if certName := h.CertificateName(); certName != hostname && ws.certificateManager.CertificateCovers(certName+".selfsigned", hostname) {
+					h.SSLFile = certName + ".selfsigned"
+					ws.log.Debug("Using self-signed SAN certificate %s for %s", certName, hostname)
+					ws.notifySelfSigned(hostname, certName, err)
+					continue
 				}
 
 				// Check for self-signed certificate
-				selfSignedCertPath := filepath.Join("/etc/ssl/custom/certs", hostname+".selfsigned.crt")
-				selfSignedKeyPath := filepath.Join("/etc/ssl/custom/private", hostname+".selfsigned.key")
+				if ws.certificateManager.CertificateUsable(hostname + ".selfsigned") {
+					h.SSLFile = hostname + ".selfsigned"
+					ws.log.Debug("Found existing self-signed SSL certificate for %s", hostname)
+					ws.notifySelfSigned(hostname, hostname, err)
+					continue
+				}
 
-				if _, err := os.Stat(selfSignedCertPath); err == nil {
-					if _, err := os.Stat(selfSignedKeyPath); err == nil {
-						h.SSLFile = hostname + ".selfsigned"
-						ws.log.Debug("Found existing self-signed SSL certificate for %s", hostname)
+				// Certificates covering the host were rejected, serve a self-signed
+				// certificate rather than an invalid one
+				if err != nil {
+					if name, genErr := ws.certificateManager.SelfSignedCertificate(hostname); genErr == nil {
+						h.SSLFile = name
+						ws.log.Warn("Using self-signed SSL certificate for %s: %v", hostname, err)
+						ws.notifySelfSigned(hostname, hostname, err)
 						continue
 					}
 				}
@@ -877,6 +1064,53 @@ func (ws *WebServer) reload() error {
 		}
 	}
 
+	// TLS streams cannot fall back to plain TCP, they are served a self-signed
+	// certificate until one is obtained
+	for _, s := range ws.streams {
+		if s.Scheme != host.StreamTLS {
+			continue
+		}
+		selected, err := ws.certificateManager.SelectCertificate(s.Hostname)
+		if selected != "" {
+			s.SSLFile = selected
+			continue
+		}
+		name, genErr := ws.certificateManager.SelfSignedCertificate(s.Hostname)
+		if genErr != nil {
+			ws.log.Error("Failed to generate self-signed certificate for stream %s: %v", s.Hostname, genErr)
+			continue
+		}
+		s.SSLFile = name
+		ws.notifySelfSigned(s.Hostname, s.Hostname, err)
+	}
+
+	// Serve ECDSA certificates held alongside RSA certificates, and staple cached
+	// OCSP responses for certificates that have a responder
+	for _, portMap := range ws.hosts {
+		for _, h := range portMap {
+			altFile, staple := "", ""
+			if h.SSLEnabled {
+				certName := h.SSLFile
+				if certName == "*" {
+					certName = "*." + h.Hostname
+				}
+
+				altName := certName + ssl.ECDSASuffix
+				if ws.certificateManager.CertificateCovers(altName, h.Hostname) {
+					altFile = altName
+				}
+
+				// ssl_stapling_file holds a single response, which would not match
+				// one of the two certificates
+				if ws.config.OCSPStapling && altFile == "" {
+					staple = ws.certificateManager.OCSPStapleFile(certName)
+				}
+			}
+			h.SSLAltFile = altFile
+			h.SetOCSPStapleFile(staple)
+		}
+	}
+
 	// Log container configurations
 	for containerID, container := range ws.containers {
 		ws.log.Info("Valid configuration      Id:%s     %s", containerID, container.Name)
@@ -962,7 +1196,24 @@ func (ws *WebServer) reload() error {
 		}
 	}
 
-	config, err := ws.template.Render(ws.getHostsForTemplate(), ws.config)
+	hosts := ws.getHostsForTemplate()
+	streams, front := ws.streamServers()
+	data := &nginx.TemplateData{
+		Hosts:   hosts,
+		Streams: streams,
+		Front:   front,
+		Config:  ws.config,
+		TLS:     ws.tlsPolicyProcessor.Global(),
+	}
+	if ws.config.DefaultServer {
+		rendered := make([]*host.Host, 0, len(hosts))
+		for _, h := range hosts {
+			rendered = append(rendered, h)
+		}
+		data.Defaults = host.DefaultServers(rendered, ws.listenProcessor.Global(), front != nil)
+	}
+
+	config, err := ws.template.Render(data)
 	if err != nil {
 		ws.log.Error("Failed to render nginx template: %v", err)
 		return errors.New(errors.ErrorTypeConfig, "failed to render nginx template", err)
@@ -970,6 +1221,17 @@ func (ws *WebServer) reload() error {
 
 	ws.log.Debug("Template rendered successfully, config length: %d bytes", len(config))
 
+	streamConfig, err := ws.streamTemplate.Render(data)
+	if err != nil {
+		ws.log.Error("Failed to render stream template: %v", err)
+		return errors.New(errors.ErrorTypeConfig, "failed to render stream template", err)
+	}
+
+	if err := ws.nginx.WriteStreamConfig(streamConfig); err != nil {
+		ws.log.Error("Failed to write stream configuration: %v", err)
+		return errors.New(errors.ErrorTypeNginx, "failed to write stream config", err)
+	}
+
 	if err := ws.nginx.UpdateConfig(config); err != nil {
 		ws.log.Error("Failed to update nginx configuration: %v", err)
 		return errors.New(errors.ErrorTypeNginx, "failed to update nginx config", err)
@@ -979,6 +1241,99 @@ func (ws *WebServer) reload() error {
 	return nil
 }
 
+// reloadCertificates reloads nginx so new certificates and refreshed OCSP
+// responses are picked up. Containers are rescanned since reload disables SSL
+// on hosts that had no certificate yet.
+func (ws *WebServer) reloadCertificates() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if err := ws.rescanAllContainers(); err != nil {
+		ws.log.Error("Failed to reload nginx after certificate update: %v", err)
+	}
+}
+
+// selfSignedNotification prefixes the hostname in the key of self-signed
+// fallback notifications
+const selfSignedNotification = "self-signed:"
+
+// notifySelfSigned reports that hostname is served a self-signed certificate
+// standing in for the certificate certName, because the certificates covering
+// it were rejected or the last issuance failed
+func (ws *WebServer) notifySelfSigned(hostname, certName string, rejected error) {
+	reason := "no certificate was obtained yet"
+	if rejected != nil {
+		reason = rejected.Error()
+	} else if issuance := ws.certificateManager.IssuanceError(certName); issuance != "" {
+		reason = issuance
+	}
+	ws.notifier.Notify(selfSignedNotification+hostname, notify.Event{
+		Kind:        notify.EventSelfSignedFallback,
+		Certificate: certName,
+		Host:        hostname,
+		Error:       reason,
+		Message:     fmt.Sprintf("%s is served a self-signed certificate: %s", hostname, reason),
+	})
+}
+
+// certificateGroups returns the hostnames of the SSL hosts grouped by the
+// certificate they share. Groups of the same name requested by several
+// containers are merged, the first challenge type and CA set applying to the
+// group.
+func (ws *WebServer) certificateGroups() []ssl.CertificateGroup {
+	byName := make(map[string][]string)
+	challenges := make(map[string]acme.ChallengeType)
+	cas := make(map[string]string)
+	for _, portMap := range ws.hosts {
+		for _, h := range portMap {
+			if !h.SSLEnabled || len(h.CertDomains) == 0 {
+				continue
+			}
+			name := h.CertificateName()
+			if challenges[name] == "" {
+				challenges[name] = acme.ChallengeType(h.ACMEChallenge)
+			}
+			if cas[name] == "" {
+				cas[name] = h.ACMECA
+			}
+			for _, domain := range h.CertDomains {
+				if !slices.Contains(byName[name], domain) {
+					byName[name] = append(byName[name], domain)
+				}
+			}
+		}
+	}
+
+	// TLS streams get a certificate of their own unless a host shares one
+	for _, s := range ws.streams {
+		if s.Scheme != host.StreamTLS || !processor.IsCertificateHostname(s.Hostname) {
+			continue
+		}
+		shared := false
+		for _, domains := range byName {
+			shared = shared || slices.Contains(domains, s.Hostname)
+		}
+		if !shared {
+			byName[s.Hostname] = []string{s.Hostname}
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make([]ssl.CertificateGroup, 0, len(names))
+	for _, name := range names {
+		// Keep the name first and the other domains in a stable order
+		domains := byName[name]
+		sort.Strings(domains[1:])
+		groups = append(groups, ssl.CertificateGroup{Domains: domains, Challenge: challenges[name], CA: cas[name]})
+	}
+	return groups
+}
+
 // addHost adds a host to the hosts map, merging with existing hosts if necessary
 func (ws *WebServer) addHost(h *host.Host) {
 	if ws.hosts[h.Hostname] == nil {
@@ -996,6 +1351,9 @@ func (ws *WebServer) addHost(h *host.Host) {
 				}
 				// Update location extras - handle injected configs specially
 				ws.mergeExtras(existingLocation.Extras, location.Extras)
+				if existingLocation.BackendTLS == nil {
+					existingLocation.BackendTLS = location.BackendTLS
+				}
 				// Enable upstream if multiple containers
 				if len(existingLocation.Containers) > 1 {
 					existingLocation.UpstreamEnabled = true
@@ -1019,6 +1377,32 @@ func (ws *WebServer) addHost(h *host.Host) {
 		if h.SSLEnabled && !existingHost.SSLEnabled {
 			existingHost.SetSSL(true, h.SSLFile)
 		}
+
+		// Client certificate auth is server-wide, so the first container to set it wins
+		if h.ClientCAFile != "" {
+			if existingHost.ClientCAFile == "" {
+				existingHost.SetClientAuth(h.ClientCAFile, h.ClientVerify, h.ClientDepth, h.ClientHeaders)
+			} else if existingHost.ClientCAFile != h.ClientCAFile {
+				ws.log.Warn("Conflicting PROXY_CLIENT_CA for %s:%d, keeping %s",
+					h.Hostname, h.Port, existingHost.ClientCAFile)
+			}
+		}
+		if existingHost.TLSPolicy == nil {
+			existingHost.TLSPolicy = h.TLSPolicy
+		}
+		if existingHost.CertDomains == nil {
+			existingHost.SetCertDomains(h.CertDomains)
+		}
+		if existingHost.ACMEChallenge == "" {
+			existingHost.SetACMEChallenge(h.ACMEChallenge)
+		}
+		if existingHost.ACMECA == "" {
+			existingHost.SetACMECA(h.ACMECA)
+		}
+		existingHost.HTTP3 = existingHost.HTTP3 || h.HTTP3
+		if existingHost.ListenAddrs == nil {
+			existingHost.ListenAddrs = h.ListenAddrs
+		}
 	} else {
 		// New host - rebuild upstreams from locations
 		ws.rebuildHostUpstreams(h)
@@ -1065,6 +1449,85 @@ func (ws *WebServer) rebuildHostUpstreams(h *host.Host) {
 	}
 }
 
+// addStreams adds streams to the streams map, merging the containers of
+// streams already known
+func (ws *WebServer) addStreams(streams map[string]*host.Host) {
+	for key, s := range streams {
+		existing := ws.streams[key]
+		if existing == nil {
+			s.BuildStreamUpstream()
+			ws.streams[key] = s
+			continue
+		}
+		for _, location := range s.Locations {
+			for _, container := range location.Containers {
+				existing.AddLocation(location.Path, container, nil)
+			}
+		}
+		existing.BuildStreamUpstream()
+	}
+}
+
+// streamServers returns the ports nginx listens on for streams and the front on
+// port 443 routing passthrough streams. Other TCP streams on ports of the HTTP
+// servers and streams conflicting with another stream on their port are left
+// out.
+func (ws *WebServer) streamServers() ([]*host.StreamServer, *host.TLSFront) {
+	httpPorts := map[int]bool{80: true, 443: true}
+	quicPorts := make(map[int]bool)
+	for _, portMap := range ws.hosts {
+		for _, h := range portMap {
+			httpPorts[h.Port] = true
+			quicPorts[h.Port] = quicPorts[h.Port] || (ws.http3Supported && h.HTTP3 && h.SSLEnabled)
+		}
+	}
+
+	streams := make([]*host.Host, 0, len(ws.streams))
+	var passthrough []*host.Host
+	for key, s := range ws.streams {
+		if s.IsPassthrough() {
+			if len(s.Upstreams) == 0 {
+				continue
+			}
+			if h := ws.getHost(s.Hostname, 443); h != nil && h.SSLEnabled {
+				ws.log.Warn("TLS for %s is passed through to its containers, the HTTPS server for it is not used", s.Hostname)
+			}
+			passthrough = append(passthrough, s)
+			continue
+		}
+		if s.Transport() == host.StreamTCP && httpPorts[s.Port] {
+			ws.log.Warn("Ignoring stream %s, port %d is used by the HTTP servers", key, s.Port)
+			continue
+		}
+		if s.Transport() == host.StreamUDP && quicPorts[s.Port] {
+			ws.log.Warn("Ignoring stream %s, port %d is used by the HTTP/3 servers", key, s.Port)
+			continue
+		}
+		streams = append(streams, s)
+	}
+
+	servers, conflicts := host.StreamServers(streams)
+	for _, s := range conflicts {
+		ws.log.Warn("Ignoring stream %s, port %d is taken by another stream",
+			host.StreamKey(s.Scheme, s.Hostname, s.Port), s.Port)
+	}
+	for _, server := range servers {
+		server.Addresses = ws.listenProcessor.Global()
+		if server.MixedProxyProtocol() {
+			ws.log.Warn("Not sending the PROXY protocol on port %s, only some of its containers set PROXY_PROTOCOL_BACKEND", server.Listen())
+		}
+	}
+
+	front := host.NewTLSFront(ws.config.ACMETLSALPN, passthrough)
+	if front != nil {
+		front.Addresses = ws.listenProcessor.Global()
+		if front.MixedProxyProtocol() {
+			ws.log.Warn("Not sending the PROXY protocol to TLS passthrough containers, only some of them set PROXY_PROTOCOL_BACKEND")
+		}
+	}
+	return servers, front
+}
+
 // mergeExtras merges two ExtrasMap objects while avoiding duplicate injected configs
 func (ws *WebServer) mergeExtras(target, source *host.ExtrasMap) {
 	sourceMap := source.ToMap()
@@ -1140,9 +1603,36 @@ func (ws *WebServer) getHostsForTemplate() map[string]*host.Host {
 		}
 	}
 
+	ws.assignQUICListeners(result)
 	return result
 }
 
+// assignQUICListeners marks the SSL servers listening for HTTP/3. nginx allows
+// reuseport on a single listen per address and port, so the first server of
+// each in hostname order carries it.
+func (ws *WebServer) assignQUICListeners(hosts map[string]*host.Host) {
+	hostnames := make([]string, 0, len(hosts))
+	for hostname := range hosts {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	reusePort := make(map[string]bool)
+	for _, hostname := range hostnames {
+		h := hosts[hostname]
+		h.HTTP3Listen = ws.http3Supported && h.HTTP3 && h.SSLEnabled
+		h.HTTP3ReusePort = h.HTTP3Listen
+		for _, listen := range h.Listen(h.Port) {
+			h.HTTP3ReusePort = h.HTTP3ReusePort && !reusePort[listen]
+		}
+		if h.HTTP3ReusePort {
+			for _, listen := range h.Listen(h.Port) {
+				reusePort[listen] = true
+			}
+		}
+	}
+}
+
 // removeContainerFromHosts removes a container from all hosts and cleans up empty hosts
 func (ws *WebServer) removeContainerFromHosts(containerID string) bool {
 	removed := false
@@ -1182,5 +1672,19 @@ func (ws *WebServer) removeContainerFromHosts(containerID string) bool {
 		}
 	}
 
+	for key, s := range ws.streams {
+		if !s.RemoveContainer(containerID) {
+			continue
+		}
+		removed = true
+		ws.log.Info("Removed container %s from stream %s", containerID, key)
+		if s.IsEmpty() {
+			delete(ws.streams, key)
+			ws.log.Info("Removed empty stream %s", key)
+		} else {
+			s.BuildStreamUpstream()
+		}
+	}
+
 	return removed
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/docker/docker/api/types"
@@ -13,6 +14,7 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/rahulshinde/nginx-proxy-go/internal/config"
 	"github.com/rahulshinde/nginx-proxy-go/internal/dockerapi"
+	"github.com/rahulshinde/nginx-proxy-go/internal/host"
 	"github.com/rahulshinde/nginx-proxy-go/internal/nginx"
 )
 
@@ -130,3 +132,115 @@ func TestHandleContainerStartEvent(t *testing.T) {
 		t.Fatalf("expected nginx update command to run")
 	}
 }
+
+func TestAssignQUICListeners(t *testing.T) {
+	newSSLHost := func(hostname string, port int, http3 bool) *host.Host {
+		h := host.NewHost(hostname, port)
+		h.SetSSL(true, hostname)
+		h.HTTP3 = http3
+		return h
+	}
+	hosts := map[string]*host.Host{
+		"b.example.com": newSSLHost("b.example.com", 443, true),
+		"a.example.com": newSSLHost("a.example.com", 443, true),
+		"c.example.com": newSSLHost("c.example.com", 8443, true),
+		"d.example.com": newSSLHost("d.example.com", 443, false),
+		"e.example.com": host.NewHost("e.example.com", 80),
+		"f.example.com": newSSLHost("f.example.com", 443, true),
+	}
+	hosts["e.example.com"].HTTP3 = true
+	hosts["f.example.com"].ListenAddrs = []string{"192.168.1.10"}
+
+	// Without HTTP/3 support in nginx no server listens for QUIC
+	ws := &WebServer{}
+	ws.assignQUICListeners(hosts)
+	for hostname, h := range hosts {
+		if h.HTTP3Listen || h.HTTP3ReusePort {
+			t.Fatalf("expected no QUIC listener for %s", hostname)
+		}
+	}
+
+	ws.http3Supported = true
+	ws.assignQUICListeners(hosts)
+	expected := map[string][2]bool{
+		"a.example.com": {true, true},
+		"b.example.com": {true, false},
+		"c.example.com": {true, true},
+		"d.example.com": {false, false},
+		"e.example.com": {false, false},
+		"f.example.com": {true, true},
+	}
+	for hostname, want := range expected {
+		h := hosts[hostname]
+		if h.HTTP3Listen != want[0] || h.HTTP3ReusePort != want[1] {
+			t.Fatalf("%s: expected listen=%v reuseport=%v, got listen=%v reuseport=%v",
+				hostname, want[0], want[1], h.HTTP3Listen, h.HTTP3ReusePort)
+		}
+	}
+}
+
+func TestBackendTLSWildcardHostVerified(t *testing.T) {
+	oldHostname := os.Getenv("HOSTNAME")
+	os.Setenv("HOSTNAME", "self-container")
+	defer os.Setenv("HOSTNAME", oldHostname)
+
+	originalWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(filepath.Clean(filepath.Join(originalWD, "../../"))); err != nil {
+		t.Fatalf("chdir repo root: %v", err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(originalWD)
+	})
+
+	client := &mockDockerClient{inspect: map[string]types.ContainerJSON{}}
+	client.inspect["self-container"] = types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "self-container", Name: "/self"},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"frontend": {NetworkID: "net1"}},
+		},
+	}
+	client.inspect["abc"] = types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "abc", Name: "/app"},
+		Config: &container.Config{
+			Env: []string{"VIRTUAL_HOST=*.example.com -> https://:8443"},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"frontend": {NetworkID: "net1", IPAddress: "172.20.0.10"},
+			},
+		},
+	}
+
+	tmp := t.TempDir()
+	cfg := config.NewConfig()
+	cfg.ConfDir = filepath.Join(tmp, "nginx") + "/"
+	cfg.ChallengeDir = filepath.Join(tmp, "acme") + "/"
+	cfg.BackendTLSVerify = true
+	os.MkdirAll(filepath.Join(tmp, "acme"), 0o755)
+
+	confFile := filepath.Join(tmp, "nginx", "conf.d", "default.conf")
+	server, err := NewWebServer(client, cfg, nginx.NewNginx(confFile, cfg.ChallengeDir, &fakeCommander{}))
+	if err != nil {
+		t.Fatalf("NewWebServer error: %v", err)
+	}
+	event := events.Message{Type: "container", Action: "start", ID: "abc"}
+	if err := server.HandleContainerEvent(context.Background(), event); err != nil {
+		t.Fatalf("HandleContainerEvent error: %v", err)
+	}
+
+	// A wildcard host has no name of its own, its backends are still verified
+	data, err := os.ReadFile(confFile)
+	if err != nil {
+		t.Fatalf("read nginx configuration: %v", err)
+	}
+	conf := string(data)
+	if !strings.Contains(conf, "proxy_ssl_verify on;") || strings.Contains(conf, "proxy_ssl_verify off;") {
+		t.Fatalf("expected the backend to be verified, got:\n%s", conf)
+	}
+	if !strings.Contains(conf, "proxy_ssl_name $host;") {
+		t.Fatalf("expected the backend to be verified against the requested host, got:\n%s", conf)
+	}
+}